@@ -0,0 +1,100 @@
+package aof
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"os"
+
+	"godis-lib/interface/db"
+	"godis-lib/lib/logger"
+	"godis-lib/lib/utils"
+	"godis-lib/resp/connection"
+	"godis-lib/resp/parser"
+	"godis-lib/resp/reply"
+)
+
+// LoadOptions 用于配置AOF文件的加载
+type LoadOptions struct {
+	// Truncate 与redis的 aof-load-truncated 一致, 为true时如果文件的最后一条命令不完整(例如写入时宕机),
+	// 则将文件截断到最后一条完整的命令之后并继续启动, 否则返回错误
+	Truncate bool
+	// Parser 用于限制AOF文件中的数据, 为nil时使用默认的限制
+	Parser *parser.Options
+}
+
+// LoadResult 表示AOF文件的加载结果
+type LoadResult struct {
+	Commands  int   // 表示执行的命令数
+	Bytes     int64 // 表示加载的字节数, 即最后一条完整的命令之后的偏移量
+	Truncated bool  // 表示文件的最后一条命令不完整
+}
+
+// Load 用于加载AOF文件, 将文件中的命令依次在database中执行, 文件不存在时不执行任何命令
+//
+// 执行出错的命令会记录日志并跳过, 与执行客户端的命令一致;
+// 文件中间的数据不符合resp协议时返回错误, 错误中包含出错的偏移量
+func Load(filename string, database db.Database, opts *LoadOptions) (*LoadResult, error) {
+	if opts == nil {
+		opts = &LoadOptions{}
+	}
+	file, err := os.Open(filename)
+	if err != nil {
+		if errors.Is(err, os.ErrNotExist) {
+			return &LoadResult{}, nil
+		}
+		return nil, err
+	}
+	defer file.Close()
+
+	res, err := load(file, database, opts.Parser)
+	switch {
+	case err == nil:
+		return res, nil
+	case !res.Truncated:
+		return res, fmt.Errorf("bad file format reading the append only file %s: %w", filename, err)
+	case !opts.Truncate:
+		return res, fmt.Errorf("unexpected end of file reading the append only file %s at offset %d: %w",
+			filename, res.Bytes, err)
+	}
+
+	// 截断不完整的命令, 之后追加的命令才能被正确解析
+	logger.Warn(fmt.Sprintf("!!! Warning: short read while loading the AOF file %s!!! truncating the AOF at offset %d",
+		filename, res.Bytes))
+	if err = os.Truncate(filename, res.Bytes); err != nil {
+		return res, err
+	}
+	return res, nil
+}
+
+// LoadFrom 用于从rd中读取AOF格式的命令并在database中执行, 例如加载 BGREWRITEAOF 生成的临时文件
+//
+// 如果数据的最后一条命令不完整, LoadResult.Truncated 为true, 并返回 io.ErrUnexpectedEOF
+func LoadFrom(rd io.Reader, database db.Database) (*LoadResult, error) {
+	return load(rd, database, nil)
+}
+
+// load 用于依次执行rd中的命令, 直到读取完毕或者出错
+func load(rd io.Reader, database db.Database, opts *parser.Options) (*LoadResult, error) {
+	res := &LoadResult{}
+	decoder := parser.NewDecoderWithOptions(rd, opts)
+	conn := connection.NewFakeConn() // 记录 SELECT 选择的数据库
+	for {
+		// 执行的命令可能会保存参数, 因此不复用内存
+		cmdLine, err := decoder.NextCmdLine(nil)
+		if err == io.EOF {
+			return res, nil
+		}
+		if err != nil {
+			res.Truncated = errors.Is(err, io.ErrUnexpectedEOF)
+			return res, err
+		}
+
+		ret := database.Exec(conn, cmdLine)
+		if reply.IsErrReply(ret) {
+			logger.Error("exec err", utils.CmdLine2String(cmdLine), utils.Bytes2String(ret.Bytes()))
+		}
+		res.Commands++
+		res.Bytes = decoder.Offset()
+	}
+}
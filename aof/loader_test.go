@@ -0,0 +1,100 @@
+package aof
+
+import (
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+	"godis-lib/resp/reply"
+)
+
+// recordDB 记录执行的命令以及执行时选择的数据库
+type recordDB struct {
+	cmds []string
+}
+
+func (r *recordDB) Exec(client resp.Connection, args db.CmdLine) resp.Reply {
+	if strings.EqualFold(string(args[0]), "select") {
+		client.SelectDB(int(args[1][0] - '0'))
+		return reply.NewOKReply()
+	}
+	if strings.EqualFold(string(args[0]), "bad") {
+		return reply.NewUnknownErrReply()
+	}
+	r.cmds = append(r.cmds, string(rune('0'+client.GetDBIndex()))+" "+utils.CmdLine2String(args))
+	return reply.NewOKReply()
+}
+
+func (r *recordDB) Close() error { return nil }
+
+func (r *recordDB) AfterClientClose(resp.Connection) {}
+
+const aofData = "*2\r\n$6\r\nSELECT\r\n$1\r\n1\r\n" +
+	"*3\r\n$3\r\nSET\r\n$1\r\na\r\n$1\r\n1\r\n" +
+	"*1\r\n$3\r\nBAD\r\n" +
+	"*3\r\n$3\r\nSET\r\n$1\r\nb\r\n$1\r\n2\r\n"
+
+func TestLoadFrom(t *testing.T) {
+	database := &recordDB{}
+	res, err := LoadFrom(strings.NewReader(aofData), database)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Commands != 4 || res.Bytes != int64(len(aofData)) || res.Truncated {
+		t.Errorf("unexpected result %+v", res)
+	}
+	if strings.Join(database.cmds, ",") != "1 SET a 1,1 SET b 2" {
+		t.Errorf("unexpected commands %q", database.cmds)
+	}
+
+	res, err = LoadFrom(strings.NewReader(aofData+"*3\r\n$3\r\nSET\r\n$1\r\nc"), &recordDB{})
+	if !errors.Is(err, io.ErrUnexpectedEOF) || !res.Truncated || res.Bytes != int64(len(aofData)) {
+		t.Errorf("expected truncated result, actually %+v %v", res, err)
+	}
+}
+
+func TestLoadTruncated(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	if err := os.WriteFile(filename, []byte(aofData+"*3\r\n$3\r\nSET\r\n$1"), 0644); err != nil {
+		t.Fatal(err)
+	}
+
+	if _, err := Load(filename, &recordDB{}, nil); !errors.Is(err, io.ErrUnexpectedEOF) {
+		t.Errorf("expected unexpected EOF, actually %v", err)
+	}
+
+	database := &recordDB{}
+	res, err := Load(filename, database, &LoadOptions{Truncate: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Commands != 4 || !res.Truncated || len(database.cmds) != 2 {
+		t.Errorf("unexpected result %+v", res)
+	}
+	data, _ := os.ReadFile(filename)
+	if string(data) != aofData {
+		t.Errorf("expected file to be truncated, actually %q", data)
+	}
+}
+
+func TestLoadBadFormat(t *testing.T) {
+	dir := t.TempDir()
+	res, err := Load(filepath.Join(dir, "missing.aof"), &recordDB{}, nil)
+	if err != nil || res.Commands != 0 {
+		t.Errorf("expected empty result for missing file, actually %+v %v", res, err)
+	}
+
+	filename := filepath.Join(dir, "appendonly.aof")
+	if err = os.WriteFile(filename, []byte(aofData+"+OK\r\n"+aofData), 0644); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = Load(filename, &recordDB{}, &LoadOptions{Truncate: true}); err == nil || res.Truncated {
+		t.Errorf("expected bad format error, actually %+v %v", res, err)
+	}
+}
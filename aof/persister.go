@@ -0,0 +1,245 @@
+package aof
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"strconv"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+	"godis-lib/lib/logger"
+	"godis-lib/lib/utils"
+	"godis-lib/resp/reply"
+)
+
+const (
+	// FsyncAlways 表示每条命令写入之后都执行fsync, 最安全但是最慢
+	FsyncAlways = "always"
+	// FsyncEverySec 表示每秒执行一次fsync, 宕机时最多丢失一秒的数据
+	FsyncEverySec = "everysec"
+	// FsyncNo 表示由操作系统决定何时将数据写入磁盘
+	FsyncNo = "no"
+
+	// defaultDatabases 与redis的 databases 默认值一致
+	defaultDatabases = 16
+	// aofQueueSize 是异步写入时命令队列的长度
+	aofQueueSize = 1 << 16
+)
+
+// PersisterOptions 用于配置AOF的写入
+type PersisterOptions struct {
+	Filename  string // 表示AOF文件的路径
+	Fsync     string // 表示fsync的策略, 可选 always, everysec 和 no, 默认为 everysec
+	Databases int    // 表示数据库的个数, 重写时依次遍历, 默认为16
+
+	// NewTmpDB 用于在重写时创建一个临时的数据库, 加载重写开始时的AOF文件之后再遍历, 从而得到一致的快照,
+	// 与redis通过fork得到快照的作用相同. 为nil时不能重写AOF文件, 因为遍历正在使用的数据库时, 重写期间执行的
+	// 非幂等命令(例如INCR)既会出现在快照中, 又会在重写后的文件末尾重复执行
+	NewTmpDB func() db.DBEngine
+}
+
+// aofFile 是AOF文件需要的操作, 由 *os.File 实现, 测试中用于模拟写入失败
+type aofFile interface {
+	io.Writer
+	Sync() error
+	Stat() (os.FileInfo, error)
+	Truncate(size int64) error
+	Close() error
+}
+
+// payload 表示一条需要追加到AOF文件的命令
+type payload struct {
+	cmdLine db.CmdLine
+	dbIndex int
+}
+
+// Persister 用于将执行的写命令追加到AOF文件, 并在后台重写AOF文件
+//
+// Persister 是并发安全的
+type Persister struct {
+	ctx    context.Context
+	cancel context.CancelFunc
+
+	filename  string
+	fsync     string
+	databases int
+	newTmpDB  func() db.DBEngine
+
+	file      aofFile
+	aofChan   chan *payload
+	finished  chan struct{}
+	pausing   sync.Mutex // 重写切换文件时暂停写入, 同时保护 file, currentDB 和 err
+	currentDB int        // 表示AOF文件中最后一次 SELECT 的数据库, -1表示还没有写入 SELECT
+	err       error      // 部分写入的命令无法截断时的错误, 之后不再追加命令
+	closeOnce sync.Once
+	rewriting atomic.Bool // 同一时间只能有一次重写
+}
+
+// NewPersister 用于创建AOF的写入器, 以追加的方式打开AOF文件
+//
+// 启动时应该先通过 Load 加载已有的AOF文件, 再创建 Persister
+func NewPersister(opts *PersisterOptions) (*Persister, error) {
+	fsync := utils.If(opts.Fsync == "", FsyncEverySec, opts.Fsync)
+	if fsync != FsyncAlways && fsync != FsyncEverySec && fsync != FsyncNo {
+		return nil, fmt.Errorf("invalid appendfsync: %s", opts.Fsync)
+	}
+	file, err := os.OpenFile(opts.Filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return nil, err
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	p := &Persister{
+		ctx:       ctx,
+		cancel:    cancel,
+		filename:  opts.Filename,
+		fsync:     fsync,
+		databases: utils.If(opts.Databases > 0, opts.Databases, defaultDatabases),
+		newTmpDB:  opts.NewTmpDB,
+		file:      file,
+		finished:  make(chan struct{}),
+		currentDB: -1,
+	}
+	if fsync == FsyncAlways {
+		close(p.finished)
+		return p, nil
+	}
+
+	p.aofChan = make(chan *payload, aofQueueSize)
+	go p.listenCmd()
+	if fsync == FsyncEverySec {
+		go p.fsyncEverySecond()
+	}
+	return p, nil
+}
+
+// SaveCmdLine 用于追加一条在dbIndex中执行的写命令, dbIndex 通常是 resp.Connection 的 GetDBIndex()
+//
+// 与上一条命令的数据库不同时, 会先写入 SELECT 命令;
+// always 策略下写入并fsync之后才返回写入时的错误, 其他策略下复制命令之后在后台写入并记录写入时的错误,
+// 因此调用者返回之后可以复用参数的缓冲区
+//
+// Close 之后不能再调用 SaveCmdLine
+func (p *Persister) SaveCmdLine(dbIndex int, cmdLine db.CmdLine) error {
+	if p.fsync == FsyncAlways {
+		return p.writeAof(&payload{cmdLine: cmdLine, dbIndex: dbIndex})
+	}
+	p.aofChan <- &payload{cmdLine: copyCmdLine(cmdLine), dbIndex: dbIndex}
+	return nil
+}
+
+// copyCmdLine 用于复制命令, 所有参数复制到同一个字节数组中, 只需要分配两次内存. 为nil的参数仍然是nil
+func copyCmdLine(cmdLine db.CmdLine) db.CmdLine {
+	size := 0
+	for _, arg := range cmdLine {
+		size += len(arg)
+	}
+	buf := make([]byte, 0, size)
+	cp := make(db.CmdLine, len(cmdLine))
+	for i, arg := range cmdLine {
+		if arg == nil {
+			continue
+		}
+		buf = append(buf, arg...)
+		cp[i] = buf[len(buf)-len(arg) : len(buf) : len(buf)]
+	}
+	return cp
+}
+
+// listenCmd 用于在后台依次写入命令队列中的命令
+func (p *Persister) listenCmd() {
+	for pl := range p.aofChan {
+		if err := p.writeAof(pl); err != nil {
+			logger.Warn(err)
+		}
+	}
+	close(p.finished)
+}
+
+// writeAof 用于将命令写入AOF文件, 返回写入时的错误
+//
+// SELECT 和命令通过一次 Write 写入, 部分写入时截断已经写入的部分, 避免留下不完整的命令导致加载失败;
+// 截断也失败时不再追加任何命令
+func (p *Persister) writeAof(pl *payload) error {
+	p.pausing.Lock()
+	defer p.pausing.Unlock()
+	if p.err != nil {
+		return p.err
+	}
+
+	var buf []byte
+	if pl.dbIndex != p.currentDB {
+		selectCmd := utils.ToCmdLine("SELECT", strconv.Itoa(pl.dbIndex))
+		buf = reply.AppendTo(buf, reply.NewMultiBulkReply(selectCmd), resp.RESP2)
+	}
+	buf = reply.AppendTo(buf, reply.NewMultiBulkReply(pl.cmdLine), resp.RESP2)
+	if n, err := p.file.Write(buf); err != nil {
+		if n > 0 {
+			p.discard(int64(n), err)
+		}
+		return err
+	}
+	p.currentDB = pl.dbIndex
+	if p.fsync == FsyncAlways {
+		return p.file.Sync()
+	}
+	return nil
+}
+
+// discard 用于截断文件末尾部分写入的n个字节, 截断失败时记录到 p.err, p.pausing 必须已经加锁
+func (p *Persister) discard(n int64, cause error) {
+	info, err := p.file.Stat()
+	if err == nil {
+		err = p.file.Truncate(info.Size() - n)
+	}
+	if err != nil {
+		p.err = fmt.Errorf("aof: stop appending after a partial write: %w", errors.Join(cause, err))
+		logger.Error(p.err)
+	}
+}
+
+// fsyncEverySecond 用于每秒执行一次fsync
+func (p *Persister) fsyncEverySecond() {
+	ticker := time.NewTicker(time.Second)
+	defer ticker.Stop()
+	for {
+		select {
+		case <-ticker.C:
+			if err := p.Fsync(); err != nil {
+				logger.Error("fsync failed: ", err)
+			}
+		case <-p.ctx.Done():
+			return
+		}
+	}
+}
+
+// Fsync 用于将已经写入AOF文件的数据同步到磁盘
+func (p *Persister) Fsync() error {
+	p.pausing.Lock()
+	defer p.pausing.Unlock()
+	return p.file.Sync()
+}
+
+// Close 用于写入队列中剩余的命令并关闭AOF文件, 重复调用返回nil
+func (p *Persister) Close() error {
+	var err error
+	p.closeOnce.Do(func() {
+		if p.aofChan != nil {
+			close(p.aofChan)
+		}
+		<-p.finished
+		p.cancel()
+
+		p.pausing.Lock()
+		defer p.pausing.Unlock()
+		err = errors.Join(p.file.Sync(), p.file.Close())
+	})
+	return err
+}
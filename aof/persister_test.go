@@ -0,0 +1,335 @@
+package aof
+
+import (
+	"errors"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+	"godis-lib/resp/connection"
+	"godis-lib/resp/reply"
+)
+
+// memEngine 是一个只支持重写需要的命令的内存数据库
+type memEngine struct {
+	recordDB
+	data    []map[string]*db.DataEntity
+	expires []map[string]time.Time
+}
+
+func newMemEngine() *memEngine {
+	e := &memEngine{}
+	for i := 0; i < defaultDatabases; i++ {
+		e.data = append(e.data, map[string]*db.DataEntity{})
+		e.expires = append(e.expires, map[string]time.Time{})
+	}
+	return e
+}
+
+func (e *memEngine) Exec(client resp.Connection, args db.CmdLine) resp.Reply {
+	e.recordDB.Exec(client, args)
+	idx := client.GetDBIndex()
+	key := string(args[1])
+	switch strings.ToUpper(string(args[0])) {
+	case "SET":
+		e.data[idx][key] = db.NewDataEntity(args[2])
+	case "RPUSH":
+		entity, ok := e.data[idx][key]
+		if !ok {
+			entity = db.NewDataEntity([][]byte{})
+			e.data[idx][key] = entity
+		}
+		entity.Data = append(entity.Data.([][]byte), args[2:]...)
+	case "PEXPIREAT":
+		ms, _ := strconv.ParseInt(string(args[2]), 10, 64)
+		e.expires[idx][key] = time.UnixMilli(ms)
+	}
+	return reply.NewOKReply()
+}
+
+func (e *memEngine) ExecWithoutLock(conn resp.Connection, cmdLine db.CmdLine) resp.Reply {
+	return e.Exec(conn, cmdLine)
+}
+
+func (e *memEngine) ExecMulti(resp.Connection, []db.CmdLine) resp.Reply { return nil }
+
+func (e *memEngine) GetUndoLogs(int, [][]byte) []db.CmdLine { return nil }
+
+func (e *memEngine) ForEach(dbIndex int, cb func(key string, data *db.DataEntity, expiration *time.Time) bool) {
+	for key, entity := range e.data[dbIndex] {
+		if !cb(key, entity, nil) {
+			return
+		}
+	}
+}
+
+func (e *memEngine) RWLocks(int, []string, []string) {}
+
+func (e *memEngine) RWUnLocks(int, []string, []string) {}
+
+func (e *memEngine) GetDBSize(dbIndex int) (int, int) {
+	return len(e.data[dbIndex]), len(e.expires[dbIndex])
+}
+
+func (e *memEngine) GetEntity(dbIndex int, key string) (*db.DataEntity, bool) {
+	entity, ok := e.data[dbIndex][key]
+	return entity, ok
+}
+
+func (e *memEngine) GetExpiration(dbIndex int, key string) *time.Time {
+	if expireAt, ok := e.expires[dbIndex][key]; ok {
+		return &expireAt
+	}
+	return nil
+}
+
+func TestPersisterFsync(t *testing.T) {
+	for _, fsync := range []string{FsyncAlways, FsyncEverySec, FsyncNo} {
+		filename := filepath.Join(t.TempDir(), "appendonly.aof")
+		p, err := NewPersister(&PersisterOptions{Filename: filename, Fsync: fsync})
+		if err != nil {
+			t.Fatal(err)
+		}
+		p.SaveCmdLine(0, utils.ToCmdLine("SET", "a", "1"))
+		p.SaveCmdLine(0, utils.ToCmdLine("SET", "b", "2"))
+		cmdLine := [][]byte{[]byte("SET"), []byte("c"), []byte("3")}
+		p.SaveCmdLine(3, cmdLine)
+		cmdLine[2][0] = 'x' // 调用者复用参数的缓冲区不影响写入的命令
+		if err = p.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		database := &recordDB{}
+		if _, err = Load(filename, database, nil); err != nil {
+			t.Fatal(err)
+		}
+		if strings.Join(database.cmds, ",") != "0 SET a 1,0 SET b 2,3 SET c 3" {
+			t.Errorf("%s: unexpected commands %q", fsync, database.cmds)
+		}
+	}
+
+	if _, err := NewPersister(&PersisterOptions{Fsync: "sometimes"}); err == nil {
+		t.Errorf("expected invalid fsync error")
+	}
+}
+
+// shortFile 用于模拟写入失败, 下一次写入只写入一半的数据并返回错误
+type shortFile struct {
+	*os.File
+	fail          bool
+	truncateFails bool
+}
+
+func (f *shortFile) Write(p []byte) (int, error) {
+	if !f.fail {
+		return f.File.Write(p)
+	}
+	f.fail = false
+	n, _ := f.File.Write(p[:len(p)/2])
+	return n, errors.New("no space left on device")
+}
+
+func (f *shortFile) Truncate(size int64) error {
+	if f.truncateFails {
+		return errors.New("input/output error")
+	}
+	return f.File.Truncate(size)
+}
+
+func TestPersisterPartialWrite(t *testing.T) {
+	for _, truncateFails := range []bool{false, true} {
+		filename := filepath.Join(t.TempDir(), "appendonly.aof")
+		p, err := NewPersister(&PersisterOptions{Filename: filename, Fsync: FsyncAlways})
+		if err != nil {
+			t.Fatal(err)
+		}
+		file := &shortFile{File: p.file.(*os.File), truncateFails: truncateFails}
+		p.file = file
+		if err = p.SaveCmdLine(0, utils.ToCmdLine("SET", "a", "1")); err != nil {
+			t.Fatal(err)
+		}
+		file.fail = true
+		if err = p.SaveCmdLine(1, utils.ToCmdLine("SET", "b", "2")); err == nil {
+			t.Errorf("expected write error")
+		}
+		err = p.SaveCmdLine(2, utils.ToCmdLine("SET", "c", "3"))
+		if truncateFails != (err != nil) {
+			t.Errorf("truncate fails %v: unexpected error %v", truncateFails, err)
+		}
+		if err = p.Close(); err != nil {
+			t.Fatal(err)
+		}
+
+		// 不完整的命令被截断; 截断失败时不再追加命令, 不完整的命令只会出现在文件末尾
+		database := &recordDB{}
+		if _, err = Load(filename, database, &LoadOptions{Truncate: truncateFails}); err != nil {
+			t.Fatal(err)
+		}
+		expected := utils.If(truncateFails, "0 SET a 1", "0 SET a 1,2 SET c 3")
+		if strings.Join(database.cmds, ",") != expected {
+			t.Errorf("truncate fails %v: unexpected commands %q", truncateFails, database.cmds)
+		}
+	}
+}
+
+func TestCopyCmdLine(t *testing.T) {
+	cmdLine := db.CmdLine{[]byte("RPUSH"), nil, {}, []byte("a")}
+	cp := copyCmdLine(cmdLine)
+	if cp[1] != nil || cp[2] == nil || string(cp[0]) != "RPUSH" || string(cp[3]) != "a" {
+		t.Errorf("unexpected copy %q", cp)
+	}
+}
+
+func TestPersisterRewrite(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	engine := newMemEngine()
+	p, err := NewPersister(&PersisterOptions{
+		Filename: filename,
+		Fsync:    FsyncAlways,
+		NewTmpDB: func() db.DBEngine { return newMemEngine() },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	conn := connection.NewFakeConn()
+	exec := func(dbIndex int, args ...string) {
+		conn.SelectDB(dbIndex)
+		engine.Exec(conn, utils.ToCmdLine(args...))
+		p.SaveCmdLine(dbIndex, utils.ToCmdLine(args...))
+	}
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	for i := 0; i < 10; i++ {
+		exec(1, "SET", "a", strconv.Itoa(i))
+	}
+	for i := 0; i < 100; i++ {
+		exec(2, "RPUSH", "list", strconv.Itoa(i))
+	}
+	exec(2, "PEXPIREAT", "list", strconv.FormatInt(expireAt.UnixMilli(), 10))
+	before, _ := os.Stat(filename)
+
+	if err = p.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	exec(1, "SET", "b", "after")
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	after, _ := os.Stat(filename)
+	if after.Size() >= before.Size() {
+		t.Errorf("expected rewritten file to be smaller, %d >= %d", after.Size(), before.Size())
+	}
+	loaded := newMemEngine()
+	if _, err = Load(filename, loaded, nil); err != nil {
+		t.Fatal(err)
+	}
+	if entity, _ := loaded.GetEntity(1, "a"); entity == nil || string(entity.Data.([]byte)) != "9" {
+		t.Errorf("expected a=9, actually %v", entity)
+	}
+	if entity, _ := loaded.GetEntity(1, "b"); entity == nil || string(entity.Data.([]byte)) != "after" {
+		t.Errorf("expected b=after, actually %v", entity)
+	}
+	if entity, _ := loaded.GetEntity(2, "list"); entity == nil || len(entity.Data.([][]byte)) != 100 {
+		t.Errorf("expected list with 100 elements, actually %v", entity)
+	}
+	if expiration := loaded.GetExpiration(2, "list"); expiration == nil || !expiration.Equal(expireAt) {
+		t.Errorf("expected expiration %v, actually %v", expireAt, expiration)
+	}
+}
+
+func TestPersisterRewriteEmptyStrings(t *testing.T) {
+	filename := filepath.Join(t.TempDir(), "appendonly.aof")
+	p, err := NewPersister(&PersisterOptions{
+		Filename: filename,
+		Fsync:    FsyncAlways,
+		NewTmpDB: func() db.DBEngine { return newMemEngine() },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	p.SaveCmdLine(0, utils.ToCmdLine("SET", "empty", ""))
+	p.SaveCmdLine(0, utils.ToCmdLine("SET", "", "value"))
+	p.SaveCmdLine(0, utils.ToCmdLine("PEXPIREAT", "", strconv.FormatInt(expireAt.UnixMilli(), 10)))
+	p.SaveCmdLine(0, utils.ToCmdLine("RPUSH", "list", "", "a"))
+	if err = p.Rewrite(); err != nil {
+		t.Fatal(err)
+	}
+	if err = p.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 空字符串应该编码为$0而不是$-1, 重写之后能够原样加载
+	loaded := newMemEngine()
+	if _, err = Load(filename, loaded, nil); err != nil {
+		t.Fatal(err)
+	}
+	if entity, _ := loaded.GetEntity(0, "empty"); entity == nil || entity.Data.([]byte) == nil || len(entity.Data.([]byte)) != 0 {
+		t.Errorf("expected empty=\"\", actually %v", entity)
+	}
+	if entity, _ := loaded.GetEntity(0, ""); entity == nil || string(entity.Data.([]byte)) != "value" {
+		t.Errorf("expected empty key, actually %v", entity)
+	}
+	if expiration := loaded.GetExpiration(0, ""); expiration == nil || !expiration.Equal(expireAt) {
+		t.Errorf("expected expiration %v, actually %v", expireAt, expiration)
+	}
+	if entity, _ := loaded.GetEntity(0, "list"); entity == nil || len(entity.Data.([][]byte)) != 2 || entity.Data.([][]byte)[0] == nil {
+		t.Errorf("expected list [\"\" a], actually %v", entity)
+	}
+}
+
+func TestPersisterRewriteErrors(t *testing.T) {
+	dir := t.TempDir()
+	p, err := NewPersister(&PersisterOptions{Filename: filepath.Join(dir, "a.aof"), Fsync: FsyncAlways})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	if err = p.Rewrite(); err != ErrNoTmpDB {
+		t.Errorf("expected ErrNoTmpDB, actually %v", err)
+	}
+
+	p, err = NewPersister(&PersisterOptions{
+		Filename: filepath.Join(dir, "b.aof"),
+		Fsync:    FsyncAlways,
+		NewTmpDB: func() db.DBEngine { return newMemEngine() },
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer p.Close()
+	p.rewriting.Store(true) // 模拟正在进行的重写
+	if err = p.Rewrite(); err != ErrRewriteInProgress {
+		t.Errorf("expected ErrRewriteInProgress, actually %v", err)
+	}
+	p.rewriting.Store(false)
+	if err = p.Rewrite(); err != nil {
+		t.Errorf("expected rewrite to succeed, actually %v", err)
+	}
+	if matches, _ := filepath.Glob(filepath.Join(dir, "temp-rewriteaof-*")); len(matches) != 0 {
+		t.Errorf("unexpected temp files %v", matches)
+	}
+}
+
+func TestEntityToCmds(t *testing.T) {
+	members := map[string]struct{}{}
+	for i := 0; i < 130; i++ {
+		members[strconv.Itoa(i)] = struct{}{}
+	}
+	if cmds := EntityToCmds("set", db.NewDataEntity(members)); len(cmds) != 3 || len(cmds[2]) != 2+2 {
+		t.Errorf("expected 3 SADD commands, actually %d", len(cmds))
+	}
+	cmds := EntityToCmds("zset", db.NewDataEntity(map[string]float64{"m": 1.5}))
+	if len(cmds) != 1 || utils.CmdLine2String(cmds[0]) != "ZADD zset 1.5 m" {
+		t.Errorf("unexpected commands %q", cmds)
+	}
+	if cmds = EntityToCmds("unknown", db.NewDataEntity(42)); cmds != nil {
+		t.Errorf("expected nil for unsupported type, actually %q", cmds)
+	}
+}
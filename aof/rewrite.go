@@ -0,0 +1,264 @@
+package aof
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"time"
+
+	"godis-lib/interface/db"
+	"godis-lib/lib/logger"
+	"godis-lib/lib/utils"
+	"godis-lib/resp/reply"
+)
+
+var (
+	// ErrRewriteInProgress 表示已经有一次重写正在进行
+	ErrRewriteInProgress = errors.New("aof: background append only file rewriting already in progress")
+	// ErrNoTmpDB 表示没有配置 PersisterOptions.NewTmpDB, 无法得到一致的快照
+	ErrNoTmpDB = errors.New("aof: rewrite requires PersisterOptions.NewTmpDB")
+)
+
+// itemsPerCmd 与redis的 AOF_REWRITE_ITEMS_PER_CMD 一致, 重写时集合类型的每条命令最多包含的元素个数
+const itemsPerCmd = 64
+
+// rewriteCtx 表示一次重写的上下文
+type rewriteCtx struct {
+	tmpFile  *os.File // 表示重写的临时文件
+	fileSize int64    // 表示重写开始时AOF文件的大小, 之后追加的命令在重写完成时复制到新文件中
+	dbIndex  int      // 表示重写开始时AOF文件中选择的数据库
+}
+
+// Rewrite 用于重写AOF文件, 将数据库中的数据转换为最少的命令, 对应redis的 BGREWRITEAOF
+//
+// 重写遍历的是加载重写开始时的AOF文件得到的临时数据库, 因此需要配置 PersisterOptions.NewTmpDB, 否则返回 ErrNoTmpDB;
+// 重写期间可以继续调用 SaveCmdLine, 重写开始之后追加的命令会在重写完成时复制到新的AOF文件中;
+// 同一时间只能有一次重写, 重写正在进行时返回 ErrRewriteInProgress.
+// 通常在新的goroutine中调用, 例如 go persister.Rewrite()
+func (p *Persister) Rewrite() error {
+	if p.newTmpDB == nil {
+		return ErrNoTmpDB
+	}
+	if !p.rewriting.CompareAndSwap(false, true) {
+		return ErrRewriteInProgress
+	}
+	defer p.rewriting.Store(false)
+
+	ctx, err := p.startRewrite()
+	if err != nil {
+		return err
+	}
+	if err = p.doRewrite(ctx); err != nil {
+		_ = ctx.tmpFile.Close()
+		_ = os.Remove(ctx.tmpFile.Name())
+		return err
+	}
+	return p.finishRewrite(ctx)
+}
+
+// startRewrite 用于记录重写开始时AOF文件的大小, 并创建临时文件
+func (p *Persister) startRewrite() (*rewriteCtx, error) {
+	p.pausing.Lock()
+	defer p.pausing.Unlock()
+
+	if err := p.file.Sync(); err != nil {
+		return nil, err
+	}
+	info, err := p.file.Stat()
+	if err != nil {
+		return nil, err
+	}
+	tmpFile, err := os.CreateTemp(filepath.Dir(p.filename), "temp-rewriteaof-*.aof")
+	if err != nil {
+		return nil, err
+	}
+	return &rewriteCtx{
+		tmpFile:  tmpFile,
+		fileSize: info.Size(),
+		dbIndex:  p.currentDB,
+	}, nil
+}
+
+// doRewrite 用于遍历数据库, 将每个键转换为命令写入临时文件
+func (p *Persister) doRewrite(ctx *rewriteCtx) error {
+	engine, err := p.snapshot(ctx.fileSize)
+	if err != nil {
+		return err
+	}
+	defer engine.Close()
+
+	w := bufio.NewWriter(ctx.tmpFile)
+	for i := 0; i < p.databases; i++ {
+		selected := false
+		engine.ForEach(i, func(key string, data *db.DataEntity, expiration *time.Time) bool {
+			cmds := EntityToCmds(key, data)
+			if cmds == nil {
+				logger.Warn("aof rewrite: unsupported data type of key ", key)
+				return true
+			}
+			if len(cmds) == 0 { // 空的集合
+				return true
+			}
+			if !selected { // 空的数据库不需要 SELECT
+				selected = true
+				cmds = append([]db.CmdLine{utils.ToCmdLine("SELECT", strconv.Itoa(i))}, cmds...)
+			}
+			if expiration == nil { // 部分实现在 ForEach 中不提供过期时间
+				expiration = engine.GetExpiration(i, key)
+			}
+			if expiration != nil {
+				cmds = append(cmds, MakeExpireCmd(key, *expiration))
+			}
+			for _, cmd := range cmds {
+				if _, err = w.Write(reply.NewMultiBulkReply(cmd).Bytes()); err != nil {
+					return false
+				}
+			}
+			return true
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return w.Flush()
+}
+
+// snapshot 用于将AOF文件的前size字节加载到临时的数据库中, 作为重写时遍历的快照
+func (p *Persister) snapshot(size int64) (db.DBEngine, error) {
+	file, err := os.Open(p.filename)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	tmpDB := p.newTmpDB()
+	if _, err = LoadFrom(io.LimitReader(file, size), tmpDB); err != nil {
+		_ = tmpDB.Close()
+		return nil, err
+	}
+	return tmpDB, nil
+}
+
+// finishRewrite 用于将重写期间追加的命令复制到临时文件, 并用临时文件替换AOF文件
+func (p *Persister) finishRewrite(ctx *rewriteCtx) (err error) {
+	p.pausing.Lock()
+	defer p.pausing.Unlock()
+	defer func() {
+		if err != nil {
+			_ = ctx.tmpFile.Close()
+			_ = os.Remove(ctx.tmpFile.Name())
+		}
+	}()
+
+	src, err := os.Open(p.filename)
+	if err != nil {
+		return err
+	}
+	defer src.Close()
+	if _, err = src.Seek(ctx.fileSize, io.SeekStart); err != nil {
+		return err
+	}
+
+	// 追加的命令是在重写开始时选择的数据库中执行的
+	if ctx.dbIndex >= 0 {
+		selectCmd := utils.ToCmdLine("SELECT", strconv.Itoa(ctx.dbIndex))
+		if _, err = ctx.tmpFile.Write(reply.NewMultiBulkReply(selectCmd).Bytes()); err != nil {
+			return err
+		}
+	}
+	if _, err = io.Copy(ctx.tmpFile, src); err != nil {
+		return err
+	}
+	if err = errors.Join(ctx.tmpFile.Sync(), ctx.tmpFile.Close()); err != nil {
+		return err
+	}
+	if err = os.Rename(ctx.tmpFile.Name(), p.filename); err != nil {
+		return err
+	}
+
+	// 重新打开新的AOF文件, 之后的命令追加到新文件中
+	file, err := os.OpenFile(p.filename, os.O_APPEND|os.O_CREATE|os.O_RDWR, 0600)
+	if err != nil {
+		return err
+	}
+	_ = p.file.Close()
+	p.file = file
+	return nil
+}
+
+// EntityToCmds 用于将键对应的数据转换为重建数据的命令, 不支持的数据类型返回nil
+//
+// 支持的数据类型:
+//
+//	[]byte, string                 SET key value
+//	[][]byte                       RPUSH key value [value ...]
+//	map[string][]byte              HSET key field value [field value ...]
+//	map[string]struct{}            SADD key member [member ...]
+//	map[string]float64             ZADD key score member [score member ...]
+//
+// 集合类型的元素较多时拆分为多条命令, 每条命令最多包含64个元素
+func EntityToCmds(key string, entity *db.DataEntity) []db.CmdLine {
+	if entity == nil {
+		return nil
+	}
+	switch data := entity.Data.(type) {
+	case []byte:
+		return []db.CmdLine{utils.ToCmdLine2("SET", []byte(key), data)}
+	case string:
+		return []db.CmdLine{utils.ToCmdLine("SET", key, data)}
+	case [][]byte:
+		return batchCmds("RPUSH", key, len(data), func(yield func(...[]byte)) {
+			for _, value := range data {
+				yield(value)
+			}
+		})
+	case map[string][]byte:
+		return batchCmds("HSET", key, len(data), func(yield func(...[]byte)) {
+			for field, value := range data {
+				yield([]byte(field), value)
+			}
+		})
+	case map[string]struct{}:
+		return batchCmds("SADD", key, len(data), func(yield func(...[]byte)) {
+			for member := range data {
+				yield([]byte(member))
+			}
+		})
+	case map[string]float64:
+		return batchCmds("ZADD", key, len(data), func(yield func(...[]byte)) {
+			for member, score := range data {
+				yield([]byte(strconv.FormatFloat(score, 'f', -1, 64)), []byte(member))
+			}
+		})
+	}
+	return nil
+}
+
+// batchCmds 用于将集合类型的size个元素拆分为多条命令, each 用于依次产生每个元素对应的参数
+func batchCmds(name, key string, size int, each func(yield func(...[]byte))) []db.CmdLine {
+	cmds := make([]db.CmdLine, 0, (size+itemsPerCmd-1)/itemsPerCmd)
+	var cmd db.CmdLine
+	items := 0
+	each(func(args ...[]byte) {
+		if cmd == nil {
+			cmd = utils.ToCmdLine(name, key)
+		}
+		cmd = append(cmd, args...)
+		if items++; items == itemsPerCmd {
+			cmds = append(cmds, cmd)
+			cmd, items = nil, 0
+		}
+	})
+	if cmd != nil {
+		cmds = append(cmds, cmd)
+	}
+	return cmds
+}
+
+// MakeExpireCmd 用于生成设置过期时间的命令, 使用绝对时间以便在加载时保持一致
+func MakeExpireCmd(key string, expireAt time.Time) db.CmdLine {
+	return utils.ToCmdLine("PEXPIREAT", key, strconv.FormatInt(expireAt.UnixMilli(), 10))
+}
@@ -8,13 +8,20 @@ import (
 // io.Writer is used to write data to the client.
 // GetDBIndex returns the current db index.
 // SelectDB selects the db with the given index.
+// GetProtocol returns the negotiated protocol version, RESP2 or RESP3.
+// WriteReply encodes the reply with the negotiated protocol and writes it to the client.
 type Connection interface {
 	io.Writer
+	WriteReply(Reply) error
 	io.Closer
 	GetDBIndex() int
 	SelectDB(int)
 	RemoteAddr() string
 
+	// protocol version
+	GetProtocol() int
+	SetProtocol(int)
+
 	// password
 	SetPassword(string)
 	GetPassword() string
@@ -30,3 +37,31 @@ type Connection interface {
 	AddTxError(err error)
 	GetTxErrors() []error
 }
+
+// ClientInfo is the identity of the client kept by a Connection, e.g. connection.RespConnection.
+// It is optional, so that other implementations of Connection are not required to keep it,
+// callers type-assert for it:
+//
+//	if info, ok := conn.(resp.ClientInfo); ok {
+//		info.SetName(name)
+//	}
+type ClientInfo interface {
+	// user authenticated by the connection, e.g. by the TLS client certificate, empty means the default user
+	SetUser(string)
+	GetUser() string
+
+	// client identity, see CLIENT ID, CLIENT SETNAME and CLIENT SETINFO
+	ID() int64
+	GetName() string
+	SetName(string)
+	SetLibName(string)
+	SetLibVer(string)
+
+	// role of the connection, used by CLIENT LIST and CLIENT KILL TYPE
+	SetSlave()
+	IsSlave() bool
+	SetMaster()
+	IsMaster() bool
+	SetPubSub(bool)
+	InPubSub() bool
+}
@@ -1,5 +1,11 @@
 package resp
 
+// 协议版本, 由客户端通过 HELLO 命令协商
+const (
+	RESP2 = 2
+	RESP3 = 3
+)
+
 // Reply 是一个给客户端回复的接口
 type Reply interface {
 	// Bytes 返回一个字节数组的回复, 使用resp格式
@@ -11,4 +17,15 @@ type ErrorReply interface {
 	Reply
 	// Error 只返回错误信息, 不使用resp格式
 	Error() string
+	// Code 返回错误码, 即错误信息的第一个单词, 例如 ERR 或 WRONGTYPE
+	Code() string
+}
+
+// ProtocolReply 是一个可以根据协议版本编码的回复接口
+//
+// RESP3新增的类型在RESP2连接上需要降级为RESP2中等价的类型, 例如字典降级为数组
+type ProtocolReply interface {
+	Reply
+	// ProtoBytes 返回指定协议版本的resp格式字节数组
+	ProtoBytes(protocol int) []byte
 }
@@ -11,10 +11,14 @@ func Bytes2String(b []byte) (s string) {
 	return *(*string)(unsafe.Pointer(&b))
 }
 
-// String2Bytes convert string to bytes, only readable
+// String2Bytes convert string to bytes, only readable.
+// An empty string is converted to an empty but non-nil slice.
 //
 // NOTE: this function is not safe, it may cause memory leak
 func String2Bytes(s string) (b []byte) {
+	if len(s) == 0 {
+		return []byte{}
+	}
 	return unsafe.Slice(unsafe.StringData(s), len(s))
 }
 
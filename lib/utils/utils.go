@@ -2,11 +2,13 @@ package utils
 
 import (
 	"bytes"
+	"errors"
 	"godis-lib/interface/db"
 	"strings"
 )
 
-// ToCmdLine convert strings to [][]byte
+// ToCmdLine convert strings to [][]byte, empty strings become empty but non-nil
+// slices, so they are encoded as "$0" rather than the null bulk "$-1"
 func ToCmdLine(cmd ...string) [][]byte {
 	args := make([][]byte, len(cmd))
 	for i, s := range cmd {
@@ -40,6 +42,126 @@ func ToCmdLine3(cmd []byte) [][]byte {
 	return result
 }
 
+// ErrUnbalancedQuotes is returned by SplitArgs when a quoted argument is not closed properly
+var ErrUnbalancedQuotes = errors.New("unbalanced quotes")
+
+// SplitArgs splits a line into arguments the same way as redis' sdssplitargs,
+// it is used to parse inline commands sent by telnet or nc.
+//
+// Arguments are separated by spaces or '\0', double quoted arguments support escapes
+// like \n, \r, \t, \b, \a and \xHH, single quoted arguments only support \'.
+// A closing quote must be followed by a space or the end of line.
+func SplitArgs(line []byte) ([][]byte, error) {
+	var result [][]byte
+	i := 0
+	for {
+		for i < len(line) && isSpace(line[i]) { // skip blanks
+			i++
+		}
+		if i == len(line) {
+			return result, nil
+		}
+
+		var (
+			arg     = make([]byte, 0, 16)
+			inDQ    bool // in double quotes
+			inSQ    bool // in single quotes
+			closed  bool
+			current byte
+		)
+		for !closed {
+			if i == len(line) {
+				if inDQ || inSQ { // unterminated quotes
+					return nil, ErrUnbalancedQuotes
+				}
+				break
+			}
+			current = line[i]
+			switch {
+			case inDQ:
+				if current == '\\' && i+3 < len(line) && line[i+1] == 'x' && isHexDigit(line[i+2]) && isHexDigit(line[i+3]) {
+					arg = append(arg, hexDigitToInt(line[i+2])<<4|hexDigitToInt(line[i+3]))
+					i += 3
+				} else if current == '\\' && i+1 < len(line) {
+					i++
+					switch line[i] {
+					case 'n':
+						arg = append(arg, '\n')
+					case 'r':
+						arg = append(arg, '\r')
+					case 't':
+						arg = append(arg, '\t')
+					case 'b':
+						arg = append(arg, '\b')
+					case 'a':
+						arg = append(arg, '\a')
+					default:
+						arg = append(arg, line[i])
+					}
+				} else if current == '"' {
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, ErrUnbalancedQuotes
+					}
+					closed = true
+				} else {
+					arg = append(arg, current)
+				}
+			case inSQ:
+				if current == '\\' && i+1 < len(line) && line[i+1] == '\'' {
+					i++
+					arg = append(arg, '\'')
+				} else if current == '\'' {
+					// closing quote must be followed by a space or nothing at all
+					if i+1 < len(line) && !isSpace(line[i+1]) {
+						return nil, ErrUnbalancedQuotes
+					}
+					closed = true
+				} else {
+					arg = append(arg, current)
+				}
+			default:
+				switch current {
+				case ' ', '\n', '\r', '\t', 0:
+					closed = true
+				case '"':
+					inDQ = true
+				case '\'':
+					inSQ = true
+				default:
+					arg = append(arg, current)
+				}
+			}
+			i++
+		}
+		result = append(result, arg)
+	}
+}
+
+// isSpace reports whether c separates arguments, '\0' is included since it terminates the line in sdssplitargs
+func isSpace(c byte) bool {
+	switch c {
+	case ' ', '\t', '\n', '\v', '\f', '\r', 0:
+		return true
+	}
+	return false
+}
+
+func isHexDigit(c byte) bool {
+	return ('0' <= c && c <= '9') || ('a' <= c && c <= 'f') || ('A' <= c && c <= 'F')
+}
+
+func hexDigitToInt(c byte) byte {
+	switch {
+	case '0' <= c && c <= '9':
+		return c - '0'
+	case 'a' <= c && c <= 'f':
+		return c - 'a' + 10
+	default:
+		return c - 'A' + 10
+	}
+}
+
 // BytesEquals check whether the given bytes is equal
 func BytesEquals(a, b []byte) bool {
 	return bytes.Equal(a, b)
@@ -5,6 +5,16 @@ import (
 	"time"
 )
 
+func TestToCmdLine(t *testing.T) {
+	args := ToCmdLine("SET", "", "")
+	if len(args) != 3 || args[1] == nil || args[2] == nil {
+		t.Errorf("expected empty but non-nil arguments, actually %#v", args)
+	}
+	if args = ToCmdLine2("", []byte("a")); args[0] == nil {
+		t.Errorf("expected empty but non-nil command name")
+	}
+}
+
 func TestToCmdLine3(t *testing.T) {
 	timestamp := time.Unix(1713597327, 0)
 	t.Log(timestamp.Format("2006-01-02 15:04:05"))
@@ -13,3 +23,39 @@ func TestToCmdLine3(t *testing.T) {
 func TestClose(t *testing.T) {
 
 }
+
+func TestSplitArgs(t *testing.T) {
+	tests := []struct {
+		line     string
+		expected []string
+		err      error
+	}{
+		{"", nil, nil},
+		{"  set  key value\r\n", []string{"set", "key", "value"}, nil},
+		{`set key "hello world"`, []string{"set", "key", "hello world"}, nil},
+		{`set "\x41\x6a" "a\tb\"c\\"`, []string{"set", "Aj", "a\tb\"c\\"}, nil},
+		{`set 'it\'s' 'raw\n'`, []string{"set", "it's", `raw\n`}, nil},
+		{`set "" ''`, []string{"set", "", ""}, nil},
+		{"set\x00key \x00value\x00", []string{"set", "key", "value"}, nil},
+		{`set "a\x00b"` + "\x00", []string{"set", "a\x00b"}, nil},
+		{`set "key`, nil, ErrUnbalancedQuotes},
+		{`set 'key`, nil, ErrUnbalancedQuotes},
+		{`set "key"value`, nil, ErrUnbalancedQuotes},
+	}
+	for _, tt := range tests {
+		args, err := SplitArgs([]byte(tt.line))
+		if err != tt.err {
+			t.Errorf("%q: expected error %v, actually %v", tt.line, tt.err, err)
+			continue
+		}
+		if len(args) != len(tt.expected) {
+			t.Errorf("%q: expected %q, actually %q", tt.line, tt.expected, args)
+			continue
+		}
+		for i := range args {
+			if string(args[i]) != tt.expected[i] {
+				t.Errorf("%q: expected %q, actually %q", tt.line, tt.expected[i], args[i])
+			}
+		}
+	}
+}
@@ -0,0 +1,15 @@
+package rdb
+
+import "hash/crc64"
+
+// jonesPoly 是redis使用的 CRC-64-Jones 的多项式(反射形式)
+const jonesPoly = 0x95AC9329AC4BC9B5
+
+var jonesTable = crc64.MakeTable(jonesPoly)
+
+// crc64Jones 用于在crc的基础上计算p的校验和, 与redis的crc64一致
+//
+// redis的crc64初始值为0且结果不取反, 而标准库在计算前后都会取反, 因此需要抵消
+func crc64Jones(crc uint64, p []byte) uint64 {
+	return ^crc64.Update(^crc, jonesTable, p)
+}
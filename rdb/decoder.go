@@ -0,0 +1,458 @@
+package rdb
+
+import (
+	"bufio"
+	"bytes"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"godis-lib/interface/db"
+)
+
+// maxPreallocLen 是根据长度预先分配的最大字节数或元素个数, 避免损坏的文件耗尽内存
+const maxPreallocLen = 64 * 1024
+
+// ErrChecksum 表示RDB文件的校验和不一致
+var ErrChecksum = errors.New("rdb: checksum mismatch")
+
+// Entry 表示RDB文件中的一个键
+//
+// Value 中的数据类型与 Encoder.WriteEntry 支持的类型一致, 有序集合为 map[string]float64
+type Entry struct {
+	DBIndex    int
+	Key        string
+	Value      *db.DataEntity
+	Expiration *time.Time // 为nil表示没有过期时间
+}
+
+// Decoder 用于读取RDB文件
+//
+// 除了 Encoder 写入的基础编码之外, 还支持redis使用的压缩编码:
+// LZF压缩的字符串, ziplist, listpack, intset 和 quicklist;
+// 不支持stream, module 以及带有字段过期时间的哈希表
+type Decoder struct {
+	r   *bufio.Reader
+	crc uint64 // 表示已经读取的数据的校验和
+	buf [8]byte
+}
+
+// NewDecoder 用于创建从r读取数据的解码器
+func NewDecoder(r io.Reader) *Decoder {
+	return &Decoder{r: bufio.NewReader(r)}
+}
+
+// read 用于读取len(p)字节的数据并更新校验和
+func (d *Decoder) read(p []byte) error {
+	if _, err := io.ReadFull(d.r, p); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return err
+	}
+	d.crc = crc64Jones(d.crc, p)
+	return nil
+}
+
+func (d *Decoder) readByte() (byte, error) {
+	err := d.read(d.buf[:1])
+	return d.buf[0], err
+}
+
+// readBytes 用于读取n字节的数据, 较大的数据随着读取逐步扩容, 而不是根据长度一次性分配
+func (d *Decoder) readBytes(n uint64) ([]byte, error) {
+	if n <= maxPreallocLen {
+		p := make([]byte, n)
+		return p, d.read(p)
+	}
+	var buf bytes.Buffer
+	if _, err := io.CopyN(&buf, d.r, int64(n)); err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+	d.crc = crc64Jones(d.crc, buf.Bytes())
+	return buf.Bytes(), nil
+}
+
+// readLength 用于读取长度, encoded 为true时表示特殊编码的字符串, 返回的长度是编码方式, 参见 Encoder.writeLength
+func (d *Decoder) readLength() (n uint64, encoded bool, err error) {
+	first, err := d.readByte()
+	if err != nil {
+		return 0, false, err
+	}
+	switch first >> 6 {
+	case len6Bit:
+		return uint64(first & 0x3f), false, nil
+	case len14Bit:
+		next, err := d.readByte()
+		return uint64(first&0x3f)<<8 | uint64(next), false, err
+	case lenEncoded:
+		return uint64(first & 0x3f), true, nil
+	}
+	switch first {
+	case len32Bit:
+		err = d.read(d.buf[:4])
+		return uint64(binary.BigEndian.Uint32(d.buf[:4])), false, err
+	case len64Bit:
+		err = d.read(d.buf[:8])
+		return binary.BigEndian.Uint64(d.buf[:8]), false, err
+	}
+	return 0, false, fmt.Errorf("rdb: unknown length encoding 0x%02x", first)
+}
+
+// readLen 用于读取集合的元素个数
+func (d *Decoder) readLen() (uint64, error) {
+	n, encoded, err := d.readLength()
+	if err == nil && encoded {
+		err = errors.New("rdb: unexpected encoded length")
+	}
+	return n, err
+}
+
+// readString 用于读取字符串, 包括整数编码和LZF压缩的字符串
+func (d *Decoder) readString() ([]byte, error) {
+	n, encoded, err := d.readLength()
+	if err != nil {
+		return nil, err
+	}
+	if !encoded {
+		return d.readBytes(n)
+	}
+
+	switch n {
+	case encInt8:
+		b, err := d.readByte()
+		return strconv.AppendInt(nil, int64(int8(b)), 10), err
+	case encInt16:
+		err = d.read(d.buf[:2])
+		return strconv.AppendInt(nil, int64(int16(binary.LittleEndian.Uint16(d.buf[:2]))), 10), err
+	case encInt32:
+		err = d.read(d.buf[:4])
+		return strconv.AppendInt(nil, int64(int32(binary.LittleEndian.Uint32(d.buf[:4]))), 10), err
+	case encLZF:
+		compressedLen, err := d.readLen()
+		if err != nil {
+			return nil, err
+		}
+		rawLen, err := d.readLen()
+		if err != nil {
+			return nil, err
+		}
+		// 在读取压缩数据之前检查解压后的长度, 损坏的长度不会导致分配大量内存
+		if rawLen > math.MaxInt || rawLen/lzfMaxRatio > compressedLen {
+			return nil, errLZF
+		}
+		compressed, err := d.readBytes(compressedLen)
+		if err != nil {
+			return nil, err
+		}
+		return lzfDecompress(compressed, int(rawLen))
+	}
+	return nil, fmt.Errorf("rdb: unknown string encoding %d", n)
+}
+
+// readDoubleString 用于读取旧版本的有序集合中以字符串表示的分数
+func (d *Decoder) readDoubleString() (float64, error) {
+	n, err := d.readByte()
+	if err != nil {
+		return 0, err
+	}
+	switch n {
+	case 253:
+		return math.NaN(), nil
+	case 254:
+		return math.Inf(1), nil
+	case 255:
+		return math.Inf(-1), nil
+	}
+	p := make([]byte, n)
+	if err = d.read(p); err != nil {
+		return 0, err
+	}
+	return strconv.ParseFloat(string(p), 64)
+}
+
+// Parse 用于依次读取RDB文件中的每个键, cb 返回false时停止读取并返回nil
+//
+// 读取到文件结尾之后会检查校验和, 校验和为0表示写入时没有计算校验和, 不一致时返回 ErrChecksum
+func (d *Decoder) Parse(cb func(entry *Entry) bool) error {
+	if err := d.readHeader(); err != nil {
+		return err
+	}
+
+	dbIndex := 0
+	var expiration *time.Time
+	for {
+		op, err := d.readByte()
+		if err != nil {
+			return err
+		}
+		switch op {
+		case opEOF:
+			return d.checksum()
+		case opSelectDB:
+			n, err := d.readLen()
+			if err != nil {
+				return err
+			}
+			dbIndex = int(n)
+		case opResizeDB:
+			if _, err = d.readLen(); err == nil {
+				_, err = d.readLen()
+			}
+		case opAux:
+			if _, err = d.readString(); err == nil {
+				_, err = d.readString()
+			}
+		case opFunction2:
+			_, err = d.readString()
+		case opSlotInfo:
+			for i := 0; i < 3 && err == nil; i++ {
+				_, err = d.readLen()
+			}
+		case opFreq:
+			_, err = d.readByte()
+		case opIdle:
+			_, err = d.readLen()
+		case opExpireTime:
+			if err = d.read(d.buf[:4]); err == nil {
+				t := time.Unix(int64(binary.LittleEndian.Uint32(d.buf[:4])), 0)
+				expiration = &t
+			}
+		case opExpireTimeMs:
+			if err = d.read(d.buf[:8]); err == nil {
+				t := time.UnixMilli(int64(binary.LittleEndian.Uint64(d.buf[:8])))
+				expiration = &t
+			}
+		case opModuleAux:
+			return errors.New("rdb: module aux data is not supported")
+		default:
+			key, err := d.readString()
+			if err != nil {
+				return err
+			}
+			value, err := d.readValue(op)
+			if err != nil {
+				return fmt.Errorf("rdb: read key %q: %w", key, err)
+			}
+			if !cb(&Entry{DBIndex: dbIndex, Key: string(key), Value: value, Expiration: expiration}) {
+				return nil
+			}
+			expiration = nil
+		}
+		if err != nil {
+			return err
+		}
+	}
+}
+
+// readHeader 用于读取并检查文件头, 例如 REDIS0009
+func (d *Decoder) readHeader() error {
+	header := make([]byte, 9)
+	if err := d.read(header); err != nil {
+		return err
+	}
+	if !bytes.HasPrefix(header, []byte("REDIS")) {
+		return errors.New("rdb: invalid magic string")
+	}
+	version, err := strconv.Atoi(string(header[5:]))
+	if err != nil || version < 1 || version > maxVersion {
+		return fmt.Errorf("rdb: unsupported version %q", header[5:])
+	}
+	return nil
+}
+
+// checksum 用于读取并检查文件结尾的校验和
+func (d *Decoder) checksum() error {
+	expected := d.crc
+	if _, err := io.ReadFull(d.r, d.buf[:8]); err != nil {
+		if err == io.EOF { // 版本5之前的文件没有校验和
+			return nil
+		}
+		return err
+	}
+	if actual := binary.LittleEndian.Uint64(d.buf[:8]); actual != 0 && actual != expected {
+		return ErrChecksum
+	}
+	return nil
+}
+
+// readValue 用于读取typ类型的值
+func (d *Decoder) readValue(typ byte) (*db.DataEntity, error) {
+	switch typ {
+	case typeString:
+		value, err := d.readString()
+		return db.NewDataEntity(value), err
+	case typeList:
+		values, err := d.readStrings(1)
+		return db.NewDataEntity(values), err
+	case typeSet:
+		members, err := d.readStrings(1)
+		return db.NewDataEntity(toSet(members)), err
+	case typeHash:
+		pairs, err := d.readStrings(2)
+		if err != nil {
+			return nil, err
+		}
+		return db.NewDataEntity(toHash(pairs)), nil
+	case typeZSet, typeZSet2:
+		zset, err := d.readZSet(typ)
+		return db.NewDataEntity(zset), err
+	case typeListQuicklist, typeListQuicklist2:
+		values, err := d.readQuicklist(typ)
+		return db.NewDataEntity(values), err
+	}
+
+	// 其余的类型都是压缩编码, 整个值是一个字符串
+	blob, err := d.readString()
+	if err != nil {
+		return nil, err
+	}
+	switch typ {
+	case typeListZiplist:
+		values, err := parseZiplist(blob)
+		return db.NewDataEntity(values), err
+	case typeSetIntset:
+		members, err := parseIntset(blob)
+		return db.NewDataEntity(toSet(members)), err
+	case typeSetListpack:
+		members, err := parseListpack(blob)
+		return db.NewDataEntity(toSet(members)), err
+	case typeHashZiplist, typeHashListpack:
+		pairs, err := parsePacked(blob, typ == typeHashZiplist)
+		if err != nil {
+			return nil, err
+		}
+		if len(pairs)%2 != 0 {
+			return nil, errors.New("rdb: odd number of hash elements")
+		}
+		return db.NewDataEntity(toHash(pairs)), nil
+	case typeZSetZiplist, typeZSetListpack:
+		pairs, err := parsePacked(blob, typ == typeZSetZiplist)
+		if err != nil {
+			return nil, err
+		}
+		zset, err := toZSet(pairs)
+		return db.NewDataEntity(zset), err
+	}
+	return nil, fmt.Errorf("rdb: unsupported type %d", typ)
+}
+
+// readStrings 用于读取元素个数以及n倍个数的字符串, 例如哈希表的每个元素包含字段和值两个字符串
+func (d *Decoder) readStrings(n uint64) ([][]byte, error) {
+	size, err := d.readLen()
+	if err != nil {
+		return nil, err
+	}
+	size *= n
+	values := make([][]byte, 0, min(size, maxPreallocLen))
+	for i := uint64(0); i < size; i++ {
+		value, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+	return values, nil
+}
+
+// readZSet 用于读取有序集合, 旧版本的分数以字符串表示, 新版本为8字节的二进制浮点数
+func (d *Decoder) readZSet(typ byte) (map[string]float64, error) {
+	size, err := d.readLen()
+	if err != nil {
+		return nil, err
+	}
+	zset := make(map[string]float64, min(size, maxPreallocLen))
+	for i := uint64(0); i < size; i++ {
+		member, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+		var score float64
+		if typ == typeZSet {
+			score, err = d.readDoubleString()
+		} else if err = d.read(d.buf[:8]); err == nil {
+			score = math.Float64frombits(binary.LittleEndian.Uint64(d.buf[:8]))
+		}
+		if err != nil {
+			return nil, err
+		}
+		zset[string(member)] = score
+	}
+	return zset, nil
+}
+
+// readQuicklist 用于读取quicklist编码的列表, 每个节点是一个ziplist,
+// 版本2的每个节点是listpack或者单独存储的较大的元素
+func (d *Decoder) readQuicklist(typ byte) ([][]byte, error) {
+	nodes, err := d.readLen()
+	if err != nil {
+		return nil, err
+	}
+	var values [][]byte
+	for i := uint64(0); i < nodes; i++ {
+		container := uint64(quicklistNodePacked)
+		if typ == typeListQuicklist2 {
+			if container, err = d.readLen(); err != nil {
+				return nil, err
+			}
+		}
+		blob, err := d.readString()
+		if err != nil {
+			return nil, err
+		}
+
+		var elements [][]byte
+		switch {
+		case container == quicklistNodePlain:
+			elements = [][]byte{blob}
+		case typ == typeListQuicklist:
+			elements, err = parseZiplist(blob)
+		default:
+			elements, err = parseListpack(blob)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, elements...)
+	}
+	return values, nil
+}
+
+func toSet(members [][]byte) map[string]struct{} {
+	set := make(map[string]struct{}, len(members))
+	for _, member := range members {
+		set[string(member)] = struct{}{}
+	}
+	return set
+}
+
+func toHash(pairs [][]byte) map[string][]byte {
+	hash := make(map[string][]byte, len(pairs)/2)
+	for i := 0; i+1 < len(pairs); i += 2 {
+		hash[string(pairs[i])] = pairs[i+1]
+	}
+	return hash
+}
+
+// toZSet 用于将压缩编码中交替出现的成员和分数转换为有序集合
+func toZSet(pairs [][]byte) (map[string]float64, error) {
+	if len(pairs)%2 != 0 {
+		return nil, errors.New("rdb: odd number of zset elements")
+	}
+	zset := make(map[string]float64, len(pairs)/2)
+	for i := 0; i < len(pairs); i += 2 {
+		score, err := strconv.ParseFloat(string(pairs[i+1]), 64)
+		if err != nil {
+			return nil, fmt.Errorf("rdb: invalid zset score %q", pairs[i+1])
+		}
+		zset[string(pairs[i])] = score
+	}
+	return zset, nil
+}
@@ -0,0 +1,191 @@
+package rdb
+
+import (
+	"bytes"
+	"math"
+	"reflect"
+	"testing"
+	"time"
+)
+
+// 以下数据与redis 7写入的压缩编码一致
+var (
+	// ["a", 12, "hello"]
+	testZiplist = []byte{
+		0x19, 0, 0, 0, 0x12, 0, 0, 0, 3, 0,
+		0x00, 0x01, 'a',
+		0x03, 0xFD,
+		0x02, 0x05, 'h', 'e', 'l', 'l', 'o',
+		0xFF,
+	}
+	// ["f1", "v1", "n", -100, "big", 100000]
+	testListpack = []byte{
+		0x25, 0, 0, 0, 6, 0,
+		0x82, 'f', '1', 3,
+		0x82, 'v', '1', 3,
+		0x81, 'n', 2,
+		0xDF, 0x9C, 2,
+		0x83, 'b', 'i', 'g', 4,
+		0xF2, 0xA0, 0x86, 0x01, 4,
+		0xFF,
+	}
+	// [1, -2, 300]
+	testIntset = []byte{2, 0, 0, 0, 3, 0, 0, 0, 0x01, 0x00, 0xFE, 0xFF, 0x2C, 0x01}
+)
+
+func TestParseCompactEncodings(t *testing.T) {
+	values, err := parseZiplist(testZiplist)
+	if err != nil || !reflect.DeepEqual(values, [][]byte{[]byte("a"), []byte("12"), []byte("hello")}) {
+		t.Errorf("unexpected ziplist %q %v", values, err)
+	}
+	values, err = parseListpack(testListpack)
+	expected := [][]byte{[]byte("f1"), []byte("v1"), []byte("n"), []byte("-100"), []byte("big"), []byte("100000")}
+	if err != nil || !reflect.DeepEqual(values, expected) {
+		t.Errorf("unexpected listpack %q %v", values, err)
+	}
+	values, err = parseIntset(testIntset)
+	if err != nil || !reflect.DeepEqual(values, [][]byte{[]byte("1"), []byte("-2"), []byte("300")}) {
+		t.Errorf("unexpected intset %q %v", values, err)
+	}
+
+	if _, err = parseZiplist(testZiplist[:15]); err == nil {
+		t.Errorf("expected error for truncated ziplist")
+	}
+	// 10xxxxxx 只有 0x80 是合法的32位长度编码
+	for _, enc := range []byte{0x80, 0x81, 0xBF} {
+		blob := []byte{0x11, 0, 0, 0, 0x0A, 0, 0, 0, 1, 0, 0x00, enc, 0, 0, 0, 1, 'a', 0xFF}
+		values, err = parseZiplist(blob)
+		if enc == 0x80 && (err != nil || len(values) != 1 || string(values[0]) != "a") {
+			t.Errorf("unexpected ziplist %q %v", values, err)
+		} else if enc != 0x80 && err != errCorrupt {
+			t.Errorf("0x%02x: expected errCorrupt, actually %v", enc, err)
+		}
+	}
+	if _, err = parseListpack(testListpack[:12]); err == nil {
+		t.Errorf("expected error for truncated listpack")
+	}
+	if _, err = parseIntset(testIntset[:10]); err == nil {
+		t.Errorf("expected error for truncated intset")
+	}
+}
+
+func TestDecoderCompactTypes(t *testing.T) {
+	var buf bytes.Buffer
+	enc := NewEncoder(&buf)
+	if err := enc.WriteHeader(); err != nil {
+		t.Fatal(err)
+	}
+	enc.WriteAux("redis-ver", "7.2.4")
+	enc.writeByte(opFunction2)
+	enc.writeString([]byte("#!lua name=lib\n"))
+	enc.WriteDBHeader(2, 6, 1)
+
+	// 过期时间之后是LFU访问频率
+	enc.writeByte(opExpireTime)
+	enc.write([]byte{0x00, 0xE1, 0xF5, 0x05}) // 100000000
+	enc.writeByte(opFreq)
+	enc.writeByte(5)
+	enc.writeByte(typeListZiplist)
+	enc.writeString([]byte("ziplist"))
+	enc.writeString(testZiplist)
+
+	enc.writeByte(opIdle)
+	enc.writeLength(1000)
+	enc.writeByte(typeHashListpack)
+	enc.writeString([]byte("hash"))
+	enc.writeString(testListpack)
+
+	enc.writeByte(typeSetIntset)
+	enc.writeString([]byte("intset"))
+	enc.writeString(testIntset)
+
+	// 版本2的quicklist包含一个listpack节点和一个单独存储的元素
+	enc.writeByte(typeListQuicklist2)
+	enc.writeString([]byte("quicklist"))
+	enc.writeLength(2)
+	enc.writeLength(quicklistNodePacked)
+	enc.writeString(testListpack)
+	enc.writeLength(quicklistNodePlain)
+	enc.writeString([]byte("plain"))
+
+	// LZF压缩的字符串
+	enc.writeByte(typeString)
+	enc.writeString([]byte("lzf"))
+	enc.writeByte(lenEncoded<<6 | encLZF)
+	enc.writeLength(6)
+	enc.writeLength(9)
+	enc.write([]byte{0x02, 'a', 'b', 'c', 0x80, 0x02})
+
+	// 旧版本的有序集合
+	enc.writeByte(typeZSet)
+	enc.writeString([]byte("zset"))
+	enc.writeLength(2)
+	enc.writeString([]byte("a"))
+	enc.write([]byte{3, '1', '.', '5'})
+	enc.writeString([]byte("b"))
+	enc.writeByte(254)
+	if err := enc.WriteEnd(); err != nil {
+		t.Fatal(err)
+	}
+
+	entries := map[string]*Entry{}
+	err := NewDecoder(&buf).Parse(func(entry *Entry) bool {
+		entries[entry.Key] = entry
+		return true
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	hash := map[string][]byte{"f1": []byte("v1"), "n": []byte("-100"), "big": []byte("100000")}
+	tests := map[string]any{
+		"ziplist":   [][]byte{[]byte("a"), []byte("12"), []byte("hello")},
+		"hash":      hash,
+		"intset":    map[string]struct{}{"1": {}, "-2": {}, "300": {}},
+		"quicklist": [][]byte{[]byte("f1"), []byte("v1"), []byte("n"), []byte("-100"), []byte("big"), []byte("100000"), []byte("plain")},
+		"lzf":       []byte("abcabcabc"),
+	}
+	for key, expected := range tests {
+		entry := entries[key]
+		if entry == nil || entry.DBIndex != 2 || !reflect.DeepEqual(entry.Value.Data, expected) {
+			t.Errorf("%s: expected %v, actually %+v", key, expected, entry)
+		}
+	}
+	if zset, ok := entries["zset"].Value.Data.(map[string]float64); !ok || zset["a"] != 1.5 || zset["b"] <= 1e308 {
+		t.Errorf("unexpected zset %v", entries["zset"].Value.Data)
+	}
+	if expiration := entries["ziplist"].Expiration; expiration == nil || !expiration.Equal(time.Unix(100000000, 0)) {
+		t.Errorf("unexpected expiration %v", expiration)
+	}
+	if entries["hash"].Expiration != nil {
+		t.Errorf("expected expiration to be reset")
+	}
+}
+
+func TestDecoderCorruptLZF(t *testing.T) {
+	for _, rawLen := range []uint64{math.MaxUint64, 1 << 40, 6*lzfMaxRatio + lzfMaxRatio} {
+		var buf bytes.Buffer
+		enc := NewEncoder(&buf)
+		enc.writeByte(lenEncoded<<6 | encLZF)
+		enc.writeLength(6)
+		enc.writeLength(rawLen)
+		enc.write([]byte{0x02, 'a', 'b', 'c', 0x80, 0x02})
+		_ = enc.w.Flush()
+
+		// 损坏的长度返回错误, 而不是预先分配内存或者panic
+		if _, err := NewDecoder(&buf).readString(); err != errLZF {
+			t.Errorf("expected errLZF for length %d, actually %v", rawLen, err)
+		}
+	}
+	// 超过预分配长度的数据在解压的过程中扩容
+	in := []byte{0x00, 'a'}
+	for i := 0; i < 300; i++ {
+		in = append(in, 0xE0, 0xFF, 0x00)
+	}
+	if out, err := lzfDecompress(in, 1+300*264); err != nil || !bytes.Equal(out, bytes.Repeat([]byte{'a'}, 1+300*264)) {
+		t.Errorf("unexpected decompression %d %v", len(out), err)
+	}
+	if _, err := lzfDecompress([]byte{0x00, 'a'}, maxPreallocLen*2); err != errLZF {
+		t.Errorf("expected errLZF for too large length, actually %v", err)
+	}
+}
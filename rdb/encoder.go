@@ -0,0 +1,215 @@
+package rdb
+
+import (
+	"bufio"
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"io"
+	"math"
+	"strconv"
+	"time"
+
+	"godis-lib/interface/db"
+)
+
+// ErrUnsupportedType 表示数据的类型无法编码为RDB格式
+var ErrUnsupportedType = errors.New("rdb: unsupported data type")
+
+// Encoder 用于将数据编码为RDB格式
+//
+// 依次调用 WriteHeader, WriteAux, WriteDBHeader, WriteEntry 和 WriteEnd:
+//
+//	REDIS0009 [AUX key value]... [SELECTDB n RESIZEDB size expires [entry]...]... EOF checksum
+//
+// 写入的数据与redis 5.0及以上的版本兼容, 集合类型使用最基础的编码, 字符串不压缩
+type Encoder struct {
+	w   *bufio.Writer
+	crc uint64 // 表示已经写入的数据的校验和
+	buf [9]byte
+	err error
+}
+
+// NewEncoder 用于创建写入w的编码器
+func NewEncoder(w io.Writer) *Encoder {
+	return &Encoder{w: bufio.NewWriter(w)}
+}
+
+// write 用于写入数据并更新校验和, 出错之后不再写入
+func (e *Encoder) write(p []byte) {
+	if e.err != nil {
+		return
+	}
+	e.crc = crc64Jones(e.crc, p)
+	_, e.err = e.w.Write(p)
+}
+
+func (e *Encoder) writeByte(b byte) {
+	e.buf[0] = b
+	e.write(e.buf[:1])
+}
+
+// writeLength 用于写入长度
+//
+//	00xxxxxx                   6位
+//	01xxxxxx xxxxxxxx          14位, 大端
+//	10000000 [4字节]            32位, 大端
+//	10000001 [8字节]            64位, 大端
+func (e *Encoder) writeLength(n uint64) {
+	switch {
+	case n < 1<<6:
+		e.writeByte(byte(n) | len6Bit<<6)
+	case n < 1<<14:
+		e.buf[0] = byte(n>>8) | len14Bit<<6
+		e.buf[1] = byte(n)
+		e.write(e.buf[:2])
+	case n <= math.MaxUint32:
+		e.buf[0] = len32Bit
+		binary.BigEndian.PutUint32(e.buf[1:], uint32(n))
+		e.write(e.buf[:5])
+	default:
+		e.buf[0] = len64Bit
+		binary.BigEndian.PutUint64(e.buf[1:], n)
+		e.write(e.buf[:9])
+	}
+}
+
+// writeString 用于写入字符串, 可以表示为32位整数的字符串以整数编码, 与redis一致
+func (e *Encoder) writeString(s []byte) {
+	if len(s) <= 11 {
+		if v, err := strconv.ParseInt(string(s), 10, 32); err == nil && strconv.FormatInt(v, 10) == string(s) {
+			e.writeInt(v)
+			return
+		}
+	}
+	e.writeLength(uint64(len(s)))
+	e.write(s)
+}
+
+// writeInt 用于以整数编码写入字符串, v 必须在int32的范围内
+func (e *Encoder) writeInt(v int64) {
+	switch {
+	case v >= math.MinInt8 && v <= math.MaxInt8:
+		e.buf[0] = lenEncoded<<6 | encInt8
+		e.buf[1] = byte(v)
+		e.write(e.buf[:2])
+	case v >= math.MinInt16 && v <= math.MaxInt16:
+		e.buf[0] = lenEncoded<<6 | encInt16
+		binary.LittleEndian.PutUint16(e.buf[1:], uint16(v))
+		e.write(e.buf[:3])
+	default:
+		e.buf[0] = lenEncoded<<6 | encInt32
+		binary.LittleEndian.PutUint32(e.buf[1:], uint32(v))
+		e.write(e.buf[:5])
+	}
+}
+
+// WriteHeader 用于写入文件头, 例如 REDIS0009
+func (e *Encoder) WriteHeader() error {
+	e.write([]byte(fmt.Sprintf("REDIS%04d", Version)))
+	return e.err
+}
+
+// WriteAux 用于写入辅助字段, 例如 redis-ver, ctime
+func (e *Encoder) WriteAux(key, value string) error {
+	e.writeByte(opAux)
+	e.writeString([]byte(key))
+	e.writeString([]byte(value))
+	return e.err
+}
+
+// WriteDBHeader 用于写入 SELECTDB 和 RESIZEDB, 之后写入的键都属于dbIndex
+//
+// size 和 expires 分别是数据库中键的个数以及设置了过期时间的键的个数, 用于加载时预先分配内存
+func (e *Encoder) WriteDBHeader(dbIndex, size, expires int) error {
+	e.writeByte(opSelectDB)
+	e.writeLength(uint64(dbIndex))
+	e.writeByte(opResizeDB)
+	e.writeLength(uint64(size))
+	e.writeLength(uint64(expires))
+	return e.err
+}
+
+// WriteEntry 用于写入一个键, expiration 为nil表示没有过期时间
+//
+// 支持的数据类型与 aof.EntityToCmds 一致:
+//
+//	[]byte, string          字符串
+//	[][]byte                列表
+//	map[string][]byte       哈希表
+//	map[string]struct{}     集合
+//	map[string]float64      有序集合
+//
+// 其他类型返回 ErrUnsupportedType, 此时不会写入任何数据
+func (e *Encoder) WriteEntry(key string, entity *db.DataEntity, expiration *time.Time) error {
+	if e.err != nil {
+		return e.err
+	}
+	var typ byte
+	switch entity.Data.(type) {
+	case []byte, string:
+		typ = typeString
+	case [][]byte:
+		typ = typeList
+	case map[string][]byte:
+		typ = typeHash
+	case map[string]struct{}:
+		typ = typeSet
+	case map[string]float64:
+		typ = typeZSet2
+	default:
+		return fmt.Errorf("%w: %T", ErrUnsupportedType, entity.Data)
+	}
+
+	if expiration != nil {
+		e.buf[0] = opExpireTimeMs
+		binary.LittleEndian.PutUint64(e.buf[1:], uint64(expiration.UnixMilli()))
+		e.write(e.buf[:9])
+	}
+	e.writeByte(typ)
+	e.writeString([]byte(key))
+
+	switch data := entity.Data.(type) {
+	case []byte:
+		e.writeString(data)
+	case string:
+		e.writeString([]byte(data))
+	case [][]byte:
+		e.writeLength(uint64(len(data)))
+		for _, value := range data {
+			e.writeString(value)
+		}
+	case map[string][]byte:
+		e.writeLength(uint64(len(data)))
+		for field, value := range data {
+			e.writeString([]byte(field))
+			e.writeString(value)
+		}
+	case map[string]struct{}:
+		e.writeLength(uint64(len(data)))
+		for member := range data {
+			e.writeString([]byte(member))
+		}
+	case map[string]float64:
+		e.writeLength(uint64(len(data)))
+		for member, score := range data {
+			e.writeString([]byte(member))
+			binary.LittleEndian.PutUint64(e.buf[:], math.Float64bits(score))
+			e.write(e.buf[:8])
+		}
+	}
+	return e.err
+}
+
+// WriteEnd 用于写入EOF和校验和, 并将缓冲区中的数据写入底层的io.Writer
+func (e *Encoder) WriteEnd() error {
+	e.writeByte(opEOF)
+	if e.err != nil {
+		return e.err
+	}
+	binary.LittleEndian.PutUint64(e.buf[:], e.crc)
+	if _, err := e.w.Write(e.buf[:8]); err != nil {
+		return err
+	}
+	return e.w.Flush()
+}
@@ -0,0 +1,59 @@
+package rdb
+
+import "errors"
+
+// errLZF 表示LZF压缩的数据已经损坏
+var errLZF = errors.New("rdb: invalid lzf compressed data")
+
+// lzfMaxRatio 是LZF的最大压缩比, 最长的反向引用用3个字节表示264个字节
+const lzfMaxRatio = 88
+
+// lzfDecompress 用于解压redis使用LZF压缩的字符串, outLen 是解压后的长度
+//
+// 压缩数据由若干段组成, 每段的第一个字节的高3位为0时表示之后有 ctrl+1 个字面量,
+// 否则表示从已经解压的数据中向前 offset 处复制 len+2 个字节
+func lzfDecompress(in []byte, outLen int) ([]byte, error) {
+	if outLen < 0 || outLen/lzfMaxRatio > len(in) {
+		return nil, errLZF
+	}
+	out := make([]byte, 0, min(outLen, maxPreallocLen)) // 解压的过程中按需扩容, 避免损坏的长度耗尽内存
+	for i := 0; i < len(in); {
+		ctrl := int(in[i])
+		i++
+		if ctrl < 1<<5 { // 字面量
+			n := ctrl + 1
+			if i+n > len(in) || len(out)+n > outLen {
+				return nil, errLZF
+			}
+			out = append(out, in[i:i+n]...)
+			i += n
+			continue
+		}
+
+		// 反向引用
+		n := ctrl >> 5
+		if n == 7 {
+			if i >= len(in) {
+				return nil, errLZF
+			}
+			n += int(in[i])
+			i++
+		}
+		if i >= len(in) {
+			return nil, errLZF
+		}
+		ref := len(out) - ((ctrl&0x1f)<<8 | int(in[i])) - 1
+		i++
+		n += 2
+		if ref < 0 || len(out)+n > outLen {
+			return nil, errLZF
+		}
+		for j := 0; j < n; j++ { // 引用的数据可能与正在写入的数据重叠, 需要逐字节复制
+			out = append(out, out[ref+j])
+		}
+	}
+	if len(out) != outLen {
+		return nil, errLZF
+	}
+	return out, nil
+}
@@ -0,0 +1,159 @@
+// Package rdb 用于读写redis的RDB快照文件, 可以与redis交换 dump.rdb 用于迁移和备份
+package rdb
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"strconv"
+	"time"
+
+	"godis-lib/aof"
+	"godis-lib/interface/db"
+	"godis-lib/lib/logger"
+	"godis-lib/lib/utils"
+	"godis-lib/resp/connection"
+	"godis-lib/resp/reply"
+)
+
+// Version 是写入的RDB文件的版本, redis 5.0及以上的版本都可以加载
+const Version = 9
+
+// maxVersion 是可以读取的RDB文件的最高版本, 对应redis 7.4
+const maxVersion = 12
+
+// 操作码
+const (
+	opSlotInfo     = 0xF4 // 集群槽的信息, redis 7.4
+	opFunction2    = 0xF5 // 函数库, redis 7.0
+	opModuleAux    = 0xF7 // 模块的辅助数据
+	opIdle         = 0xF8 // LRU空闲时间
+	opFreq         = 0xF9 // LFU访问频率
+	opAux          = 0xFA // 辅助字段
+	opResizeDB     = 0xFB // 数据库的大小
+	opExpireTimeMs = 0xFC // 毫秒级过期时间
+	opExpireTime   = 0xFD // 秒级过期时间
+	opSelectDB     = 0xFE // 选择数据库
+	opEOF          = 0xFF // 文件结束
+)
+
+// 数据类型
+const (
+	typeString         = 0
+	typeList           = 1
+	typeSet            = 2
+	typeZSet           = 3
+	typeHash           = 4
+	typeZSet2          = 5
+	typeListZiplist    = 10
+	typeSetIntset      = 11
+	typeZSetZiplist    = 12
+	typeHashZiplist    = 13
+	typeListQuicklist  = 14
+	typeHashListpack   = 16
+	typeZSetListpack   = 17
+	typeListQuicklist2 = 18
+	typeSetListpack    = 20
+)
+
+// quicklist 版本2中节点的类型
+const (
+	quicklistNodePlain  = 1 // 单独存储的较大的元素
+	quicklistNodePacked = 2 // listpack
+)
+
+// 长度编码的类型, 即第一个字节的高2位
+const (
+	len6Bit    = 0
+	len14Bit   = 1
+	len32Bit   = 0x80
+	len64Bit   = 0x81
+	lenEncoded = 3 // 表示特殊编码的字符串, 低6位是编码方式
+
+	encInt8  = 0
+	encInt16 = 1
+	encInt32 = 2
+	encLZF   = 3
+)
+
+// Dump 用于将engine中的前databases个数据库以RDB格式写入w, databases 小于等于0时为16
+//
+// 不支持的数据类型会记录日志并跳过, 与AOF重写一致
+func Dump(w io.Writer, engine db.DBEngine, databases int) error {
+	databases = utils.If(databases > 0, databases, 16)
+	enc := NewEncoder(w)
+	if err := enc.WriteHeader(); err != nil {
+		return err
+	}
+	if err := enc.WriteAux("redis-bits", "64"); err != nil {
+		return err
+	}
+	if err := enc.WriteAux("ctime", strconv.FormatInt(time.Now().Unix(), 10)); err != nil {
+		return err
+	}
+
+	for i := 0; i < databases; i++ {
+		size, expires := engine.GetDBSize(i)
+		if size == 0 {
+			continue
+		}
+		if err := enc.WriteDBHeader(i, size, expires); err != nil {
+			return err
+		}
+		var err error
+		engine.ForEach(i, func(key string, data *db.DataEntity, expiration *time.Time) bool {
+			if expiration == nil { // 部分实现在 ForEach 中不提供过期时间
+				expiration = engine.GetExpiration(i, key)
+			}
+			err = enc.WriteEntry(key, data, expiration)
+			if errors.Is(err, ErrUnsupportedType) {
+				logger.Warn("rdb dump: unsupported data type of key ", key)
+				err = nil
+			}
+			return err == nil
+		})
+		if err != nil {
+			return err
+		}
+	}
+	return enc.WriteEnd()
+}
+
+// LoadResult 表示RDB文件的加载结果
+type LoadResult struct {
+	Keys    int // 表示加载的键的个数
+	Expired int // 表示已经过期而被跳过的键的个数
+}
+
+// Load 用于读取r中的RDB文件, 将每个键转换为命令在database中执行, 已经过期的键会被跳过
+//
+// database 应该是空的数据库, 否则列表等集合类型会被追加到已有的数据中
+func Load(r io.Reader, database db.Database) (*LoadResult, error) {
+	res := &LoadResult{}
+	conn := connection.NewFakeConn()
+	now := time.Now()
+	err := NewDecoder(r).Parse(func(entry *Entry) bool {
+		if entry.Expiration != nil && entry.Expiration.Before(now) {
+			res.Expired++
+			return true
+		}
+		cmds := aof.EntityToCmds(entry.Key, entry.Value)
+		if entry.Expiration != nil {
+			cmds = append(cmds, aof.MakeExpireCmd(entry.Key, *entry.Expiration))
+		}
+		if entry.DBIndex != conn.GetDBIndex() {
+			cmds = append([]db.CmdLine{utils.ToCmdLine("SELECT", strconv.Itoa(entry.DBIndex))}, cmds...)
+		}
+		for _, cmd := range cmds {
+			if ret := database.Exec(conn, cmd); reply.IsErrReply(ret) {
+				logger.Error("exec err", utils.CmdLine2String(cmd), utils.Bytes2String(ret.Bytes()))
+			}
+		}
+		res.Keys++
+		return true
+	})
+	if err != nil {
+		return res, fmt.Errorf("rdb: load failed after %d keys: %w", res.Keys, err)
+	}
+	return res, nil
+}
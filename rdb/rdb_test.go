@@ -0,0 +1,255 @@
+package rdb
+
+import (
+	"bytes"
+	"errors"
+	"reflect"
+	"strconv"
+	"strings"
+	"testing"
+	"time"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+	"godis-lib/resp/reply"
+)
+
+// memEngine 是一个只支持加载RDB需要的命令的内存数据库
+type memEngine struct {
+	data    [16]map[string]*db.DataEntity
+	expires [16]map[string]time.Time
+	nilArgs int // 记录值为nil的参数个数, 空字符串不应该被转换为nil
+}
+
+func newMemEngine() *memEngine {
+	e := &memEngine{}
+	for i := range e.data {
+		e.data[i] = map[string]*db.DataEntity{}
+		e.expires[i] = map[string]time.Time{}
+	}
+	return e
+}
+
+func (e *memEngine) Exec(client resp.Connection, args db.CmdLine) resp.Reply {
+	for _, arg := range args {
+		if arg == nil {
+			e.nilArgs++
+		}
+	}
+	idx := client.GetDBIndex()
+	name := strings.ToUpper(string(args[0]))
+	if name == "SELECT" {
+		n, _ := strconv.Atoi(string(args[1]))
+		client.SelectDB(n)
+		return reply.NewOKReply()
+	}
+	key := string(args[1])
+	entity := e.data[idx][key]
+	switch name {
+	case "SET":
+		e.data[idx][key] = db.NewDataEntity(args[2])
+	case "RPUSH":
+		if entity == nil {
+			entity = db.NewDataEntity([][]byte{})
+		}
+		entity.Data = append(entity.Data.([][]byte), args[2:]...)
+	case "HSET":
+		if entity == nil {
+			entity = db.NewDataEntity(map[string][]byte{})
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			entity.Data.(map[string][]byte)[string(args[i])] = args[i+1]
+		}
+	case "SADD":
+		if entity == nil {
+			entity = db.NewDataEntity(map[string]struct{}{})
+		}
+		for _, member := range args[2:] {
+			entity.Data.(map[string]struct{})[string(member)] = struct{}{}
+		}
+	case "ZADD":
+		if entity == nil {
+			entity = db.NewDataEntity(map[string]float64{})
+		}
+		for i := 2; i+1 < len(args); i += 2 {
+			score, _ := strconv.ParseFloat(string(args[i]), 64)
+			entity.Data.(map[string]float64)[string(args[i+1])] = score
+		}
+	case "PEXPIREAT":
+		ms, _ := strconv.ParseInt(string(args[2]), 10, 64)
+		e.expires[idx][key] = time.UnixMilli(ms)
+		return reply.NewOKReply()
+	default:
+		return reply.NewUnknownErrReply()
+	}
+	if entity != nil {
+		e.data[idx][key] = entity
+	}
+	return reply.NewOKReply()
+}
+
+func (e *memEngine) Close() error { return nil }
+
+func (e *memEngine) AfterClientClose(resp.Connection) {}
+
+func (e *memEngine) ExecWithoutLock(conn resp.Connection, cmdLine db.CmdLine) resp.Reply {
+	return e.Exec(conn, cmdLine)
+}
+
+func (e *memEngine) ExecMulti(resp.Connection, []db.CmdLine) resp.Reply { return nil }
+
+func (e *memEngine) GetUndoLogs(int, [][]byte) []db.CmdLine { return nil }
+
+func (e *memEngine) ForEach(dbIndex int, cb func(key string, data *db.DataEntity, expiration *time.Time) bool) {
+	for key, entity := range e.data[dbIndex] {
+		if !cb(key, entity, nil) {
+			return
+		}
+	}
+}
+
+func (e *memEngine) RWLocks(int, []string, []string) {}
+
+func (e *memEngine) RWUnLocks(int, []string, []string) {}
+
+func (e *memEngine) GetDBSize(dbIndex int) (int, int) {
+	return len(e.data[dbIndex]), len(e.expires[dbIndex])
+}
+
+func (e *memEngine) GetEntity(dbIndex int, key string) (*db.DataEntity, bool) {
+	entity, ok := e.data[dbIndex][key]
+	return entity, ok
+}
+
+func (e *memEngine) GetExpiration(dbIndex int, key string) *time.Time {
+	if expireAt, ok := e.expires[dbIndex][key]; ok {
+		return &expireAt
+	}
+	return nil
+}
+
+func TestCRC64Jones(t *testing.T) {
+	if crc := crc64Jones(0, []byte("123456789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("expected 0xe9c6d914c4b8d9ca, actually %#x", crc)
+	}
+	// 分段计算的结果与一次计算一致
+	if crc := crc64Jones(crc64Jones(0, []byte("1234")), []byte("56789")); crc != 0xe9c6d914c4b8d9ca {
+		t.Errorf("expected 0xe9c6d914c4b8d9ca, actually %#x", crc)
+	}
+}
+
+func TestDumpAndLoad(t *testing.T) {
+	src := newMemEngine()
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	long := bytes.Repeat([]byte("x"), 20000)
+	src.data[0]["str"] = db.NewDataEntity([]byte("hello"))
+	src.data[0]["int"] = db.NewDataEntity([]byte("-123456"))
+	src.data[0]["long"] = db.NewDataEntity(long)
+	src.data[0]["list"] = db.NewDataEntity([][]byte{[]byte("a"), []byte("1"), []byte("")})
+	src.data[3]["hash"] = db.NewDataEntity(map[string][]byte{"f1": []byte("v1"), "f2": []byte("300")})
+	src.data[3]["set"] = db.NewDataEntity(map[string]struct{}{"a": {}, "b": {}})
+	src.data[15]["zset"] = db.NewDataEntity(map[string]float64{"m1": 1.5, "m2": -3})
+	src.expires[15]["zset"] = expireAt
+	src.data[15]["expired"] = db.NewDataEntity("gone")
+	src.expires[15]["expired"] = time.Now().Add(-time.Hour)
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, src, 16); err != nil {
+		t.Fatal(err)
+	}
+	if !bytes.HasPrefix(buf.Bytes(), []byte("REDIS0009")) {
+		t.Errorf("unexpected header %q", buf.Bytes()[:9])
+	}
+
+	dst := newMemEngine()
+	res, err := Load(bytes.NewReader(buf.Bytes()), dst)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if res.Keys != 7 || res.Expired != 1 {
+		t.Errorf("unexpected result %+v", res)
+	}
+	for i := range src.data {
+		delete(src.data[i], "expired")
+		delete(src.expires[i], "expired")
+		for key, entity := range src.data[i] {
+			expected := entity.Data
+			if s, ok := expected.(string); ok {
+				expected = []byte(s)
+			}
+			if actual, _ := dst.GetEntity(i, key); actual == nil || !reflect.DeepEqual(actual.Data, expected) {
+				t.Errorf("db %d key %s: expected %v, actually %v", i, key, expected, actual)
+			}
+		}
+	}
+	if expiration := dst.GetExpiration(15, "zset"); expiration == nil || !expiration.Equal(expireAt) {
+		t.Errorf("expected expiration %v, actually %v", expireAt, expiration)
+	}
+}
+
+func TestLoadEmptyStrings(t *testing.T) {
+	src := newMemEngine()
+	expireAt := time.Now().Add(time.Hour).Truncate(time.Millisecond)
+	src.data[0]["empty"] = db.NewDataEntity([]byte{})
+	src.data[0][""] = db.NewDataEntity([]byte("value"))
+	src.expires[0][""] = expireAt
+	src.data[1][""] = db.NewDataEntity(map[string][]byte{"": {}, "f": []byte("v")})
+	src.data[1]["list"] = db.NewDataEntity([][]byte{{}, []byte("a")})
+
+	var buf bytes.Buffer
+	if err := Dump(&buf, src, 16); err != nil {
+		t.Fatal(err)
+	}
+	dst := newMemEngine()
+	if _, err := Load(bytes.NewReader(buf.Bytes()), dst); err != nil {
+		t.Fatal(err)
+	}
+	if dst.nilArgs != 0 {
+		t.Errorf("expected no nil arguments, actually %d", dst.nilArgs)
+	}
+	for i := range src.data {
+		for key, entity := range src.data[i] {
+			if actual, _ := dst.GetEntity(i, key); actual == nil || !reflect.DeepEqual(actual.Data, entity.Data) {
+				t.Errorf("db %d key %q: expected %v, actually %v", i, key, entity.Data, actual)
+			}
+		}
+	}
+	if expiration := dst.GetExpiration(0, ""); expiration == nil || !expiration.Equal(expireAt) {
+		t.Errorf("expected expiration %v, actually %v", expireAt, expiration)
+	}
+}
+
+func TestDecoderChecksum(t *testing.T) {
+	src := newMemEngine()
+	src.data[0]["key"] = db.NewDataEntity([]byte("value"))
+	var buf bytes.Buffer
+	if err := Dump(&buf, src, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	data := buf.Bytes()
+	data[len(data)-12] ^= 0xff // 修改值中的一个字节
+	if _, err := Load(bytes.NewReader(data), newMemEngine()); !errors.Is(err, ErrChecksum) {
+		t.Errorf("expected checksum error, actually %v", err)
+	}
+
+	// 校验和为0表示没有计算校验和
+	copy(data[len(data)-8:], make([]byte, 8))
+	if _, err := Load(bytes.NewReader(data), newMemEngine()); err != nil {
+		t.Errorf("expected checksum to be skipped, actually %v", err)
+	}
+
+	if _, err := Load(bytes.NewReader(data[:len(data)-20]), newMemEngine()); err == nil {
+		t.Errorf("expected error for truncated file")
+	}
+}
+
+func TestLZFDecompress(t *testing.T) {
+	out, err := lzfDecompress([]byte{0x02, 'a', 'b', 'c', 0x80, 0x02}, 9)
+	if err != nil || string(out) != "abcabcabc" {
+		t.Errorf("expected abcabcabc, actually %q %v", out, err)
+	}
+	if _, err = lzfDecompress([]byte{0x80, 0x05}, 7); err == nil {
+		t.Errorf("expected error for invalid back reference")
+	}
+}
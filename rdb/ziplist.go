@@ -0,0 +1,222 @@
+package rdb
+
+import (
+	"encoding/binary"
+	"errors"
+	"fmt"
+	"strconv"
+)
+
+// errCorrupt 表示压缩编码的数据已经损坏
+var errCorrupt = errors.New("rdb: corrupt compact encoding")
+
+// parsePacked 用于解析ziplist或者listpack编码的元素
+func parsePacked(blob []byte, ziplist bool) ([][]byte, error) {
+	if ziplist {
+		return parseZiplist(blob)
+	}
+	return parseListpack(blob)
+}
+
+// parseZiplist 用于解析ziplist中的元素, 整数以十进制字符串返回
+//
+//	<zlbytes 4> <zltail 4> <zllen 2> <entry>... <0xFF>
+//	entry: <prevlen 1或5> <encoding> <data>
+func parseZiplist(blob []byte) ([][]byte, error) {
+	if len(blob) < 11 {
+		return nil, errCorrupt
+	}
+	count := binary.LittleEndian.Uint16(blob[8:10])
+	values := make([][]byte, 0, count)
+	pos := 10
+	for {
+		if pos >= len(blob) {
+			return nil, errCorrupt
+		}
+		if blob[pos] == 0xFF {
+			return values, nil
+		}
+		// 跳过前一个元素的长度
+		if blob[pos] == 0xFE {
+			pos += 5
+		} else {
+			pos++
+		}
+		if pos >= len(blob) {
+			return nil, errCorrupt
+		}
+
+		enc := blob[pos]
+		var value []byte
+		var err error
+		switch enc >> 6 {
+		case 0: // 00pppppp
+			value, pos, err = slice(blob, pos+1, int(enc&0x3f))
+		case 1: // 01pppppp qqqqqqqq
+			if pos+1 >= len(blob) {
+				return nil, errCorrupt
+			}
+			value, pos, err = slice(blob, pos+2, int(enc&0x3f)<<8|int(blob[pos+1]))
+		case 2: // 10000000 qqqqqqqq rrrrrrrr ssssssss tttttttt, 低6位必须为0
+			if enc != 0x80 || pos+5 > len(blob) {
+				return nil, errCorrupt
+			}
+			value, pos, err = slice(blob, pos+5, int(binary.BigEndian.Uint32(blob[pos+1:])))
+		default:
+			var n int64
+			n, pos, err = ziplistInt(blob, pos)
+			value = strconv.AppendInt(nil, n, 10)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+	}
+}
+
+// ziplistInt 用于解析ziplist中整数编码的元素, 返回整数以及下一个元素的位置
+func ziplistInt(blob []byte, pos int) (int64, int, error) {
+	enc := blob[pos]
+	pos++
+	var size int
+	switch enc {
+	case 0xC0:
+		size = 2
+	case 0xD0:
+		size = 4
+	case 0xE0:
+		size = 8
+	case 0xF0:
+		size = 3
+	case 0xFE:
+		size = 1
+	default:
+		if enc >= 0xF1 && enc <= 0xFD { // 1111xxxx, 直接表示0到12
+			return int64(enc&0x0f) - 1, pos, nil
+		}
+		return 0, 0, fmt.Errorf("rdb: unknown ziplist encoding 0x%02x", enc)
+	}
+	if pos+size > len(blob) {
+		return 0, 0, errCorrupt
+	}
+	return readIntLE(blob[pos:pos+size], size), pos + size, nil
+}
+
+// parseListpack 用于解析listpack中的元素, 整数以十进制字符串返回
+//
+//	<total-bytes 4> <num-elements 2> <element>... <0xFF>
+//	element: <encoding-type> <element-data> <element-tot-len>
+func parseListpack(blob []byte) ([][]byte, error) {
+	if len(blob) < 7 {
+		return nil, errCorrupt
+	}
+	count := binary.LittleEndian.Uint16(blob[4:6])
+	values := make([][]byte, 0, count)
+	pos := 6
+	for {
+		if pos >= len(blob) {
+			return nil, errCorrupt
+		}
+		enc := blob[pos]
+		if enc == 0xFF {
+			return values, nil
+		}
+
+		start := pos
+		var value []byte
+		var err error
+		switch {
+		case enc&0x80 == 0: // 0xxxxxxx, 7位无符号整数
+			value, pos = strconv.AppendInt(nil, int64(enc&0x7f), 10), pos+1
+		case enc&0xC0 == 0x80: // 10xxxxxx, 6位长度的字符串
+			value, pos, err = slice(blob, pos+1, int(enc&0x3f))
+		case enc&0xE0 == 0xC0: // 110xxxxx yyyyyyyy, 13位有符号整数
+			if pos+2 > len(blob) {
+				return nil, errCorrupt
+			}
+			n := int64(enc&0x1f)<<8 | int64(blob[pos+1])
+			if n >= 1<<12 {
+				n -= 1 << 13
+			}
+			value, pos = strconv.AppendInt(nil, n, 10), pos+2
+		case enc&0xF0 == 0xE0: // 1110xxxx yyyyyyyy, 12位长度的字符串
+			if pos+2 > len(blob) {
+				return nil, errCorrupt
+			}
+			value, pos, err = slice(blob, pos+2, int(enc&0x0f)<<8|int(blob[pos+1]))
+		case enc == 0xF0: // 32位长度的字符串
+			if pos+5 > len(blob) {
+				return nil, errCorrupt
+			}
+			value, pos, err = slice(blob, pos+5, int(binary.LittleEndian.Uint32(blob[pos+1:])))
+		case enc >= 0xF1 && enc <= 0xF4: // 16, 24, 32, 64位有符号整数
+			size := [...]int{2, 3, 4, 8}[enc-0xF1]
+			if pos+1+size > len(blob) {
+				return nil, errCorrupt
+			}
+			value = strconv.AppendInt(nil, readIntLE(blob[pos+1:pos+1+size], size), 10)
+			pos += 1 + size
+		default:
+			return nil, fmt.Errorf("rdb: unknown listpack encoding 0x%02x", enc)
+		}
+		if err != nil {
+			return nil, err
+		}
+		values = append(values, value)
+		pos += backlenSize(pos - start) // 跳过元素的总长度
+	}
+}
+
+// backlenSize 用于计算listpack中长度为n的元素之后记录总长度需要的字节数
+func backlenSize(n int) int {
+	switch {
+	case n <= 127:
+		return 1
+	case n < 16383:
+		return 2
+	case n < 2097151:
+		return 3
+	case n < 268435455:
+		return 4
+	}
+	return 5
+}
+
+// parseIntset 用于解析intset中的元素, 整数以十进制字符串返回
+//
+//	<encoding 4> <length 4> <contents>
+func parseIntset(blob []byte) ([][]byte, error) {
+	if len(blob) < 8 {
+		return nil, errCorrupt
+	}
+	size := int(binary.LittleEndian.Uint32(blob[0:4]))
+	count := int(binary.LittleEndian.Uint32(blob[4:8]))
+	if (size != 2 && size != 4 && size != 8) || 8+size*count != len(blob) {
+		return nil, errCorrupt
+	}
+	values := make([][]byte, 0, count)
+	for pos := 8; pos < len(blob); pos += size {
+		values = append(values, strconv.AppendInt(nil, readIntLE(blob[pos:pos+size], size), 10))
+	}
+	return values, nil
+}
+
+// slice 用于返回blob中从pos开始的n个字节的副本, 以及之后的位置
+func slice(blob []byte, pos, n int) ([]byte, int, error) {
+	if n < 0 || pos+n > len(blob) {
+		return nil, 0, errCorrupt
+	}
+	value := make([]byte, n)
+	copy(value, blob[pos:])
+	return value, pos + n, nil
+}
+
+// readIntLE 用于读取size字节的小端序有符号整数
+func readIntLE(p []byte, size int) int64 {
+	var n uint64
+	for i := size - 1; i >= 0; i-- {
+		n = n<<8 | uint64(p[i])
+	}
+	shift := 64 - 8*size // 符号扩展
+	return int64(n<<shift) >> shift
+}
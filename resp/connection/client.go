@@ -0,0 +1,212 @@
+package connection
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"time"
+
+	"godis-lib/interface/resp"
+)
+
+var _ resp.ClientInfo = (*RespConnection)(nil)
+
+// Client types used by CLIENT KILL TYPE and CLIENT LIST TYPE.
+const (
+	TypeNormal  = "normal"
+	TypeReplica = "replica"
+	TypeMaster  = "master"
+	TypePubSub  = "pubsub"
+)
+
+// defaultUser is the user of clients which are not authenticated as any user.
+const defaultUser = "default"
+
+// ParseType returns the client type named by s, "slave" is accepted as an alias of TypeReplica like redis.
+func ParseType(s string) (string, bool) {
+	switch strings.ToLower(s) {
+	case TypeNormal:
+		return TypeNormal, true
+	case TypeReplica, "slave":
+		return TypeReplica, true
+	case TypeMaster:
+		return TypeMaster, true
+	case TypePubSub:
+		return TypePubSub, true
+	}
+	return "", false
+}
+
+// ID returns the unique id of the connection.
+func (rc *RespConnection) ID() int64 {
+	return rc.id
+}
+
+// CreatedAt returns the time the connection was accepted.
+func (rc *RespConnection) CreatedAt() time.Time {
+	return rc.createdAt
+}
+
+// GetName returns the name set by CLIENT SETNAME.
+func (rc *RespConnection) GetName() string {
+	rc.infoMu.Lock()
+	defer rc.infoMu.Unlock()
+	return rc.name
+}
+
+// SetName sets the name of the connection, empty means no name.
+func (rc *RespConnection) SetName(name string) {
+	rc.infoMu.Lock()
+	defer rc.infoMu.Unlock()
+	rc.name = name
+}
+
+// SetLibName sets the name of the client library reported by CLIENT SETINFO LIB-NAME.
+func (rc *RespConnection) SetLibName(name string) {
+	rc.infoMu.Lock()
+	defer rc.infoMu.Unlock()
+	rc.libName = name
+}
+
+// SetLibVer sets the version of the client library reported by CLIENT SETINFO LIB-VER.
+func (rc *RespConnection) SetLibVer(version string) {
+	rc.infoMu.Lock()
+	defer rc.infoMu.Unlock()
+	rc.libVer = version
+}
+
+// RecordCmd records the name of the command being executed and the time of the interaction.
+func (rc *RespConnection) RecordCmd(name string) {
+	rc.infoMu.Lock()
+	defer rc.infoMu.Unlock()
+	rc.lastCmd = name
+	rc.lastTime = time.Now()
+}
+
+// LastInteraction returns the time of the last command, or the creation time if no command has been executed.
+func (rc *RespConnection) LastInteraction() time.Time {
+	rc.infoMu.Lock()
+	defer rc.infoMu.Unlock()
+	return rc.lastTime
+}
+
+// SetSlave marks the connection as a replica connected to this server.
+func (rc *RespConnection) SetSlave() {
+	rc.setFlag(flagSlave, true)
+}
+
+// IsSlave reports whether the connection is a replica connected to this server.
+func (rc *RespConnection) IsSlave() bool {
+	return rc.flags.Load()&flagSlave > 0
+}
+
+// SetMaster marks the connection as the connection to the master of this server.
+func (rc *RespConnection) SetMaster() {
+	rc.setFlag(flagMaster, true)
+}
+
+// IsMaster reports whether the connection is the connection to the master of this server.
+func (rc *RespConnection) IsMaster() bool {
+	return rc.flags.Load()&flagMaster > 0
+}
+
+// SetPubSub sets whether the connection has subscribed channels or patterns.
+func (rc *RespConnection) SetPubSub(state bool) {
+	rc.setFlag(flagPubSub, state)
+}
+
+// InPubSub reports whether the connection has subscribed channels or patterns.
+func (rc *RespConnection) InPubSub() bool {
+	return rc.flags.Load()&flagPubSub > 0
+}
+
+// CloseAfterReply reports whether the connection must be closed after the reply of the current command,
+// e.g. the client killed itself by CLIENT KILL.
+func (rc *RespConnection) CloseAfterReply() bool {
+	return rc.flags.Load()&flagCloseAfterReply > 0
+}
+
+// Type returns the type of the connection, one of TypeNormal, TypeReplica, TypeMaster and TypePubSub.
+func (rc *RespConnection) Type() string {
+	flags := rc.flags.Load()
+	switch {
+	case flags&flagSlave > 0:
+		return TypeReplica
+	case flags&flagMaster > 0:
+		return TypeMaster
+	case flags&flagPubSub > 0:
+		return TypePubSub
+	}
+	return TypeNormal
+}
+
+// LocalAddr returns the local network address, the path of the socket with port 0 for unix sockets.
+func (rc *RespConnection) LocalAddr() string {
+	addr := rc.conn.LocalAddr()
+	if addr == nil {
+		return ""
+	}
+	if strings.HasPrefix(addr.Network(), "unix") {
+		return addr.String() + ":0"
+	}
+	return addr.String()
+}
+
+// isUnix reports whether the connection is a unix socket.
+func (rc *RespConnection) isUnix() bool {
+	_, ok := rc.conn.LocalAddr().(*net.UnixAddr)
+	return ok
+}
+
+// Info returns the description of the connection in the format of CLIENT LIST, without the trailing newline:
+//
+//	id=3 addr=127.0.0.1:52555 laddr=127.0.0.1:6379 name= age=10 idle=0 flags=N omem=0 db=0 resp=2 user=default lib-name= lib-ver= cmd=client
+func (rc *RespConnection) Info() string {
+	rc.infoMu.Lock()
+	name, user, libName, libVer, lastCmd, lastTime := rc.name, rc.user, rc.libName, rc.libVer, rc.lastCmd, rc.lastTime
+	rc.infoMu.Unlock()
+	if user == "" {
+		user = defaultUser
+	}
+	if lastCmd == "" {
+		lastCmd = "NULL"
+	}
+
+	var buf strings.Builder
+	buf.WriteString("id=" + strconv.FormatInt(rc.id, 10))
+	buf.WriteString(" addr=" + rc.RemoteAddr())
+	buf.WriteString(" laddr=" + rc.LocalAddr())
+	buf.WriteString(" name=" + name)
+	buf.WriteString(" age=" + strconv.FormatInt(int64(time.Since(rc.createdAt)/time.Second), 10))
+	buf.WriteString(" idle=" + strconv.FormatInt(int64(time.Since(lastTime)/time.Second), 10))
+	buf.WriteString(" flags=" + rc.flagString())
+	buf.WriteString(" omem=" + strconv.FormatInt(rc.OutputSize(), 10))
+	buf.WriteString(" db=" + strconv.Itoa(rc.GetDBIndex()))
+	buf.WriteString(" resp=" + strconv.Itoa(rc.GetProtocol()))
+	buf.WriteString(" user=" + user)
+	buf.WriteString(" lib-name=" + libName)
+	buf.WriteString(" lib-ver=" + libVer)
+	buf.WriteString(" cmd=" + lastCmd)
+	return buf.String()
+}
+
+// flagString returns the flags of CLIENT LIST, N means no flags.
+func (rc *RespConnection) flagString() string {
+	flags := rc.flags.Load()
+	var buf []byte
+	for _, f := range []struct {
+		flag uint64
+		c    byte
+	}{{flagSlave, 'S'}, {flagMaster, 'M'}, {flagPubSub, 'P'}, {flagMulti, 'x'}, {flagCloseAfterReply, 'c'}} {
+		if flags&f.flag > 0 {
+			buf = append(buf, f.c)
+		}
+	}
+	if rc.isUnix() {
+		buf = append(buf, 'U')
+	}
+	if len(buf) == 0 {
+		return "N"
+	}
+	return string(buf)
+}
@@ -0,0 +1,187 @@
+package connection
+
+import (
+	"strconv"
+	"strings"
+	"time"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+	"godis-lib/resp/reply"
+)
+
+// ExecClient executes the CLIENT command of client, args exclude the command name. Supported subcommands:
+//
+//	CLIENT ID
+//	CLIENT INFO
+//	CLIENT LIST [TYPE normal|master|replica|pubsub] [ID id [id ...]]
+//	CLIENT KILL ip:port
+//	CLIENT KILL [ID id] [TYPE type] [USER username] [ADDR ip:port] [LADDR ip:port] [SKIPME yes|no] [MAXAGE seconds]
+//	CLIENT SETNAME name
+//	CLIENT GETNAME
+//	CLIENT SETINFO LIB-NAME|LIB-VER value
+func (r *Registry) ExecClient(client *RespConnection, args db.Params) resp.Reply {
+	if len(args) == 0 {
+		return reply.NewArgNumErrReply("client")
+	}
+	sub := strings.ToLower(string(args[0]))
+	args = args[1:]
+	switch sub {
+	case "id":
+		if len(args) != 0 {
+			return reply.NewArgNumErrReply("client|id")
+		}
+		return reply.NewIntReply(client.ID())
+	case "info":
+		if len(args) != 0 {
+			return reply.NewArgNumErrReply("client|info")
+		}
+		return reply.NewBulkReply([]byte(client.Info() + "\n"))
+	case "list":
+		return r.execList(args)
+	case "kill":
+		return r.execKill(client, args)
+	case "setname":
+		if len(args) != 1 {
+			return reply.NewArgNumErrReply("client|setname")
+		}
+		if !validInfo(args[0]) {
+			return reply.NewErrReply("Client names cannot contain spaces, newlines or special characters.")
+		}
+		client.SetName(string(args[0]))
+		return reply.NewOKReply()
+	case "getname":
+		if len(args) != 0 {
+			return reply.NewArgNumErrReply("client|getname")
+		}
+		if name := client.GetName(); name != "" {
+			return reply.NewBulkReply([]byte(name))
+		}
+		return reply.NewNullBulkReply()
+	case "setinfo":
+		if len(args) != 2 {
+			return reply.NewArgNumErrReply("client|setinfo")
+		}
+		attr := strings.ToLower(string(args[0]))
+		if attr != "lib-name" && attr != "lib-ver" {
+			return reply.NewErrReply("Unrecognized option '" + string(args[0]) + "'")
+		}
+		if !validInfo(args[1]) {
+			return reply.NewErrReply(attr + " cannot contain spaces, newlines or special characters.")
+		}
+		if attr == "lib-name" {
+			client.SetLibName(string(args[1]))
+		} else {
+			client.SetLibVer(string(args[1]))
+		}
+		return reply.NewOKReply()
+	}
+	return reply.NewErrReply("unknown subcommand '" + sub + "'. Try CLIENT HELP.")
+}
+
+// execList executes CLIENT LIST.
+func (r *Registry) execList(args db.Params) resp.Reply {
+	filter := &Filter{}
+	for i := 0; i < len(args); i++ {
+		switch strings.ToLower(string(args[i])) {
+		case "type":
+			if i+1 >= len(args) {
+				return reply.NewSyntaxErrReply()
+			}
+			i++
+			typ, ok := ParseType(string(args[i]))
+			if !ok {
+				return reply.NewErrReply("Unknown client type '" + string(args[i]) + "'")
+			}
+			filter.Type = typ
+		case "id":
+			if i+1 >= len(args) {
+				return reply.NewSyntaxErrReply()
+			}
+			for i++; i < len(args); i++ {
+				id, err := strconv.ParseInt(string(args[i]), 10, 64)
+				if err != nil || id <= 0 {
+					return reply.NewErrReply("Invalid client ID")
+				}
+				filter.IDs = append(filter.IDs, id)
+			}
+		default:
+			return reply.NewSyntaxErrReply()
+		}
+	}
+
+	var buf strings.Builder
+	for _, c := range r.List(filter) {
+		buf.WriteString(c.Info())
+		buf.WriteByte('\n')
+	}
+	return reply.NewBulkReply([]byte(buf.String()))
+}
+
+// execKill executes CLIENT KILL, the old form with a single address replies OK and the new form
+// replies the number of killed clients.
+func (r *Registry) execKill(client *RespConnection, args db.Params) resp.Reply {
+	if len(args) == 1 {
+		if r.Kill(&Filter{Addr: string(args[0])}, client) == 0 {
+			return reply.NewErrReply("No such client")
+		}
+		return reply.NewOKReply()
+	}
+	if len(args) == 0 || len(args)%2 != 0 {
+		return reply.NewSyntaxErrReply()
+	}
+
+	filter := &Filter{Skip: client}
+	for i := 0; i < len(args); i += 2 {
+		value := string(args[i+1])
+		switch strings.ToLower(string(args[i])) {
+		case "id":
+			id, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || id <= 0 {
+				return reply.NewErrReply("client-id should be greater than 0")
+			}
+			filter.IDs = append(filter.IDs, id)
+		case "type":
+			typ, ok := ParseType(value)
+			if !ok {
+				return reply.NewErrReply("Unknown client type '" + value + "'")
+			}
+			filter.Type = typ
+		case "user":
+			filter.User = value
+		case "addr":
+			filter.Addr = value
+		case "laddr":
+			filter.LAddr = value
+		case "skipme":
+			switch strings.ToLower(value) {
+			case "yes":
+				filter.Skip = client
+			case "no":
+				filter.Skip = nil
+			default:
+				return reply.NewSyntaxErrReply()
+			}
+		case "maxage":
+			age, err := strconv.ParseInt(value, 10, 64)
+			if err != nil || age <= 0 {
+				return reply.NewSyntaxErrReply()
+			}
+			filter.MaxAge = time.Duration(age) * time.Second
+		default:
+			return reply.NewSyntaxErrReply()
+		}
+	}
+	return reply.NewIntReply(int64(r.Kill(filter, client)))
+}
+
+// validInfo reports whether s can be used as the name or the library information of a client,
+// which must not contain spaces, newlines or other special characters, so that CLIENT LIST can be parsed.
+func validInfo(s []byte) bool {
+	for _, c := range s {
+		if c < '!' || c > '~' {
+			return false
+		}
+	}
+	return true
+}
@@ -2,32 +2,63 @@ package connection
 
 import (
 	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+	"godis-lib/lib/id_generator"
 	"godis-lib/lib/sync/wait"
+	"godis-lib/resp/reply"
 	"net"
+	"strings"
 	"sync"
+	"sync/atomic"
 	"time"
 )
 
 const (
-	// flagSlave means this a connection with slave, 001
+	// flagSlave means this a connection with slave, 00001
 	flagSlave = uint64(1 << iota)
-	// flagSlave means this a connection with master, 010
+	// flagSlave means this a connection with master, 00010
 	flagMaster
-	// flagMulti means this connection is within a transaction, 100
+	// flagMulti means this connection is within a transaction, 00100
 	flagMulti
+	// flagPubSub means this connection has subscribed channels or patterns, 01000
+	flagPubSub
+	// flagCloseAfterReply means this connection is closed after the reply of the current command, 10000
+	flagCloseAfterReply
 )
 
+// closeTimeout is the max time Close waits for the pending output.
+const closeTimeout = 10 * time.Second
+
+// idGenerator assigns the unique id of each connection.
+var idGenerator = id_generator.NewGenerator("client")
+
 // RespConnection is the connection to the client.
+//
+// Fields read by other clients through CLIENT LIST, e.g. flags and the selected db, are atomic or
+// guarded by infoMu, the others are only accessed by the goroutine serving the connection.
 type RespConnection struct {
-	conn         net.Conn   // the connection to the client
-	waitingReply wait.Wait  // the waiting reply
-	mu           sync.Mutex // the mutex to protect the connection
-	flags        uint64
-	selectedDB   int // the selected db index
+	conn         net.Conn     // the connection to the client
+	waitingReply wait.Wait    // the waiting reply
+	mu           sync.Mutex   // the mutex to protect the connection
+	out          *outputQueue // the asynchronous output, nil means writing synchronously
+	flags        atomic.Uint64
+	selectedDB   atomic.Int32 // the selected db index
+	protocol     atomic.Int32 // the negotiated protocol version, 0 means resp.RESP2
 
 	// password is user's password
 	password string
 
+	// client identity, see CLIENT LIST
+	id        int64
+	createdAt time.Time
+	infoMu    sync.Mutex
+	user      string    // the authenticated user, e.g. mapped from the TLS client certificate
+	name      string    // set by CLIENT SETNAME
+	libName   string    // set by CLIENT SETINFO LIB-NAME
+	libVer    string    // set by CLIENT SETINFO LIB-VER
+	lastCmd   string    // the name of the last command
+	lastTime  time.Time // the time of the last command
+
 	// implement transaction
 	queue             []db.CmdLine      // 事务命令的执行队列
 	watching          map[string]uint32 // 一个事务执行过程中的有关的键与对应的版本号
@@ -39,7 +70,7 @@ func (rc *RespConnection) GetPassword() string {
 }
 
 func (rc *RespConnection) InMultiState() bool {
-	return rc.flags&flagMulti > 0
+	return rc.flags.Load()&flagMulti > 0
 }
 
 func (rc *RespConnection) GetQueuedCmdLine() []db.CmdLine {
@@ -50,6 +81,20 @@ func (rc *RespConnection) SetPassword(password string) {
 	rc.password = password
 }
 
+// GetUser returns the authenticated user, empty means the default user.
+func (rc *RespConnection) GetUser() string {
+	rc.infoMu.Lock()
+	defer rc.infoMu.Unlock()
+	return rc.user
+}
+
+// SetUser sets the authenticated user.
+func (rc *RespConnection) SetUser(user string) {
+	rc.infoMu.Lock()
+	defer rc.infoMu.Unlock()
+	rc.user = user
+}
+
 // SetMultiState 设置此链接正在执行事务的标志
 //
 // 如果设置为false, 则会清空watching, queue
@@ -57,10 +102,10 @@ func (rc *RespConnection) SetMultiState(state bool) {
 	if !state { // reset data when cancel multi
 		rc.watching = nil
 		rc.queue = nil
-		rc.flags &= ^flagMulti // clean multi flag
+		rc.setFlag(flagMulti, false) // clean multi flag
 		return
 	}
-	rc.flags |= flagMulti
+	rc.setFlag(flagMulti, true)
 }
 
 func (rc *RespConnection) ClearWatching() {
@@ -87,13 +132,43 @@ func (rc *RespConnection) ClearQueuedCmds() {
 	rc.queue = nil
 }
 
+// setFlag sets or clears the flag atomically.
+func (rc *RespConnection) setFlag(flag uint64, on bool) {
+	for {
+		old := rc.flags.Load()
+		flags := old &^ flag
+		if on {
+			flags |= flag
+		}
+		if rc.flags.CompareAndSwap(old, flags) {
+			return
+		}
+	}
+}
+
+// NewRespConnection wraps conn with a new unique id.
 func NewRespConnection(conn net.Conn) *RespConnection {
-	return &RespConnection{conn: conn}
+	now := time.Now()
+	return &RespConnection{conn: conn, id: idGenerator.NextID(), createdAt: now, lastTime: now}
 }
 
 // RemoteAddr returns the remote network address.
+//
+// Peers of unix sockets are usually unnamed, so like redis the path of the socket
+// with port 0 is returned instead, e.g. /tmp/redis.sock:0.
 func (rc *RespConnection) RemoteAddr() string {
-	return rc.conn.RemoteAddr().String()
+	addr := rc.conn.RemoteAddr()
+	if addr == nil || !strings.HasPrefix(addr.Network(), "unix") {
+		if addr == nil {
+			return ""
+		}
+		return addr.String()
+	}
+	name := addr.String()
+	if name == "" || name == "@" {
+		name = rc.conn.LocalAddr().String()
+	}
+	return name + ":0"
 }
 
 // Watching returns watching keys and their version code when started watching
@@ -104,9 +179,13 @@ func (rc *RespConnection) GetWatching() map[string]uint32 {
 	return rc.watching
 }
 
-// Close closes the connection.
+// Close closes the connection after the pending output is written, waiting at most closeTimeout.
 func (rc *RespConnection) Close() error {
-	rc.waitingReply.WaitWithTimeout(10 * time.Second)
+	if rc.out != nil {
+		rc.closeQueue(closeTimeout)
+	} else {
+		rc.waitingReply.WaitWithTimeout(closeTimeout)
+	}
 	_ = rc.conn.Close()
 	return nil
 }
@@ -115,11 +194,17 @@ func (rc *RespConnection) Close() error {
 //
 // If len(p) == 0, Write returns 0, nil without writing anything.
 //
-// Mutex is used to protect the connection.
+// Mutex is used to protect the connection. After StartOutputQueue a copy of p is queued instead.
 func (rc *RespConnection) Write(p []byte) (n int, err error) {
 	if len(p) == 0 {
 		return 0, nil
 	}
+	if rc.out != nil {
+		if err := rc.enqueue(copyOutput(p)); err != nil {
+			return 0, err
+		}
+		return len(p), nil
+	}
 
 	rc.mu.Lock()
 	rc.waitingReply.Add(1)
@@ -131,12 +216,45 @@ func (rc *RespConnection) Write(p []byte) (n int, err error) {
 	return rc.conn.Write(p)
 }
 
+// WriteReply encodes the reply with the negotiated protocol and writes it to the connection.
+//
+// The reply is encoded into a pooled buffer and large bulk strings are written directly,
+// so big array replies are not copied into an intermediate []byte.
+// After StartOutputQueue the encoded reply is queued instead.
+func (rc *RespConnection) WriteReply(r resp.Reply) error {
+	if rc.out != nil {
+		return rc.enqueue(encodeReply(r, rc.GetProtocol()))
+	}
+	rc.mu.Lock()
+	rc.waitingReply.Add(1)
+	defer func() {
+		rc.waitingReply.Done()
+		rc.mu.Unlock()
+	}()
+
+	_, err := reply.WriteTo(rc.conn, r, rc.GetProtocol())
+	return err
+}
+
 // GetDBIndex returns the selected db index.
 func (rc *RespConnection) GetDBIndex() int {
-	return rc.selectedDB
+	return int(rc.selectedDB.Load())
 }
 
 // SelectDB selects the db by the given index.
 func (rc *RespConnection) SelectDB(dbIndex int) {
-	rc.selectedDB = dbIndex
+	rc.selectedDB.Store(int32(dbIndex))
+}
+
+// GetProtocol returns the negotiated protocol version, resp.RESP2 by default.
+func (rc *RespConnection) GetProtocol() int {
+	if protocol := rc.protocol.Load(); protocol != 0 {
+		return int(protocol)
+	}
+	return resp.RESP2
+}
+
+// SetProtocol sets the protocol version negotiated by HELLO.
+func (rc *RespConnection) SetProtocol(protocol int) {
+	rc.protocol.Store(int32(protocol))
 }
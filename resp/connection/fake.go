@@ -2,7 +2,9 @@ package connection
 
 import (
 	"fmt"
+	"godis-lib/interface/resp"
 	"godis-lib/lib/logger"
+	"godis-lib/resp/reply"
 	"io"
 	"sync"
 )
@@ -34,6 +36,12 @@ func (c *FakeConn) Write(b []byte) (int, error) {
 	return len(b), nil
 }
 
+// WriteReply encodes the reply with the negotiated protocol and writes it to buffer
+func (c *FakeConn) WriteReply(r resp.Reply) error {
+	_, err := reply.WriteTo(c, r, c.GetProtocol())
+	return err
+}
+
 func (c *FakeConn) notify() {
 	if c.waitOn != nil {
 		c.mu.Lock()
@@ -0,0 +1,296 @@
+package connection
+
+import (
+	"errors"
+	"fmt"
+	"net"
+	"strconv"
+	"strings"
+	"sync"
+	"time"
+
+	"godis-lib/interface/resp"
+	"godis-lib/lib/logger"
+	"godis-lib/resp/reply"
+)
+
+// ErrOutputLimit is returned by Write and WriteReply after the client is disconnected
+// because its pending output exceeded the limit of its class.
+var ErrOutputLimit = errors.New("client output buffer limit exceeded")
+
+// OutputLimit limits the output queued for a client and not yet read by it, like client-output-buffer-limit of redis.
+//
+// The client is disconnected when the pending output reaches Hard bytes, or stays at or above Soft bytes
+// for longer than SoftTime. Zero Hard or Soft means no such limit.
+type OutputLimit struct {
+	Hard     int64
+	Soft     int64
+	SoftTime time.Duration
+}
+
+// OutputLimits holds the limits of the client classes, master clients use the normal class.
+type OutputLimits struct {
+	Normal  OutputLimit
+	Replica OutputLimit
+	PubSub  OutputLimit
+}
+
+// DefaultOutputLimits returns the default limits of redis:
+//
+//	client-output-buffer-limit normal 0 0 0 replica 256mb 64mb 60 pubsub 32mb 8mb 60
+func DefaultOutputLimits() *OutputLimits {
+	return &OutputLimits{
+		Replica: OutputLimit{Hard: 256 << 20, Soft: 64 << 20, SoftTime: 60 * time.Second},
+		PubSub:  OutputLimit{Hard: 32 << 20, Soft: 8 << 20, SoftTime: 60 * time.Second},
+	}
+}
+
+// ParseOutputLimits parses the value of client-output-buffer-limit, e.g. "pubsub 32mb 8mb 60",
+// classes not in s keep the default limits.
+func ParseOutputLimits(s string) (*OutputLimits, error) {
+	limits := DefaultOutputLimits()
+	fields := strings.Fields(s)
+	if len(fields)%4 != 0 {
+		return nil, errors.New("wrong number of arguments in client-output-buffer-limit")
+	}
+	for i := 0; i < len(fields); i += 4 {
+		typ, ok := ParseType(fields[i])
+		if !ok || typ == TypeMaster {
+			return nil, fmt.Errorf("invalid client class '%s'", fields[i])
+		}
+		hard, err := parseMemory(fields[i+1])
+		if err != nil {
+			return nil, err
+		}
+		soft, err := parseMemory(fields[i+2])
+		if err != nil {
+			return nil, err
+		}
+		seconds, err := strconv.ParseInt(fields[i+3], 10, 64)
+		if err != nil || seconds < 0 {
+			return nil, fmt.Errorf("invalid soft seconds '%s'", fields[i+3])
+		}
+		*limits.class(typ) = OutputLimit{Hard: hard, Soft: soft, SoftTime: time.Duration(seconds) * time.Second}
+	}
+	return limits, nil
+}
+
+// class returns the limit of the client type.
+func (l *OutputLimits) class(typ string) *OutputLimit {
+	switch typ {
+	case TypeReplica:
+		return &l.Replica
+	case TypePubSub:
+		return &l.PubSub
+	}
+	return &l.Normal
+}
+
+// parseMemory parses memory sizes such as 1024, 1k, 1kb, 32mb or 1gb, units with b are powers of 1024.
+func parseMemory(s string) (int64, error) {
+	lower := strings.ToLower(s)
+	unit := int64(1)
+	for _, u := range []struct {
+		suffix string
+		n      int64
+	}{{"kb", 1 << 10}, {"mb", 1 << 20}, {"gb", 1 << 30}, {"k", 1000}, {"m", 1000 * 1000}, {"g", 1000 * 1000 * 1000}, {"b", 1}} {
+		if strings.HasSuffix(lower, u.suffix) {
+			lower, unit = strings.TrimSuffix(lower, u.suffix), u.n
+			break
+		}
+	}
+	n, err := strconv.ParseInt(lower, 10, 64)
+	if err != nil || n < 0 {
+		return 0, fmt.Errorf("invalid memory size '%s'", s)
+	}
+	return n * unit, nil
+}
+
+// maxPooledOutput is the max capacity of the output buffers put back into outputPool,
+// larger buffers are left to the garbage collector.
+const maxPooledOutput = 64 << 10
+
+// outputPool reuses the buffers holding the queued output, a buffer is put back
+// after the writer goroutine writes it to the connection.
+var outputPool = sync.Pool{
+	New: func() any {
+		buf := make([]byte, 0, 512)
+		return &buf
+	},
+}
+
+func acquireOutput() *[]byte {
+	return outputPool.Get().(*[]byte)
+}
+
+func releaseOutput(buf *[]byte) {
+	if cap(*buf) > maxPooledOutput {
+		return
+	}
+	*buf = (*buf)[:0]
+	outputPool.Put(buf)
+}
+
+// outputQueue holds the output of a client until the writer goroutine writes it to the connection,
+// so that writers never block on slow clients.
+type outputQueue struct {
+	mu        sync.Mutex
+	cond      sync.Cond
+	pending   []*[]byte // buffers from outputPool
+	size      int64     // the bytes queued and not yet written
+	softSince time.Time // when the size reached the soft limit, zero means below the soft limit
+	err       error     // the write error or ErrOutputLimit, the queue accepts no more output once set
+	closing   bool
+	done      chan struct{} // closed when the writer goroutine exits
+	limits    *OutputLimits
+}
+
+// StartOutputQueue makes writes of the connection asynchronous: Write and WriteReply queue the output
+// and return immediately, a dedicated goroutine writes the queued output in order.
+// The client is disconnected when the pending output exceeds the limit of its class in limits.
+//
+// It must be called at most once, before anything is written.
+func (rc *RespConnection) StartOutputQueue(limits *OutputLimits) {
+	q := &outputQueue{done: make(chan struct{}), limits: limits}
+	q.cond.L = &q.mu
+	rc.out = q
+	go rc.writeLoop()
+}
+
+// OutputSize returns the bytes queued for the client and not yet written.
+func (rc *RespConnection) OutputSize() int64 {
+	if rc.out == nil {
+		return 0
+	}
+	rc.out.mu.Lock()
+	defer rc.out.mu.Unlock()
+	return rc.out.size
+}
+
+// enqueue queues buf for the writer goroutine and checks the output limit.
+// The queue owns buf afterwards, it is released even if enqueue fails.
+func (rc *RespConnection) enqueue(buf *[]byte) error {
+	q := rc.out
+	q.mu.Lock()
+	defer q.mu.Unlock()
+	if q.err != nil {
+		releaseOutput(buf)
+		return q.err
+	}
+	if q.closing {
+		releaseOutput(buf)
+		return net.ErrClosed
+	}
+	q.pending = append(q.pending, buf)
+	q.size += int64(len(*buf))
+	if rc.overLimit(time.Now()) {
+		logger.Warn(fmt.Sprintf("client id=%d addr=%s closed for overcoming of output buffer limits, pending %d bytes",
+			rc.id, rc.RemoteAddr(), q.size))
+		q.err = ErrOutputLimit
+		q.pending = nil
+		_ = rc.conn.Close() // unblocks the writer goroutine
+		return q.err
+	}
+	q.cond.Signal()
+	return nil
+}
+
+// overLimit reports whether the pending output exceeds the limit of the client class, q.mu must be held.
+func (rc *RespConnection) overLimit(now time.Time) bool {
+	q := rc.out
+	if q.limits == nil {
+		return false
+	}
+	limit := q.limits.class(rc.Type())
+	if limit.Hard > 0 && q.size >= limit.Hard {
+		return true
+	}
+	if limit.Soft > 0 && q.size >= limit.Soft {
+		if q.softSince.IsZero() {
+			q.softSince = now
+			return false
+		}
+		return now.Sub(q.softSince) > limit.SoftTime
+	}
+	q.softSince = time.Time{}
+	return false
+}
+
+// writeLoop writes the queued output in batches until the connection is closed or fails.
+func (rc *RespConnection) writeLoop() {
+	q := rc.out
+	defer close(q.done)
+	var (
+		batch []*[]byte
+		bufs  net.Buffers
+	)
+	for {
+		q.mu.Lock()
+		for len(q.pending) == 0 && !q.closing && q.err == nil {
+			q.cond.Wait()
+		}
+		if q.err != nil || len(q.pending) == 0 {
+			q.mu.Unlock()
+			return
+		}
+		// swap the slices so that neither of them is allocated again in the steady state
+		batch, q.pending = q.pending, batch[:0]
+		q.mu.Unlock()
+
+		bufs = bufs[:0]
+		for _, buf := range batch {
+			bufs = append(bufs, *buf)
+		}
+		// WriteTo consumes bufs, keep the full slice to reuse its backing array
+		all := bufs
+		n, err := bufs.WriteTo(rc.conn)
+		bufs = all
+		clear(bufs)
+		for i, buf := range batch {
+			releaseOutput(buf)
+			batch[i] = nil
+		}
+
+		q.mu.Lock()
+		q.size -= n
+		if q.limits != nil && q.size < q.limits.class(rc.Type()).Soft {
+			q.softSince = time.Time{}
+		}
+		if err != nil && q.err == nil {
+			q.err = err
+			q.pending = nil
+		}
+		q.mu.Unlock()
+		if err != nil {
+			_ = rc.conn.Close()
+			return
+		}
+	}
+}
+
+// closeQueue stops accepting output and waits for the queued output to be written.
+func (rc *RespConnection) closeQueue(timeout time.Duration) {
+	q := rc.out
+	q.mu.Lock()
+	q.closing = true
+	q.cond.Signal()
+	q.mu.Unlock()
+	select {
+	case <-q.done:
+	case <-time.After(timeout):
+	}
+}
+
+// encodeReply encodes the reply with the protocol into a pooled buffer which can be queued.
+func encodeReply(r resp.Reply, protocol int) *[]byte {
+	buf := acquireOutput()
+	*buf = reply.AppendTo(*buf, r, protocol)
+	return buf
+}
+
+// copyOutput copies p into a pooled buffer which can be queued.
+func copyOutput(p []byte) *[]byte {
+	buf := acquireOutput()
+	*buf = append(*buf, p...)
+	return buf
+}
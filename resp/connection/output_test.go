@@ -0,0 +1,144 @@
+package connection
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"net"
+	"testing"
+	"time"
+
+	"godis-lib/interface/resp"
+	"godis-lib/resp/reply"
+)
+
+func TestOutputQueue(t *testing.T) {
+	server, peer := net.Pipe()
+	defer peer.Close()
+	client := NewRespConnection(server)
+	client.StartOutputQueue(DefaultOutputLimits())
+
+	// writes do not wait for the client to read, and keep their order
+	for i := 0; i < 100; i++ {
+		if err := client.WriteReply(reply.NewIntReply(int64(i))); err != nil {
+			t.Fatal(err)
+		}
+	}
+	_, _ = client.Write([]byte("+done\r\n"))
+	var expected bytes.Buffer
+	for i := 0; i < 100; i++ {
+		expected.Write(reply.NewIntReply(int64(i)).Bytes())
+	}
+	expected.WriteString("+done\r\n")
+	go func() { _ = client.Close() }() // Close writes the pending output first
+	actual, _ := io.ReadAll(peer)
+	if !bytes.Equal(actual, expected.Bytes()) {
+		t.Errorf("unexpected output %q", actual)
+	}
+}
+
+func TestOutputHardLimit(t *testing.T) {
+	server, peer := net.Pipe()
+	defer peer.Close()
+	client := NewRespConnection(server)
+	client.StartOutputQueue(&OutputLimits{PubSub: OutputLimit{Hard: 1024}})
+	client.SetPubSub(true)
+
+	// the client never reads and is disconnected after exceeding the hard limit
+	msg := reply.NewBulkReply(bytes.Repeat([]byte{'a'}, 100))
+	var err error
+	for i := 0; i < 100 && err == nil; i++ {
+		err = client.WriteReply(msg)
+	}
+	if !errors.Is(err, ErrOutputLimit) {
+		t.Fatalf("expected ErrOutputLimit, actually %v", err)
+	}
+	if _, err = client.Write([]byte("+OK\r\n")); !errors.Is(err, ErrOutputLimit) {
+		t.Errorf("expected ErrOutputLimit after disconnection, actually %v", err)
+	}
+	_ = peer.SetReadDeadline(time.Now().Add(5 * time.Second))
+	if _, err = io.ReadAll(peer); err != nil {
+		t.Errorf("expected connection to be closed, actually %v", err)
+	}
+
+	// normal clients have no limit
+	server, peer = net.Pipe()
+	defer peer.Close()
+	client = NewRespConnection(server)
+	client.StartOutputQueue(&OutputLimits{PubSub: OutputLimit{Hard: 1024}})
+	for i := 0; i < 100; i++ {
+		if err = client.WriteReply(msg); err != nil {
+			t.Fatal(err)
+		}
+	}
+	if size := client.OutputSize(); size < 1024 {
+		t.Errorf("expected pending output, actually %d", size)
+	}
+}
+
+func TestOutputSoftLimit(t *testing.T) {
+	server, peer := net.Pipe()
+	defer peer.Close()
+	client := NewRespConnection(server)
+	client.StartOutputQueue(&OutputLimits{Normal: OutputLimit{Soft: 100, SoftTime: 50 * time.Millisecond}})
+
+	msg := []byte("+" + string(bytes.Repeat([]byte{'a'}, 100)) + "\r\n")
+	if _, err := client.Write(msg); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := client.Write(msg); err != nil {
+		t.Errorf("expected soft limit to be tolerated, actually %v", err)
+	}
+	time.Sleep(60 * time.Millisecond)
+	if _, err := client.Write(msg); !errors.Is(err, ErrOutputLimit) {
+		t.Errorf("expected ErrOutputLimit after soft time, actually %v", err)
+	}
+}
+
+func TestParseOutputLimits(t *testing.T) {
+	limits, err := ParseOutputLimits("normal 1kb 1k 0 slave 1mb 512mb 10")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if limits.Normal != (OutputLimit{Hard: 1024, Soft: 1000}) {
+		t.Errorf("unexpected normal limit %+v", limits.Normal)
+	}
+	if limits.Replica != (OutputLimit{Hard: 1 << 20, Soft: 512 << 20, SoftTime: 10 * time.Second}) {
+		t.Errorf("unexpected replica limit %+v", limits.Replica)
+	}
+	if limits.PubSub != DefaultOutputLimits().PubSub {
+		t.Errorf("expected default pubsub limit, actually %+v", limits.PubSub)
+	}
+	for _, s := range []string{"normal 0 0", "master 0 0 0", "pubsub 1x 0 0", "pubsub 0 0 -1"} {
+		if _, err = ParseOutputLimits(s); err == nil {
+			t.Errorf("expected error for %q", s)
+		}
+	}
+}
+
+// discardConn is a net.Conn which discards everything written to it.
+type discardConn struct {
+	net.Conn
+}
+
+func (discardConn) Write(p []byte) (int, error) {
+	return len(p), nil
+}
+
+func BenchmarkOutputQueue(b *testing.B) {
+	server, peer := net.Pipe()
+	defer peer.Close()
+	client := NewRespConnection(discardConn{server})
+	client.StartOutputQueue(DefaultOutputLimits())
+	replies := []resp.Reply{reply.NewOKReply(), reply.NewIntReply(100), reply.NewBulkReply(bytes.Repeat([]byte{'a'}, 1024))}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		for _, r := range replies {
+			if err := client.WriteReply(r); err != nil {
+				b.Fatal(err)
+			}
+		}
+	}
+	b.StopTimer()
+	_ = client.Close()
+}
@@ -0,0 +1,120 @@
+package connection
+
+import (
+	"slices"
+	"sync"
+	"time"
+)
+
+// Registry tracks the connected clients by id, so that they can be listed and killed by CLIENT LIST and CLIENT KILL.
+//
+// Registry is safe for concurrent use.
+type Registry struct {
+	mu      sync.RWMutex
+	clients map[int64]*RespConnection
+}
+
+// NewRegistry creates an empty Registry.
+func NewRegistry() *Registry {
+	return &Registry{clients: make(map[int64]*RespConnection)}
+}
+
+// Add registers the client.
+func (r *Registry) Add(client *RespConnection) {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	r.clients[client.ID()] = client
+}
+
+// Remove unregisters the client, it reports whether the client was registered.
+func (r *Registry) Remove(client *RespConnection) bool {
+	r.mu.Lock()
+	defer r.mu.Unlock()
+	if r.clients[client.ID()] != client {
+		return false
+	}
+	delete(r.clients, client.ID())
+	return true
+}
+
+// Get returns the client with the id.
+func (r *Registry) Get(id int64) (*RespConnection, bool) {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	client, ok := r.clients[id]
+	return client, ok
+}
+
+// Len returns the number of registered clients.
+func (r *Registry) Len() int {
+	r.mu.RLock()
+	defer r.mu.RUnlock()
+	return len(r.clients)
+}
+
+// List returns the clients matching the filter ordered by id, nil filter matches all the clients.
+func (r *Registry) List(filter *Filter) []*RespConnection {
+	r.mu.RLock()
+	clients := make([]*RespConnection, 0, len(r.clients))
+	for _, client := range r.clients {
+		if filter.Match(client) {
+			clients = append(clients, client)
+		}
+	}
+	r.mu.RUnlock()
+	slices.SortFunc(clients, func(a, b *RespConnection) int {
+		return int(min(max(a.ID()-b.ID(), -1), 1))
+	})
+	return clients
+}
+
+// Kill closes the clients matching the filter and returns the number of them.
+//
+// caller is the client executing CLIENT KILL, it is closed after the reply instead of immediately if matched.
+// Other clients are closed without waiting for their pending replies, the goroutines serving them
+// notice the closed connections and unregister them.
+func (r *Registry) Kill(filter *Filter, caller *RespConnection) int {
+	clients := r.List(filter)
+	for _, client := range clients {
+		if client == caller {
+			client.setFlag(flagCloseAfterReply, true)
+			continue
+		}
+		_ = client.conn.Close()
+	}
+	return len(clients)
+}
+
+// Filter selects clients by the options of CLIENT KILL and CLIENT LIST, zero fields match all the clients.
+type Filter struct {
+	IDs    []int64         // matches any of the ids
+	Type   string          // one of TypeNormal, TypeReplica, TypeMaster and TypePubSub
+	Addr   string          // the remote address, see RespConnection.RemoteAddr
+	LAddr  string          // the local address, see RespConnection.LocalAddr
+	User   string          // the authenticated user, "default" matches clients without user
+	MaxAge time.Duration   // matches clients connected longer than MaxAge
+	Skip   *RespConnection // never matches, used by CLIENT KILL SKIPME yes
+}
+
+// Match reports whether the client matches all the conditions of f.
+func (f *Filter) Match(client *RespConnection) bool {
+	if f == nil {
+		return true
+	}
+	if client == f.Skip ||
+		len(f.IDs) > 0 && !slices.Contains(f.IDs, client.ID()) ||
+		f.Type != "" && client.Type() != f.Type ||
+		f.Addr != "" && client.RemoteAddr() != f.Addr ||
+		f.LAddr != "" && client.LocalAddr() != f.LAddr ||
+		f.MaxAge > 0 && time.Since(client.CreatedAt()) <= f.MaxAge {
+		return false
+	}
+	if f.User != "" {
+		user := client.GetUser()
+		if user == "" {
+			user = defaultUser
+		}
+		return user == f.User
+	}
+	return true
+}
@@ -0,0 +1,101 @@
+package connection
+
+import (
+	"net"
+	"strconv"
+	"strings"
+	"testing"
+
+	"godis-lib/resp/reply"
+)
+
+func newTestClient(t *testing.T, registry *Registry) (*RespConnection, net.Conn) {
+	server, peer := net.Pipe()
+	t.Cleanup(func() {
+		_ = server.Close()
+		_ = peer.Close()
+	})
+	client := NewRespConnection(server)
+	registry.Add(client)
+	return client, peer
+}
+
+func execClient(registry *Registry, client *RespConnection, args ...string) string {
+	params := make([][]byte, len(args))
+	for i, arg := range args {
+		params[i] = []byte(arg)
+	}
+	return string(registry.ExecClient(client, params).Bytes())
+}
+
+func TestRegistry(t *testing.T) {
+	registry := NewRegistry()
+	a, _ := newTestClient(t, registry)
+	b, peer := newTestClient(t, registry)
+	b.SetPubSub(true)
+	if a.ID() == b.ID() || registry.Len() != 2 {
+		t.Fatalf("unexpected ids %d %d", a.ID(), b.ID())
+	}
+
+	if actual := execClient(registry, a, "ID"); actual != ":"+strconv.FormatInt(a.ID(), 10)+"\r\n" {
+		t.Errorf("unexpected CLIENT ID %q", actual)
+	}
+	if actual := execClient(registry, a, "SETNAME", "bad name"); !strings.HasPrefix(actual, "-ERR Client names cannot") {
+		t.Errorf("expected invalid name, actually %q", actual)
+	}
+	if actual := execClient(registry, a, "SETNAME", "worker"); actual != "+OK\r\n" {
+		t.Errorf("unexpected CLIENT SETNAME %q", actual)
+	}
+	if actual := execClient(registry, a, "GETNAME"); actual != "$6\r\nworker\r\n" {
+		t.Errorf("unexpected CLIENT GETNAME %q", actual)
+	}
+	_ = execClient(registry, a, "SETINFO", "LIB-NAME", "go-redis")
+	a.SelectDB(2)
+	a.RecordCmd("client")
+	info := a.Info()
+	for _, field := range []string{"id=" + strconv.FormatInt(a.ID(), 10) + " ", " name=worker ", " flags=N ", " db=2 ", " user=default ", " lib-name=go-redis ", " cmd=client"} {
+		if !strings.Contains(info, field) {
+			t.Errorf("expected %q in %q", field, info)
+		}
+	}
+	if flags := b.flagString(); flags != "P" {
+		t.Errorf("expected flags P, actually %s", flags)
+	}
+
+	// filter by type
+	list := execClient(registry, a, "LIST", "TYPE", "pubsub")
+	if !strings.Contains(list, "id="+strconv.FormatInt(b.ID(), 10)+" ") || strings.Count(list, "\n") != 3 { // including the newline of the bulk header
+		t.Errorf("unexpected CLIENT LIST %q", list)
+	}
+	if actual := execClient(registry, a, "LIST", "TYPE", "foo"); !strings.HasPrefix(actual, "-ERR Unknown client type") {
+		t.Errorf("expected unknown type, actually %q", actual)
+	}
+	if clients := registry.List(&Filter{IDs: []int64{b.ID(), a.ID()}}); len(clients) != 2 || clients[0].ID() > clients[1].ID() {
+		t.Errorf("expected clients ordered by id")
+	}
+
+	// the caller is skipped by default
+	if actual := execClient(registry, a, "KILL", "USER", "default"); actual != ":1\r\n" {
+		t.Errorf("unexpected CLIENT KILL %q", actual)
+	}
+	if _, err := peer.Write([]byte("x")); err == nil {
+		t.Errorf("expected killed connection to be closed")
+	}
+	if !registry.Remove(b) || registry.Remove(b) {
+		t.Errorf("expected client to be removed once")
+	}
+
+	// a client killing itself is closed after the reply
+	if actual := execClient(registry, a, "KILL", "ID", strconv.FormatInt(a.ID(), 10), "SKIPME", "no"); actual != ":1\r\n" {
+		t.Errorf("unexpected CLIENT KILL %q", actual)
+	}
+	if !a.CloseAfterReply() {
+		t.Errorf("expected close after reply")
+	}
+	if actual := execClient(registry, a, "KILL", "127.0.0.1:1"); actual != "-ERR No such client\r\n" {
+		t.Errorf("unexpected CLIENT KILL %q", actual)
+	}
+	if actual := execClient(registry, a, "FOO"); actual != string(reply.NewErrReply("unknown subcommand 'foo'. Try CLIENT HELP.").Bytes()) {
+		t.Errorf("unexpected reply %q", actual)
+	}
+}
@@ -0,0 +1,240 @@
+package handler
+
+import (
+	"context"
+	"crypto/tls"
+	"crypto/x509"
+	"errors"
+	"fmt"
+	"net"
+	"runtime/debug"
+	"strings"
+	"sync"
+	"time"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+	"godis-lib/lib/logger"
+	"godis-lib/lib/sync/wait"
+	"godis-lib/lib/utils"
+	"godis-lib/resp/connection"
+	"godis-lib/resp/parser"
+	"godis-lib/resp/reply"
+)
+
+// handshakeTimeout is the max time a TLS client may take to complete the handshake.
+const handshakeTimeout = 10 * time.Second
+
+// closeTimeout is the max time Close waits for the connections to be released before closing the database,
+// it is a variable for tests.
+var closeTimeout = 10 * time.Second
+
+// errNotMultiBulk is replied to frames which are not commands, e.g. +OK\r\n.
+var errNotMultiBulk = reply.NewProtocolErrReply("expected multibulk")
+
+// CertUserFunc maps the verified certificate of a TLS client to a user, empty means the default user.
+type CertUserFunc func(cert *x509.Certificate) string
+
+// CommonNameUser is the default CertUserFunc, which uses the common name of the certificate subject as the user.
+func CommonNameUser(cert *x509.Certificate) string {
+	return cert.Subject.CommonName
+}
+
+// RespHandler implements tcp.Handler and serves redis protocol clients with a db.Database.
+//
+// Each connection is wrapped in a connection.RespConnection, commands are parsed with parser.ParseStreamContext,
+// executed by db.Database.Exec and the replies are encoded with the protocol negotiated by the connection.
+//
+// The CLIENT command is executed by the handler with the client registry instead of the database.
+// Replies are written by a goroutine of each connection, clients which do not read them fast enough
+// are disconnected according to the output limits, see SetOutputLimits.
+type RespHandler struct {
+	clients      *connection.Registry
+	handling     wait.Wait
+	db           db.Database
+	opts         *parser.Options
+	certUser     CertUserFunc
+	outputLimits *connection.OutputLimits
+
+	mu      sync.Mutex // makes registering a client atomic with closing
+	closing bool       // refuses new connections while closing
+}
+
+// NewRespHandler creates a RespHandler serving database.
+func NewRespHandler(database db.Database) *RespHandler {
+	return NewRespHandlerWithOptions(database, nil)
+}
+
+// NewRespHandlerWithOptions creates a RespHandler which limits the input of clients with opts.
+func NewRespHandlerWithOptions(database db.Database, opts *parser.Options) *RespHandler {
+	return &RespHandler{
+		clients:      connection.NewRegistry(),
+		db:           database,
+		opts:         opts,
+		certUser:     CommonNameUser,
+		outputLimits: connection.DefaultOutputLimits(),
+	}
+}
+
+// SetOutputLimits sets the limits of the output pending for each client class, the defaults are the same as redis.
+// It must be called before serving.
+func (h *RespHandler) SetOutputLimits(limits *connection.OutputLimits) {
+	h.outputLimits = limits
+}
+
+// Clients returns the registry of the connected clients.
+func (h *RespHandler) Clients() *connection.Registry {
+	return h.clients
+}
+
+// SetCertUser sets how TLS clients authenticated by certificates are mapped to users, nil disables the mapping.
+// It must be called before serving.
+func (h *RespHandler) SetCertUser(fn CertUserFunc) {
+	h.certUser = fn
+}
+
+// Handle serves the client until it disconnects, ctx is cancelled or the handler is closed.
+//
+// Protocol errors are replied to the client and parsing goes on with the next command,
+// errors which leave the stream unaligned, e.g. exceeding a limit of opts, close the connection after the reply.
+// Frames other than arrays are replied with a protocol error, since commands must be arrays of bulk strings.
+// A panic in Exec is logged and replied as an error instead of killing the connection.
+func (h *RespHandler) Handle(ctx context.Context, conn net.Conn) {
+	client := h.register(conn)
+	if client == nil {
+		_ = conn.Close()
+		return
+	}
+	defer h.handling.Done()
+	defer h.closeClient(client)
+	// stops the parser goroutine on every return, otherwise it blocks forever sending the next payload
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+
+	if tlsConn, ok := conn.(*tls.Conn); ok {
+		if err := h.handshake(ctx, client, tlsConn); err != nil {
+			logger.Warn("tls handshake with " + client.RemoteAddr() + " failed: " + err.Error())
+			return
+		}
+	}
+
+	ch := parser.ParseStreamContext(ctx, conn, h.opts)
+	for payload := range ch {
+		if payload.Err != nil {
+			var protoErr *parser.ProtocolError
+			if !errors.As(payload.Err, &protoErr) { // io.EOF, connection reset or closed
+				logger.Info("connection closed: " + client.RemoteAddr())
+				return
+			}
+			if err := client.WriteReply(protoErr); err != nil {
+				return
+			}
+			continue
+		}
+
+		cmdLine, ok := payload.Data.(*reply.MultiBulkReply)
+		if !ok {
+			if stream, ok := payload.Data.(*parser.BulkStream); ok { // discard the bulk streamed by opts.StreamBulkLen
+				_ = stream.Close()
+			}
+			logger.Warn("require multi bulk protocol from " + client.RemoteAddr() + ", got " + fmt.Sprintf("%T", payload.Data))
+			if err := client.WriteReply(errNotMultiBulk); err != nil {
+				return
+			}
+			continue
+		}
+		if len(cmdLine.Args) == 0 {
+			continue
+		}
+		result := h.exec(client, cmdLine.Args)
+		if result == nil {
+			continue
+		}
+		if err := client.WriteReply(result); err != nil {
+			logger.Warn("write reply to " + client.RemoteAddr() + " failed: " + err.Error())
+			return
+		}
+		if client.CloseAfterReply() {
+			return
+		}
+	}
+}
+
+// register wraps conn and registers the client, it returns nil if the handler is closing.
+//
+// Registering is atomic with Close, so that Close either closes the client and waits for it, or refuses it.
+func (h *RespHandler) register(conn net.Conn) *connection.RespConnection {
+	h.mu.Lock()
+	defer h.mu.Unlock()
+	if h.closing {
+		return nil
+	}
+	h.handling.Add(1)
+	client := connection.NewRespConnection(conn)
+	client.StartOutputQueue(h.outputLimits)
+	h.clients.Add(client)
+	return client
+}
+
+// handshake completes the TLS handshake and sets the user of the client from its verified certificate.
+func (h *RespHandler) handshake(ctx context.Context, client *connection.RespConnection, conn *tls.Conn) error {
+	ctx, cancel := context.WithTimeout(ctx, handshakeTimeout)
+	defer cancel()
+	if err := conn.HandshakeContext(ctx); err != nil {
+		return err
+	}
+	state := conn.ConnectionState()
+	if h.certUser != nil && len(state.VerifiedChains) > 0 {
+		client.SetUser(h.certUser(state.VerifiedChains[0][0]))
+	}
+	return nil
+}
+
+// exec executes the command and turns a panic into an error reply.
+func (h *RespHandler) exec(client *connection.RespConnection, cmdLine db.CmdLine) (result resp.Reply) {
+	name := strings.ToLower(string(cmdLine[0]))
+	client.RecordCmd(name)
+	if name == "client" {
+		return h.clients.ExecClient(client, cmdLine[1:])
+	}
+	defer func() {
+		if err := recover(); err != nil {
+			logger.Error(fmt.Sprintf("panic when executing %s: %v\n%s",
+				utils.CmdLine2String(cmdLine), err, debug.Stack()))
+			result = reply.NewUnknownErrReply()
+		}
+	}()
+	return h.db.Exec(client, cmdLine)
+}
+
+// closeClient closes the connection and notifies the database, only once for each client.
+func (h *RespHandler) closeClient(client *connection.RespConnection) {
+	if !h.clients.Remove(client) {
+		return
+	}
+	_ = client.Close()
+	h.db.AfterClientClose(client)
+}
+
+// Close stops accepting connections, closes the active ones and then the database.
+//
+// The clients are closed concurrently, each of them writes its pending output first.
+// The whole wait is bounded by closeTimeout, after which the remaining connections are closed forcibly.
+func (h *RespHandler) Close() error {
+	h.mu.Lock()
+	if h.closing {
+		h.mu.Unlock()
+		return nil
+	}
+	h.closing = true
+	h.mu.Unlock()
+	logger.Info("handler shutting down...")
+	for _, client := range h.clients.List(nil) {
+		go func() { _ = client.Close() }()
+	}
+	if h.handling.WaitWithTimeout(closeTimeout) {
+		n := h.clients.Kill(nil, nil)
+		logger.Warn(fmt.Sprintf("close timeout, %d connections closed forcibly", n))
+	}
+	return h.db.Close()
+}
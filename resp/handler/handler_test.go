@@ -0,0 +1,280 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"runtime"
+	"strings"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+	"godis-lib/resp/connection"
+	"godis-lib/resp/reply"
+)
+
+// testDB supports PING, ECHO, WHOAMI and PANIC, and counts the closed clients.
+type testDB struct {
+	closedClients atomic.Int32
+	closed        atomic.Bool
+}
+
+func (d *testDB) Exec(client resp.Connection, args db.CmdLine) resp.Reply {
+	switch strings.ToUpper(string(args[0])) {
+	case "PING":
+		return reply.NewPongReply()
+	case "ECHO":
+		return reply.NewBulkReply(args[1])
+	case "WHOAMI":
+		return reply.NewBulkReply([]byte(client.(resp.ClientInfo).GetUser()))
+	case "PANIC":
+		panic("boom")
+	}
+	return reply.NewUnknownCommandErrReply(string(args[0]))
+}
+
+func (d *testDB) AfterClientClose(resp.Connection) {
+	d.closedClients.Add(1)
+}
+
+func (d *testDB) Close() error {
+	d.closed.Store(true)
+	return nil
+}
+
+func readLine(t *testing.T, reader *bufio.Reader) string {
+	line, err := reader.ReadString('\n')
+	if err != nil {
+		t.Fatal(err)
+	}
+	return line
+}
+
+func TestRespHandler(t *testing.T) {
+	database := &testDB{}
+	h := NewRespHandler(database)
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h.Handle(context.Background(), server)
+		close(done)
+	}()
+
+	go func() {
+		_, _ = client.Write([]byte("PING\r\n*2\r\n$4\r\nECHO\r\n$2\r\nhi\r\n*1\r\n$5\r\nPANIC\r\n*1\r\n$a\r\n*1\r\n$4\r\nPING\r\n"))
+	}()
+	reader := bufio.NewReader(client)
+	expected := []string{"+PONG\r\n", "$2\r\n", "hi\r\n", string(reply.NewUnknownErrReply().Bytes())}
+	for _, line := range expected {
+		if actual := readLine(t, reader); actual != line {
+			t.Errorf("expected %q, actually %q", line, actual)
+		}
+	}
+	// parsing goes on with the next command after a protocol error
+	if line := readLine(t, reader); !strings.HasPrefix(line, "-ERR Protocol error") {
+		t.Errorf("expected protocol error, actually %q", line)
+	}
+	if line := readLine(t, reader); line != "+PONG\r\n" {
+		t.Errorf("expected PONG, actually %q", line)
+	}
+
+	_ = client.Close()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not return after EOF")
+	}
+	if database.closedClients.Load() != 1 {
+		t.Errorf("expected AfterClientClose once, actually %d", database.closedClients.Load())
+	}
+}
+
+func TestRespHandlerClose(t *testing.T) {
+	database := &testDB{}
+	h := NewRespHandler(database)
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h.Handle(context.Background(), server)
+		close(done)
+	}()
+
+	go func() { _, _ = client.Write([]byte("PING\r\n")) }()
+	if line := readLine(t, bufio.NewReader(client)); line != "+PONG\r\n" {
+		t.Errorf("expected PONG, actually %q", line)
+	}
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	<-done
+	if !database.closed.Load() || database.closedClients.Load() != 1 {
+		t.Errorf("unexpected close state %v %d", database.closed.Load(), database.closedClients.Load())
+	}
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected EOF, actually %v", err)
+	}
+
+	// new connections are refused after Close
+	server, client = net.Pipe()
+	h.Handle(context.Background(), server)
+	if _, err := client.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected EOF, actually %v", err)
+	}
+}
+
+func TestRespHandlerContext(t *testing.T) {
+	database := &testDB{}
+	h := NewRespHandler(database)
+	server, client := net.Pipe()
+	defer client.Close()
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan struct{})
+	go func() {
+		h.Handle(ctx, server)
+		close(done)
+	}()
+	cancel()
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not return after cancel")
+	}
+	if database.closedClients.Load() != 1 {
+		t.Errorf("expected AfterClientClose once, actually %d", database.closedClients.Load())
+	}
+}
+
+func TestRespHandlerClientKill(t *testing.T) {
+	database := &testDB{}
+	h := NewRespHandler(database)
+	server, client := net.Pipe()
+	done := make(chan struct{})
+	go func() {
+		h.Handle(context.Background(), server)
+		close(done)
+	}()
+
+	go func() { _, _ = client.Write([]byte("CLIENT SETNAME me\r\n")) }()
+	reader := bufio.NewReader(client)
+	if line := readLine(t, reader); line != "+OK\r\n" {
+		t.Errorf("expected OK, actually %q", line)
+	}
+	if clients := h.Clients().List(nil); len(clients) != 1 || clients[0].GetName() != "me" {
+		t.Errorf("unexpected clients %v", clients)
+	}
+	go func() { _, _ = client.Write([]byte("CLIENT KILL SKIPME no\r\n")) }()
+	// a client killing itself is closed after receiving the reply
+	if line := readLine(t, reader); line != ":1\r\n" {
+		t.Errorf("expected 1, actually %q", line)
+	}
+	select {
+	case <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("handler did not return after CLIENT KILL")
+	}
+	if h.Clients().Len() != 0 || database.closedClients.Load() != 1 {
+		t.Errorf("expected client to be unregistered")
+	}
+}
+
+func TestRespHandlerNotMultiBulk(t *testing.T) {
+	h := NewRespHandler(&testDB{})
+	server, client := net.Pipe()
+	defer client.Close()
+	go h.Handle(context.Background(), server)
+
+	// frames other than arrays are replied with a protocol error, then parsing goes on
+	go func() { _, _ = client.Write([]byte(":1\r\n*1\r\n$4\r\nPING\r\n")) }()
+	reader := bufio.NewReader(client)
+	if line := readLine(t, reader); line != string(errNotMultiBulk.Bytes()) {
+		t.Errorf("expected protocol error, actually %q", line)
+	}
+	if line := readLine(t, reader); line != "+PONG\r\n" {
+		t.Errorf("expected PONG, actually %q", line)
+	}
+}
+
+func TestRespHandlerCloseStalled(t *testing.T) {
+	defer func(timeout time.Duration) { closeTimeout = timeout }(closeTimeout)
+	closeTimeout = 100 * time.Millisecond
+
+	database := &testDB{}
+	h := NewRespHandler(database)
+	done := make(chan struct{}, 3)
+	for i := 0; i < 3; i++ {
+		server, client := net.Pipe()
+		defer client.Close()
+		go func() {
+			h.Handle(context.Background(), server)
+			done <- struct{}{}
+		}()
+		// the client never reads, so the reply cannot be written when closing
+		arg := strings.Repeat("x", 1024)
+		go func() {
+			_, _ = client.Write([]byte("*2\r\n$4\r\nECHO\r\n$1024\r\n" + arg + "\r\n"))
+		}()
+	}
+	for h.Clients().Len() < 3 {
+		time.Sleep(time.Millisecond)
+	}
+	time.Sleep(10 * time.Millisecond) // wait for the commands to be executed
+
+	// all the clients share one timeout instead of waiting for each of them in turn
+	start := time.Now()
+	if err := h.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if elapsed := time.Since(start); elapsed > 2*closeTimeout+100*time.Millisecond {
+		t.Errorf("expected close within %v, actually %v", 2*closeTimeout, elapsed)
+	}
+	for i := 0; i < 3; i++ {
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatal("handler did not return after close")
+		}
+	}
+	if !database.closed.Load() {
+		t.Errorf("expected database to be closed")
+	}
+}
+
+// waitGoroutines waits for the number of goroutines to drop to n and returns the final number.
+func waitGoroutines(n int) int {
+	deadline := time.Now().Add(5 * time.Second)
+	for runtime.NumGoroutine() > n && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+	}
+	return runtime.NumGoroutine()
+}
+
+func TestRespHandlerNoGoroutineLeak(t *testing.T) {
+	h := NewRespHandler(&testDB{})
+	h.SetOutputLimits(&connection.OutputLimits{Normal: connection.OutputLimit{Hard: 1}})
+	before := runtime.NumGoroutine()
+
+	// the first client kills itself, the reply of the second one exceeds the output limit
+	for _, cmd := range []string{"CLIENT KILL SKIPME no\r\n", "PING\r\n"} {
+		server, client := net.Pipe()
+		done := make(chan struct{})
+		go func() {
+			h.Handle(context.Background(), server)
+			close(done)
+		}()
+		go func() { _, _ = io.Copy(io.Discard, client) }()
+		_, _ = client.Write([]byte(cmd))
+		select {
+		case <-done:
+		case <-time.After(5 * time.Second):
+			t.Fatalf("%q: handler did not return", cmd)
+		}
+		_ = client.Close()
+	}
+	if after := waitGoroutines(before); after > before {
+		t.Errorf("expected %d goroutines, actually %d", before, after)
+	}
+}
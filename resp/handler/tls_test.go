@@ -0,0 +1,106 @@
+package handler
+
+import (
+	"bufio"
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/tls"
+	"crypto/x509"
+	"crypto/x509/pkix"
+	"math/big"
+	"net"
+	"testing"
+	"time"
+
+	"godis-lib/tcp"
+)
+
+// issue creates a certificate signed by parent, or a self-signed CA when parent is nil.
+func issue(t *testing.T, cn string, parent *x509.Certificate, parentKey *ecdsa.PrivateKey, usage x509.ExtKeyUsage) (*x509.Certificate, tls.Certificate) {
+	key, err := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	if err != nil {
+		t.Fatal(err)
+	}
+	template := &x509.Certificate{
+		SerialNumber: big.NewInt(time.Now().UnixNano()),
+		Subject:      pkix.Name{CommonName: cn},
+		NotBefore:    time.Now().Add(-time.Hour),
+		NotAfter:     time.Now().Add(time.Hour),
+		KeyUsage:     x509.KeyUsageDigitalSignature | x509.KeyUsageCertSign,
+		ExtKeyUsage:  []x509.ExtKeyUsage{usage},
+		IPAddresses:  []net.IP{net.IPv4(127, 0, 0, 1)},
+	}
+	if parent == nil {
+		template.IsCA = true
+		template.BasicConstraintsValid = true
+		parent, parentKey = template, key
+	}
+	der, err := x509.CreateCertificate(rand.Reader, template, parent, &key.PublicKey, parentKey)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cert, err := x509.ParseCertificate(der)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return cert, tls.Certificate{Certificate: [][]byte{der}, PrivateKey: key, Leaf: cert}
+}
+
+func TestRespHandlerTLS(t *testing.T) {
+	ca, caCert := issue(t, "test ca", nil, nil, x509.ExtKeyUsageAny)
+	caKey := caCert.PrivateKey.(*ecdsa.PrivateKey)
+	_, serverCert := issue(t, "server", ca, caKey, x509.ExtKeyUsageServerAuth)
+	_, clientCert := issue(t, "alice", ca, caKey, x509.ExtKeyUsageClientAuth)
+	pool := x509.NewCertPool()
+	pool.AddCert(ca)
+
+	cfg := &tcp.Config{
+		Address: "127.0.0.1:0",
+		TLSConfig: &tls.Config{
+			Certificates: []tls.Certificate{serverCert},
+			ClientAuth:   tls.RequireAndVerifyClientCert,
+			ClientCAs:    pool,
+		},
+	}
+	listener, err := tcp.Listen(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() { done <- tcp.Serve(ctx, listener, cfg, NewRespHandler(&testDB{})) }()
+	defer func() {
+		cancel()
+		<-done
+	}()
+
+	conn, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{
+		Certificates: []tls.Certificate{clientCert},
+		RootCAs:      pool,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	_, _ = conn.Write([]byte("*1\r\n$6\r\nWHOAMI\r\n"))
+	reader := bufio.NewReader(conn)
+	if line := readLine(t, reader); line != "$5\r\n" {
+		t.Fatalf("expected $5, actually %q", line)
+	}
+	if line := readLine(t, reader); line != "alice\r\n" {
+		t.Errorf("expected alice, actually %q", line)
+	}
+
+	// the handshake fails without a client certificate
+	plain, err := tls.Dial("tcp", listener.Addr().String(), &tls.Config{RootCAs: pool})
+	if err == nil {
+		defer plain.Close()
+		_ = plain.SetDeadline(time.Now().Add(5 * time.Second))
+		_, _ = plain.Write([]byte("PING\r\n"))
+		if _, err = plain.Read(make([]byte, 1)); err == nil {
+			t.Errorf("expected handshake failure without client certificate")
+		}
+	}
+}
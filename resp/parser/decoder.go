@@ -0,0 +1,494 @@
+package parser
+
+import (
+	"bufio"
+	"bytes"
+	"errors"
+	"io"
+	"strconv"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+	"godis-lib/resp/reply"
+)
+
+// Decoder 是一个同步的resp解码器, 在调用者的goroutine中逐个读取回复
+//
+// 与 ParseStream 不同, Decoder 不会启动goroutine, 也不会通过通道传递数据,
+// 适合在读取连接的goroutine中直接解析流水线(pipeline)中的命令
+//
+// Decoder 不是并发安全的
+type Decoder struct {
+	br   *bufio.Reader
+	opts *Options
+	line []byte // 用于拼接超过bufio缓冲区大小的行, 可复用
+	err  error  // 表示无法恢复的错误, 例如超过了解析器的限制, 之后的读取都返回该错误
+
+	offset    int64 // 表示已经读取的字节数
+	lineStart int64 // 表示最近读取的一行在数据流中的偏移量
+	frame     int64 // 表示当前顶层帧的序号
+
+	stream *BulkStream // 表示最近返回的未关闭的数据流
+	depth  int         // 表示当前读取的回复的嵌套层数, 0表示顶层
+}
+
+// NewDecoder 用于创建一个从rd读取数据的解码器, 使用默认的限制
+func NewDecoder(rd io.Reader) *Decoder {
+	return NewDecoderWithOptions(rd, nil)
+}
+
+// NewDecoderWithOptions 用于创建一个从rd读取数据的解码器, opts为nil时使用默认的限制
+func NewDecoderWithOptions(rd io.Reader, opts *Options) *Decoder {
+	return &Decoder{
+		br:    bufio.NewReader(rd),
+		opts:  opts.withDefaults(),
+		frame: -1,
+	}
+}
+
+// Offset 用于返回已经读取的字节数, 在 Next 成功返回之后即为下一帧的起始位置
+func (d *Decoder) Offset() int64 {
+	return d.offset
+}
+
+// Next 用于读取下一个回复
+//
+// 如果是协议错误, 返回 *ProtocolError, 此时可以继续调用 Next 从下一行开始解析;
+// 其他错误(例如io.EOF)以及超过了限制的 *ProtocolError (包装了 *LimitError) 表示数据流已经不可用
+//
+// 如果数据流在一帧的中间结束, 返回 io.ErrUnexpectedEOF
+//
+// 如果之前返回的 *BulkStream 没有关闭, 会先将其关闭, 未读取的数据会被丢弃
+func (d *Decoder) Next() (resp.Reply, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err := d.closeStream(); err != nil {
+		return nil, d.fail(err)
+	}
+	for {
+		res, err := d.readTopLevel()
+		if err != nil {
+			return nil, d.fail(err)
+		}
+		if res != nil { // 跳过空行
+			return res, nil
+		}
+	}
+}
+
+// NextCmdLine 用于读取下一条命令, 并将参数解码到cmdLine中以复用内存
+//
+// cmdLine 中已有的参数的底层数组会被复用, 因此返回的命令只在下一次调用之前有效,
+// 调用者如果需要保留参数, 需要自行复制
+//
+// 命令必须是回复字符串组成的数组或者内联命令, 否则返回协议错误
+//
+// 参数总是读取到内存中, 不受 Options.StreamBulkLen 的影响
+func (d *Decoder) NextCmdLine(cmdLine db.CmdLine) (db.CmdLine, error) {
+	if d.err != nil {
+		return nil, d.err
+	}
+	if err := d.closeStream(); err != nil {
+		return nil, d.fail(err)
+	}
+	cmdLine, err := d.readCmdLine(cmdLine)
+	if err != nil {
+		return nil, d.fail(err)
+	}
+	return cmdLine, nil
+}
+
+// fail 用于记录无法恢复的错误
+func (d *Decoder) fail(err error) error {
+	var limitErr *LimitError
+	if errors.As(err, &limitErr) {
+		d.err = err
+	}
+	return err
+}
+
+// protocolErr 用于创建一个位于最近读取的一行的协议错误
+func (d *Decoder) protocolErr(expected string, got []byte) *ProtocolError {
+	return d.protocolErrAt(d.lineStart, expected, got)
+}
+
+// protocolErrAt 用于创建一个位于offset的协议错误
+func (d *Decoder) protocolErrAt(offset int64, expected string, got []byte) *ProtocolError {
+	return &ProtocolError{
+		Offset:   offset,
+		Frame:    d.frame,
+		Expected: expected,
+		Got:      string(got),
+	}
+}
+
+// limitErr 用于创建一个超过了限制的协议错误
+func (d *Decoder) limitErr(limit string, maxValue, got int64) *ProtocolError {
+	err := d.protocolErr(limit+" <= "+strconv.FormatInt(maxValue, 10), utils.String2Bytes(strconv.FormatInt(got, 10)))
+	err.Err = &LimitError{Limit: limit, Max: maxValue, Got: got}
+	return err
+}
+
+// peek 用于在读取新的顶层帧之前查看第一个字节
+func (d *Decoder) peek() (byte, error) {
+	first, err := d.br.Peek(1)
+	if err != nil {
+		return 0, err
+	}
+	d.frame++
+	return first[0], nil
+}
+
+// readCmdLine 用于读取下一条命令, 参见 NextCmdLine
+func (d *Decoder) readCmdLine(cmdLine db.CmdLine) (db.CmdLine, error) {
+	for {
+		first, err := d.peek()
+		if err != nil {
+			return nil, err
+		}
+		if first != '*' {
+			start := d.offset
+			res, err := d.readFrame(first)
+			if err != nil {
+				return nil, err
+			}
+			if res == nil { // 跳过空行
+				continue
+			}
+			if cmd, ok := res.(*reply.MultiBulkReply); ok { // 内联命令
+				return cmd.Args, nil
+			}
+			return nil, d.protocolErrAt(start, "command", res.Bytes())
+		}
+
+		header, err := d.readLine()
+		if err != nil {
+			return nil, err
+		}
+		count, err := parseLength(header)
+		if err != nil || count < 0 {
+			return nil, d.protocolErr("multibulk length", trimCRLF(header))
+		}
+		if err = d.checkMultiBulkLen(count); err != nil {
+			return nil, err
+		}
+		if count == 0 {
+			continue
+		}
+
+		cmdLine = cmdLine[:0]
+		for i := 0; i < count; i++ {
+			msg, err := d.readLine()
+			if err != nil {
+				return nil, err
+			}
+			if msg[0] != '$' {
+				return nil, d.protocolErr("'$'", trimCRLF(msg))
+			}
+			bulkLen, err := d.parseBulkHeader(msg)
+			if err != nil {
+				return nil, err
+			}
+
+			var arg []byte
+			if i < cap(cmdLine) {
+				arg = cmdLine[:i+1][i]
+			}
+			if bulkLen == -1 { // 空值为nil, 与空字符串区分
+				arg = nil
+			} else if arg, err = d.readBodyInto(arg, bulkLen); err != nil {
+				return nil, err
+			}
+			cmdLine = append(cmdLine, arg)
+		}
+		return cmdLine, nil
+	}
+}
+
+// readTopLevel 用于读取一个顶层的回复, 空行返回nil
+func (d *Decoder) readTopLevel() (resp.Reply, error) {
+	first, err := d.peek()
+	if err != nil {
+		return nil, err
+	}
+	return d.readFrame(first)
+}
+
+// readFrame 用于读取以first开头的顶层的回复
+//
+// 如果第一个字节不是resp的类型标识, 则按照内联命令解析, 例如通过telnet发送的 SET key "hello world"\r\n,
+// 空行返回nil
+func (d *Decoder) readFrame(first byte) (resp.Reply, error) {
+	if !isTypeByte(first) {
+		return d.readInline()
+	}
+	return d.readReply()
+}
+
+// readLine 用于读取以\r\n结尾的一行数据, 返回的数据包含\r\n
+//
+// 返回的数据在下一次读取之前有效
+func (d *Decoder) readLine() ([]byte, error) {
+	line, err := d.readRawLine()
+	if err != nil {
+		return nil, err
+	}
+
+	if len(line) < 2 || line[len(line)-2] != '\r' { // 如果数据不以回车换行符结尾, 则返回错误
+		return nil, d.protocolErr("CRLF", line)
+	}
+
+	return line, nil
+}
+
+// readRawLine 用于读取以\n结尾的一行数据, 优先使用bufio的缓冲区以避免内存分配
+//
+// 读取之前已经确认了有数据, 因此io.EOF表示数据在一帧的中间结束
+func (d *Decoder) readRawLine() (line []byte, err error) {
+	d.lineStart = d.offset
+	defer func() {
+		d.offset += int64(len(line))
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+	}()
+
+	line, err = d.br.ReadSlice('\n')
+	if errors.Is(err, bufio.ErrBufferFull) {
+		// 行的长度超过了缓冲区的大小, 拼接到可复用的缓冲区中
+		d.line = append(d.line[:0], line...)
+		for errors.Is(err, bufio.ErrBufferFull) && len(d.line) <= d.opts.MaxInlineLen {
+			line, err = d.br.ReadSlice('\n')
+			d.line = append(d.line, line...)
+		}
+		line = d.line
+	}
+	if len(line) > d.opts.MaxInlineLen {
+		return line, d.limitErr("inline length", int64(d.opts.MaxInlineLen), int64(len(line)))
+	}
+	return line, err
+}
+
+// parseBulkHeader 用于解析一行数据的头部, 并检查数据的长度是否超过限制
+func (d *Decoder) parseBulkHeader(msg []byte) (int64, error) {
+	bulkLen, err := parseBulkHeader(msg)
+	if err != nil {
+		return 0, d.protocolErr("bulk length", trimCRLF(msg))
+	}
+	if bulkLen > d.opts.MaxBulkLen {
+		return 0, d.limitErr("bulk length", d.opts.MaxBulkLen, bulkLen)
+	}
+	return bulkLen, nil
+}
+
+// checkMultiBulkLen 用于检查数组的元素个数是否超过限制
+func (d *Decoder) checkMultiBulkLen(count int) error {
+	if count > d.opts.MaxMultiBulkLen {
+		return d.limitErr("multibulk length", int64(d.opts.MaxMultiBulkLen), int64(count))
+	}
+	return nil
+}
+
+// readBodyInto 用于严格按照bulkLen+2字节数读取数据到buf中, 返回的数据不包含\r\n
+//
+// 如果buf的容量足够, 则复用buf; 较大的数据随着读取逐步扩容, 而不是根据头部一次性分配
+func (d *Decoder) readBodyInto(buf []byte, bulkLen int64) ([]byte, error) {
+	start := d.offset
+	size := bulkLen + 2
+
+	var err error
+	if int64(cap(buf)) >= size || size <= maxPreallocBulkLen {
+		if int64(cap(buf)) >= size {
+			buf = buf[:size]
+		} else {
+			buf = make([]byte, size)
+		}
+		var n int
+		n, err = io.ReadFull(d.br, buf)
+		d.offset += int64(n)
+	} else {
+		w := bytes.NewBuffer(make([]byte, 0, maxPreallocBulkLen))
+		var n int64
+		n, err = io.CopyN(w, d.br, size)
+		d.offset += n
+		buf = w.Bytes()
+	}
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		return nil, err
+	}
+
+	if buf[bulkLen] != '\r' || buf[bulkLen+1] != '\n' { // 如果数据不以回车换行符结尾, 则返回错误
+		return nil, d.protocolErrAt(start+bulkLen, "CRLF after "+strconv.FormatInt(bulkLen, 10)+" bytes", buf[bulkLen:])
+	}
+
+	return buf[:bulkLen], nil
+}
+
+// readInline 用于读取内联命令, 与redis一致, 行尾可以是\r\n或者\n
+//
+// 参数的切分规则与redis的sdssplitargs一致, 支持双引号, 单引号和\xHH转义
+func (d *Decoder) readInline() (resp.Reply, error) {
+	line, err := d.readRawLine()
+	if err != nil {
+		return nil, err
+	}
+
+	args, err := utils.SplitArgs(line)
+	if err != nil {
+		return nil, d.protocolErr("balanced quotes", trimCRLF(line))
+	}
+	if len(args) == 0 { // 空行
+		return nil, nil
+	}
+
+	return reply.NewMultiBulkReply(args), nil
+}
+
+// readReply 用于递归读取一个完整的回复
+func (d *Decoder) readReply() (resp.Reply, error) {
+	msg, err := d.readLine()
+	if err != nil {
+		return nil, err
+	}
+	return d.parseReply(msg)
+}
+
+// parseReply 用于根据已经读取的第一行解析一个完整的回复, 聚合类型中的元素可以是任意类型
+//
+// 例如: $3\r\nfoo\r\n, :1\r\n, *2\r\n:1\r\n*1\r\n$1\r\na\r\n, %1\r\n+key\r\n:2\r\n
+func (d *Decoder) parseReply(msg []byte) (resp.Reply, error) {
+	if len(msg) < 3 { // 至少包含类型标识和\r\n
+		return nil, d.protocolErr("type byte", trimCRLF(msg))
+	}
+
+	switch msg[0] {
+	case '$', '!', '=':
+		msgType := msg[0]
+		bulkLen, err := d.parseBulkHeader(msg)
+		if err != nil {
+			return nil, err
+		}
+		if bulkLen == -1 {
+			return reply.NewNullBulkReply(), nil
+		}
+		if msgType == '$' && d.opts.StreamBulkLen > 0 && bulkLen > d.opts.StreamBulkLen {
+			if d.opts.BulkSink != nil {
+				return d.sinkStream(bulkLen)
+			}
+			if d.depth == 0 {
+				return d.newStream(bulkLen), nil
+			}
+		}
+		body, err := d.readBodyInto(nil, bulkLen)
+		if err != nil {
+			return nil, err
+		}
+		switch msgType {
+		case '!':
+			return reply.NewBlobErrReply(body), nil
+		case '=':
+			res, err := parseVerbatim(body)
+			if err != nil {
+				return nil, d.protocolErrAt(d.offset-bulkLen-2, "verbatim format 'xxx:'", body)
+			}
+			return res, nil
+		}
+		return reply.NewBulkReply(body), nil
+	case '*', '%', '~', '>', '|':
+		return d.readAggregate(msg)
+	}
+
+	res, err := parseSingleLineReply(msg)
+	if err != nil {
+		return nil, d.protocolErr(singleLineTypes[msg[0]], trimCRLF(msg))
+	}
+	return res, nil
+}
+
+// singleLineTypes 用于在协议错误中描述单行回复期望的内容
+var singleLineTypes = map[byte]string{
+	'+': "status",
+	'-': "error",
+	':': "integer",
+	',': "double",
+	'#': "boolean 't' or 'f'",
+	'_': "null",
+	'(': "big number",
+}
+
+// readAggregate 用于读取聚合类型的元素, header是已经读取的头部
+//
+// 例如: *2\r\n, %2\r\n, ~3\r\n, >3\r\n, |1\r\n
+//
+// 数组中的元素可以是任意类型, 包括嵌套的数组, 例如 SCAN, EXEC 和 XREAD 的回复
+//
+// 字典和属性的头部是键值对的个数, 因此需要读取两倍的元素
+func (d *Decoder) readAggregate(header []byte) (res resp.Reply, err error) {
+	msgType := header[0]
+	count, err := parseLength(header)
+	if err != nil || count < -1 || (count == -1 && msgType != '*') {
+		return nil, d.protocolErr("aggregate length", trimCRLF(header))
+	}
+	if err = d.checkMultiBulkLen(count); err != nil {
+		return nil, err
+	}
+	if count == -1 { // *-1\r\n 表示空值数组, 与空数组 *0\r\n 不同
+		return reply.NewNullMultiBulkReply(), nil
+	}
+	if count == 0 && msgType == '*' {
+		return reply.NewEmptyMultiBulkReply(), nil
+	}
+
+	n := count
+	if msgType == '%' || msgType == '|' {
+		n *= 2
+	}
+	if d.depth >= d.opts.MaxNestingDepth {
+		return nil, d.limitErr("nesting depth", int64(d.opts.MaxNestingDepth), int64(d.depth+1))
+	}
+	d.depth++
+	defer func() { d.depth-- }()
+	elements := make([]resp.Reply, 0, min(n, maxPreallocLen))
+	for i := 0; i < n; i++ {
+		var elem resp.Reply
+		if elem, err = d.readReply(); err != nil {
+			return nil, err
+		}
+		elements = append(elements, elem)
+	}
+
+	switch msgType {
+	case '*':
+		res = toMultiBulk(elements)
+	case '~':
+		res = reply.NewSetReply(elements)
+	case '>':
+		res = reply.NewPushReply(elements)
+	case '%':
+		res = reply.NewMapReply(toEntries(elements))
+	case '|': // 属性之后紧跟着被修饰的回复
+		var next resp.Reply
+		if next, err = d.readReply(); err != nil {
+			return nil, err
+		}
+		res = reply.NewAttributeReply(reply.NewMapReply(toEntries(elements)), next)
+	}
+
+	return res, nil
+}
+
+// isProtocolErr 用于判断是否是可以恢复的协议错误, 协议错误之后可以从下一行继续解析
+func isProtocolErr(err error) bool {
+	var protoErr *ProtocolError
+	return errors.As(err, &protoErr) && protoErr.Err == nil
+}
+
+// trimCRLF 用于去除行尾的\r\n
+func trimCRLF(line []byte) []byte {
+	return bytes.TrimSuffix(line, []byte("\r\n"))
+}
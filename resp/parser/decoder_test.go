@@ -0,0 +1,167 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+	"godis-lib/resp/reply"
+)
+
+func TestDecoderNext(t *testing.T) {
+	data := "+OK\r\n:1\r\n*2\r\n$3\r\nGET\r\n$3\r\nkey\r\n$-1\r\n"
+	decoder := NewDecoder(strings.NewReader(data))
+
+	var buf bytes.Buffer
+	for {
+		res, err := decoder.Next()
+		if err == io.EOF {
+			break
+		}
+		if err != nil {
+			t.Fatal(err)
+		}
+		buf.Write(res.Bytes())
+	}
+	if buf.String() != data {
+		t.Errorf("expected %q, actually %q", data, buf.String())
+	}
+}
+
+func TestDecoderErrCode(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("-WRONGTYPE Operation against a key holding the wrong kind of value\r\n-ERR syntax error\r\n!10\r\nOOM memory\r\n"))
+	for _, target := range []error{reply.ErrWrongType, reply.ErrGeneric, reply.ErrOOM} {
+		res, err := decoder.Next()
+		if err != nil {
+			t.Fatal(err)
+		}
+		errReply, ok := res.(resp.ErrorReply)
+		if !ok || !errors.Is(errReply, target) {
+			t.Errorf("expected %v, actually %q", target, res.Bytes())
+		}
+	}
+}
+
+func TestDecoderRedirect(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("-MOVED 3999 127.0.0.1:6381\r\n-ASK 3999 127.0.0.1:6382\r\n"))
+	res, err := decoder.Next()
+	if moved, ok := res.(*reply.MovedReply); err != nil || !ok || moved.Slot() != 3999 || moved.Addr() != "127.0.0.1:6381" {
+		t.Errorf("expected moved reply, actually %#v %v", res, err)
+	}
+	res, err = decoder.Next()
+	if ask, ok := res.(*reply.AskReply); err != nil || !ok || ask.Slot() != 3999 || ask.Addr() != "127.0.0.1:6382" {
+		t.Errorf("expected ask reply, actually %#v %v", res, err)
+	}
+}
+
+func TestDecoderRoundTrip(t *testing.T) {
+	tests := []string{
+		"$-1\r\n",
+		"$0\r\n\r\n",
+		"*-1\r\n",
+		"*0\r\n",
+		"*3\r\n$-1\r\n$0\r\n\r\n$1\r\na\r\n",
+		"*2\r\n*-1\r\n*0\r\n",
+	}
+	for _, data := range tests {
+		res, err := ParseOne([]byte(data))
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(res.Bytes()) != data {
+			t.Errorf("expected %q, actually %q", data, res.Bytes())
+		}
+	}
+
+	decoder := NewDecoder(strings.NewReader("*3\r\n$3\r\nSET\r\n$-1\r\n$0\r\n\r\n"))
+	cmdLine, err := decoder.NextCmdLine(nil)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if cmdLine[1] != nil || cmdLine[2] == nil || len(cmdLine[2]) != 0 {
+		t.Errorf("expected nil and empty arguments, actually %q", cmdLine)
+	}
+}
+
+func TestDecoderNextProtocolErr(t *testing.T) {
+	decoder := NewDecoder(strings.NewReader("$abc\r\n:1\r\n"))
+	if _, err := decoder.Next(); err == nil || !isProtocolErr(err) {
+		t.Fatalf("expected protocol error, actually %v", err)
+	}
+	res, err := decoder.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := res.(*reply.IntReply); !ok || r.Code() != 1 {
+		t.Errorf("expected :1, actually %q", res.Bytes())
+	}
+}
+
+func TestDecoderNextCmdLine(t *testing.T) {
+	long := strings.Repeat("x", 8192)
+	data := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n" +
+		"*2\r\n$3\r\nGET\r\n$1\r\nk\r\n" +
+		"\r\n" +
+		"echo " + long + "\r\n"
+	decoder := NewDecoder(strings.NewReader(data))
+
+	var cmdLine db.CmdLine
+	var err error
+	expected := [][]string{
+		{"SET", "key", "value"},
+		{"GET", "k"},
+		{"echo", long},
+	}
+	for i, args := range expected {
+		if cmdLine, err = decoder.NextCmdLine(cmdLine); err != nil {
+			t.Fatal(err)
+		}
+		if len(cmdLine) != len(args) {
+			t.Fatalf("expected %q, actually %q", args, cmdLine)
+		}
+		for j, arg := range args {
+			if string(cmdLine[j]) != arg {
+				t.Errorf("expected %q, actually %q", arg, cmdLine[j])
+			}
+		}
+		if i == 1 && cap(cmdLine) < 3 { // 第二条命令复用了第一条命令的内存
+			t.Errorf("expected cmdLine to be reused")
+		}
+	}
+	if _, err = decoder.NextCmdLine(cmdLine); err != io.EOF {
+		t.Errorf("expected EOF, actually %v", err)
+	}
+}
+
+func TestParseOne(t *testing.T) {
+	res, err := ParseOne([]byte("+OK\r\n+QUEUED\r\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(res.Bytes()) != "+OK\r\n" {
+		t.Errorf("expected +OK, actually %q", res.Bytes())
+	}
+	if _, err = ParseOne(nil); err == nil {
+		t.Errorf("expected error for empty data")
+	}
+}
+
+func BenchmarkDecoderNextCmdLine(b *testing.B) {
+	data := bytes.Repeat([]byte("*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"), 1000)
+	b.SetBytes(int64(len(data)))
+	b.ReportAllocs()
+	var cmdLine db.CmdLine
+	var err error
+	for i := 0; i < b.N; i++ {
+		decoder := NewDecoder(bytes.NewReader(data))
+		for {
+			if cmdLine, err = decoder.NextCmdLine(cmdLine); err != nil {
+				break
+			}
+		}
+	}
+}
@@ -0,0 +1,54 @@
+package parser
+
+import (
+	"errors"
+	"fmt"
+	"strconv"
+
+	"godis-lib/resp/reply"
+)
+
+// ProtocolError 表示输入的数据不符合resp协议, 包含出错的位置以及期望和实际的内容
+//
+// 可以通过 errors.As 从 Payload.Err 或者 Decoder 返回的错误中获取, 例如:
+//
+//	var protoErr *parser.ProtocolError
+//	if errors.As(payload.Err, &protoErr) {
+//		log.Printf("corrupt data at offset %d", protoErr.Offset)
+//	}
+//
+// ProtocolError 同时也是一个协议错误回复, 可以直接发送给客户端
+type ProtocolError struct {
+	Offset   int64  // 表示出错的数据在数据流中的字节偏移量
+	Frame    int64  // 表示出错的顶层帧的序号, 从0开始
+	Expected string // 表示期望的内容, 例如 '$' 或者 CRLF
+	Got      string // 表示实际读取到的内容
+	Err      error  // 表示导致错误的原因, 例如 *LimitError, 可以为nil
+}
+
+func (e *ProtocolError) Error() string {
+	msg := fmt.Sprintf("Protocol error: expected %s, got %s at offset %d (frame %d)",
+		e.Expected, strconv.Quote(e.Got), e.Offset, e.Frame)
+	if e.Err != nil {
+		msg += ": " + e.Err.Error()
+	}
+	return msg
+}
+
+// Code 用于返回错误码, 协议错误的错误码与redis一致, 都是 ERR
+func (e *ProtocolError) Code() string {
+	return reply.CodeErr
+}
+
+// Bytes 用于返回协议错误回复, 例如 -ERR Protocol error: 'expected '$', got "x"'\r\n
+func (e *ProtocolError) Bytes() []byte {
+	var limitErr *LimitError
+	if errors.As(e.Err, &limitErr) {
+		return limitErr.Bytes()
+	}
+	return reply.NewProtocolErrReply("expected " + e.Expected + ", got " + strconv.Quote(e.Got)).Bytes()
+}
+
+func (e *ProtocolError) Unwrap() error {
+	return e.Err
+}
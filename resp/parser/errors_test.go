@@ -0,0 +1,75 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestProtocolErrorOffset(t *testing.T) {
+	tests := []struct {
+		data     string
+		offset   int64
+		frame    int64
+		expected string
+		got      string
+	}{
+		{"+OK\r\n:abc\r\n", 5, 1, "integer", ":abc"},
+		{"+OK\r\n+OK\r\n*2\r\n$3\r\nGET\r\n#x\r\n", 23, 2, "boolean 't' or 'f'", "#x"},
+		{"*1\r\n$3\r\nGETxx\r\n", 11, 0, "CRLF after 3 bytes", "xx"},
+		{"$x\r\n", 0, 0, "bulk length", "$x"},
+		{"*1\r\n$3\r\nGET\r\nset \"a\r\n", 13, 1, "balanced quotes", "set \"a"},
+		{"+OK\n", 0, 0, "CRLF", "+OK\n"},
+	}
+	for _, tt := range tests {
+		decoder := NewDecoder(strings.NewReader(tt.data))
+		var err error
+		for err == nil {
+			_, err = decoder.Next()
+		}
+		var protoErr *ProtocolError
+		if !errors.As(err, &protoErr) {
+			t.Errorf("%q: expected protocol error, actually %v", tt.data, err)
+			continue
+		}
+		if protoErr.Offset != tt.offset || protoErr.Frame != tt.frame ||
+			protoErr.Expected != tt.expected || protoErr.Got != tt.got {
+			t.Errorf("%q: unexpected error %+v", tt.data, protoErr)
+		}
+	}
+}
+
+func TestProtocolErrorPayload(t *testing.T) {
+	ch := ParseStream(strings.NewReader("*1\r\n$3\r\nGET\r\n*x\r\n"))
+	if payload := <-ch; payload.Err != nil {
+		t.Fatal(payload.Err)
+	}
+	payload := <-ch
+	var protoErr *ProtocolError
+	if !errors.As(payload.Err, &protoErr) || protoErr.Offset != 13 || protoErr.Frame != 1 {
+		t.Errorf("expected protocol error at offset 13, actually %v", payload.Err)
+	}
+	if len(protoErr.Bytes()) == 0 || protoErr.Bytes()[0] != '-' {
+		t.Errorf("expected error reply, actually %q", protoErr.Bytes())
+	}
+}
+
+func TestDecoderUnexpectedEOF(t *testing.T) {
+	for _, data := range []string{"*2\r\n$3\r\nGET\r\n", "$5\r\nhel", "+OK"} {
+		decoder := NewDecoder(strings.NewReader(data))
+		if _, err := decoder.Next(); err != io.ErrUnexpectedEOF {
+			t.Errorf("%q: expected unexpected EOF, actually %v", data, err)
+		}
+	}
+	decoder := NewDecoder(strings.NewReader("+OK\r\n"))
+	if _, err := decoder.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if decoder.Offset() != 5 {
+		t.Errorf("expected offset 5, actually %d", decoder.Offset())
+	}
+	if _, err := decoder.Next(); err != io.EOF {
+		t.Errorf("expected EOF, actually %v", err)
+	}
+}
@@ -3,17 +3,15 @@ package parser
 import (
 	"bytes"
 	"errors"
-	"go-redis/interface/resp"
+	"godis-lib/interface/resp"
+	"io"
 )
 
 // ParseOne reads data from []byte and return the first payload
 func ParseOne(data []byte) (resp.Reply, error) {
-	ch := make(chan *Payload)
-	reader := bytes.NewReader(data)
-	go parse0(reader, ch)
-	payload := <-ch // parse0 will close the channel
-	if payload == nil {
+	res, err := NewDecoder(bytes.NewReader(data)).Next()
+	if err == io.EOF {
 		return nil, errors.New("no protocol")
 	}
-	return payload.Data, payload.Err
+	return res, err
 }
@@ -0,0 +1,98 @@
+package parser
+
+import (
+	"fmt"
+	"math"
+
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+	"godis-lib/resp/reply"
+)
+
+const (
+	// DefaultMaxBulkLen 与redis的 proto-max-bulk-len 默认值一致
+	DefaultMaxBulkLen int64 = 512 * 1024 * 1024
+	// DefaultMaxMultiBulkLen 与redis一致, 数组的元素个数不能超过int32的范围
+	DefaultMaxMultiBulkLen = math.MaxInt32
+	// DefaultMaxInlineLen 与redis的 PROTO_INLINE_MAX_SIZE 一致
+	DefaultMaxInlineLen = 64 * 1024
+	// DefaultMaxNestingDepth 是聚合类型的最大嵌套层数, redis的回复最多嵌套几层(例如 EXEC 中的 XREAD),
+	// 与 hiredis 一样限制嵌套层数, 避免 *1\r\n*1\r\n... 的递归耗尽goroutine的栈导致整个进程崩溃
+	DefaultMaxNestingDepth = 128
+
+	// maxPreallocLen 是根据数组头部预先分配的最大元素个数, 更多的元素在读取时再扩容,
+	// 避免一个 *2000000000\r\n 就耗尽内存
+	maxPreallocLen = 1024
+	// maxPreallocBulkLen 是根据回复字符串的头部预先分配的最大字节数
+	maxPreallocBulkLen = 64 * 1024
+)
+
+// Options 用于配置解析器, 包括对输入数据的限制, 防止恶意的输入耗尽服务器的内存
+//
+// 限制中值小于等于0的字段使用默认值
+type Options struct {
+	MaxBulkLen      int64 // 表示回复字符串的最大长度
+	MaxMultiBulkLen int   // 表示数组的最大元素个数
+	MaxInlineLen    int   // 表示内联命令以及单行数据的最大长度
+	MaxNestingDepth int   // 表示聚合类型的最大嵌套层数, 属性修饰的回复也算作一层
+
+	BufferSize int // 表示 ParseStreamContext 返回的通道的缓冲区大小, 默认为0即无缓冲
+
+	// StreamBulkLen 大于0时, 长度超过该值的顶层回复字符串以 *BulkStream 的形式返回, 而不是读取到内存中
+	StreamBulkLen int64
+	// BulkSink 不为nil时, 长度超过 StreamBulkLen 的回复字符串(包括数组中的元素, 例如 RESTORE 的参数)在解析时交给 BulkSink 处理,
+	// 例如写入临时文件, BulkSink 返回的回复会代替回复字符串出现在解析的结果中;
+	// BulkSink 返回之后数据流会被关闭, 未读取的数据会被丢弃, 返回错误会中止解析
+	BulkSink func(stream *BulkStream) (resp.Reply, error)
+}
+
+// DefaultOptions 用于创建默认的解析器配置
+func DefaultOptions() *Options {
+	return &Options{
+		MaxBulkLen:      DefaultMaxBulkLen,
+		MaxMultiBulkLen: DefaultMaxMultiBulkLen,
+		MaxInlineLen:    DefaultMaxInlineLen,
+		MaxNestingDepth: DefaultMaxNestingDepth,
+	}
+}
+
+// withDefaults 用于返回一份补全了默认值的配置
+func (opts *Options) withDefaults() *Options {
+	res := DefaultOptions()
+	if opts == nil {
+		return res
+	}
+	res.MaxBulkLen = utils.If(opts.MaxBulkLen > 0, opts.MaxBulkLen, res.MaxBulkLen)
+	res.MaxMultiBulkLen = utils.If(opts.MaxMultiBulkLen > 0, opts.MaxMultiBulkLen, res.MaxMultiBulkLen)
+	res.MaxInlineLen = utils.If(opts.MaxInlineLen > 0, opts.MaxInlineLen, res.MaxInlineLen)
+	res.MaxNestingDepth = utils.If(opts.MaxNestingDepth > 0, opts.MaxNestingDepth, res.MaxNestingDepth)
+	res.BufferSize = max(opts.BufferSize, 0)
+	res.StreamBulkLen = opts.StreamBulkLen
+	res.BulkSink = opts.BulkSink
+	return res
+}
+
+// LimitError 表示输入的数据超过了解析器的限制
+//
+// 超过限制之后数据流已经无法对齐, 解析器不会再继续解析, ParseStream 会关闭通道
+//
+// LimitError 同时也是一个协议错误回复, 可以直接发送给客户端
+type LimitError struct {
+	Limit string // 表示超过的限制, 例如 bulk length
+	Max   int64  // 表示允许的最大值
+	Got   int64  // 表示实际的值
+}
+
+func (e *LimitError) Error() string {
+	return fmt.Sprintf("Protocol error: invalid %s: %d exceeds limit %d", e.Limit, e.Got, e.Max)
+}
+
+// Code 用于返回错误码, 协议错误的错误码与redis一致, 都是 ERR
+func (e *LimitError) Code() string {
+	return reply.CodeErr
+}
+
+// Bytes 用于返回协议错误回复, 与redis一致, 例如 -ERR Protocol error: 'invalid bulk length'\r\n
+func (e *LimitError) Bytes() []byte {
+	return reply.NewProtocolErrReply("invalid " + e.Limit).Bytes()
+}
@@ -0,0 +1,101 @@
+package parser
+
+import (
+	"errors"
+	"strings"
+	"testing"
+)
+
+func TestDecoderLimits(t *testing.T) {
+	opts := &Options{MaxBulkLen: 16, MaxMultiBulkLen: 4, MaxInlineLen: 32, MaxNestingDepth: 3}
+	tests := []struct {
+		data  string
+		limit string
+	}{
+		{"$9999999999\r\n", "bulk length"},
+		{"*2000000000\r\n", "multibulk length"},
+		{"*1\r\n*5\r\n", "multibulk length"},
+		{"*1\r\n$17\r\n", "bulk length"},
+		{"PING " + strings.Repeat("x", 64) + "\r\n", "inline length"},
+		{"+" + strings.Repeat("x", 8192) + "\r\n", "inline length"},
+		{"*1\r\n*1\r\n*1\r\n*1\r\n:1\r\n", "nesting depth"},
+		{"|1\r\n+a\r\n+b\r\n|1\r\n+a\r\n+b\r\n>1\r\n*1\r\n:1\r\n", "nesting depth"},
+	}
+	for _, tt := range tests {
+		decoder := NewDecoderWithOptions(strings.NewReader(tt.data+"+OK\r\n"), opts)
+		_, err := decoder.Next()
+		var limitErr *LimitError
+		if !errors.As(err, &limitErr) || limitErr.Limit != tt.limit {
+			t.Errorf("%q: expected %s limit error, actually %v", tt.data, tt.limit, err)
+			continue
+		}
+		// 超过限制之后不再继续解析
+		var sticky *LimitError
+		if _, err = decoder.Next(); !errors.As(err, &sticky) || sticky != limitErr {
+			t.Errorf("%q: expected sticky limit error, actually %v", tt.data, err)
+		}
+	}
+}
+
+func TestDecoderNextCmdLineLimits(t *testing.T) {
+	opts := &Options{MaxBulkLen: 4, MaxMultiBulkLen: 2}
+	decoder := NewDecoderWithOptions(strings.NewReader("*3\r\n$3\r\nSET\r\n"), opts)
+	var limitErr *LimitError
+	if _, err := decoder.NextCmdLine(nil); !errors.As(err, &limitErr) {
+		t.Errorf("expected limit error, actually %v", err)
+	}
+	decoder = NewDecoderWithOptions(strings.NewReader("*2\r\n$5\r\nhello\r\n"), opts)
+	if _, err := decoder.NextCmdLine(nil); !errors.As(err, &limitErr) {
+		t.Errorf("expected limit error, actually %v", err)
+	}
+}
+
+func TestParseStreamWithOptionsCloses(t *testing.T) {
+	ch := ParseStreamWithOptions(strings.NewReader("$9999999999\r\n+OK\r\n"), nil)
+	payload := <-ch
+	var limitErr *LimitError
+	if !errors.As(payload.Err, &limitErr) {
+		t.Fatalf("expected limit error, actually %v", payload)
+	}
+	if string(limitErr.Bytes()) == "" {
+		t.Errorf("expected protocol error reply")
+	}
+	if _, ok := <-ch; ok {
+		t.Errorf("expected channel to be closed")
+	}
+}
+
+func TestDecoderLargeBulk(t *testing.T) {
+	value := strings.Repeat("v", 200*1024)
+	decoder := NewDecoder(strings.NewReader("$" + "204800" + "\r\n" + value + "\r\n"))
+	res, err := decoder.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(res.Bytes()) != len(value)+len("$204800\r\n\r\n") {
+		t.Errorf("unexpected reply length %d", len(res.Bytes()))
+	}
+
+	// 数据不完整时不会根据头部一次性分配内存
+	decoder = NewDecoder(strings.NewReader("$536870912\r\nabc"))
+	if _, err = decoder.Next(); err == nil {
+		t.Errorf("expected unexpected EOF")
+	}
+}
+
+func TestDecoderDefaultNestingDepth(t *testing.T) {
+	// 没有限制时百万层的嵌套会耗尽goroutine的栈
+	data := strings.Repeat("*1\r\n", 1000000) + ":1\r\n"
+	decoder := NewDecoder(strings.NewReader(data))
+	_, err := decoder.Next()
+	var limitErr *LimitError
+	if !errors.As(err, &limitErr) || limitErr.Limit != "nesting depth" || limitErr.Max != DefaultMaxNestingDepth {
+		t.Errorf("expected nesting depth limit error, actually %v", err)
+	}
+
+	// 限制之内的嵌套可以正常解析
+	data = strings.Repeat("*1\r\n", DefaultMaxNestingDepth) + ":1\r\n"
+	if _, err = NewDecoder(strings.NewReader(data)).Next(); err != nil {
+		t.Errorf("expected %d levels to be parsed, actually %v", DefaultMaxNestingDepth, err)
+	}
+}
@@ -1,16 +1,20 @@
 package parser
 
 import (
-	"bufio"
-	"go-redis/interface/resp"
+	"context"
+	"fmt"
 	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
 	"godis-lib/lib/logger"
 	"godis-lib/lib/utils"
 	"godis-lib/resp/reply"
 	"io"
+	"math"
+	"math/big"
 	"runtime/debug"
 	"strconv"
 	"strings"
+	"time"
 )
 
 // Payload 用于表示解析后的数据
@@ -19,232 +23,138 @@ type Payload struct {
 	Err  error      // 表示解析过程中的错误
 }
 
-// readState 用于表示读取状态
-type readState struct {
-	readingMultiline  bool       // 表示是否正在读取多行数据
-	expectedArgsCount int        // 表示期望的参数个数
-	msgType           byte       // 表示消息类型
-	args              db.CmdLine // 表示已解析的参数
-	bulkLen           int64      // 表示一行数据的长度
+// ParseStream 用于解析RESP协议, 并返回解析后的数据
+//
+// 该函数会启动一个goroutine, 用于解析RESP协议
+//
+// 返回一个通道, 该通道会返回解析后的数据
+func ParseStream(rd io.Reader) <-chan *Payload {
+	return ParseStreamContext(context.Background(), rd, nil)
 }
 
-// finished 用于判断是否已经读取完毕
+// ParseStreamWithOptions 与 ParseStream 相同, 但是使用opts限制输入的数据
 //
-// 如果期望的参数个数大于0, 且已经读取的参数个数等于期望的参数个数, 则表示已经读取完毕
-func (rs *readState) finished() bool {
-	return rs.expectedArgsCount > 0 && len(rs.args) == rs.expectedArgsCount
+// 如果输入超过了限制, 通道会收到一个 *LimitError, 然后被关闭
+func ParseStreamWithOptions(rd io.Reader, opts *Options) <-chan *Payload {
+	return ParseStreamContext(context.Background(), rd, opts)
 }
 
-// ParseStream 用于解析RESP协议, 并返回解析后的数据
+// ParseStreamContext 与 ParseStreamWithOptions 相同, 但是可以通过ctx停止解析
 //
-// 该函数会启动一个goroutine, 用于解析RESP协议
+// ctx 被取消之后, 解析的goroutine会退出并关闭通道, 即使消费者已经不再读取通道;
+// 如果rd实现了 SetReadDeadline (例如 net.Conn), 阻塞中的读取会被立即打断,
+// 否则goroutine会在当前的读取返回之后退出
 //
-// 返回一个通道, 该通道会返回解析后的数据
-func ParseStream(rd io.Reader) <-chan *Payload {
-	ch := make(chan *Payload)
-	go parse0(rd, ch)
+// opts.BufferSize 用于设置通道的缓冲区大小, 在流水线(pipeline)中可以减少解析和执行之间的等待
+//
+// 如果设置了 opts.StreamBulkLen, 通道中可能会收到 *BulkStream, 消费者关闭之后才会继续解析
+func ParseStreamContext(ctx context.Context, rd io.Reader, opts *Options) <-chan *Payload {
+	decoder := NewDecoderWithOptions(rd, opts)
+	ch := make(chan *Payload, decoder.opts.BufferSize)
+	go parse0(ctx, rd, decoder, ch)
 	return ch
 }
 
+// deadlineSetter 是可以设置读取截止时间的读取器, 例如 net.Conn
+type deadlineSetter interface {
+	SetReadDeadline(t time.Time) error
+}
+
 // parse0 用于解析RESP协议, 并将解析后的数据发送到通道中
-func parse0(r io.Reader, ch chan<- *Payload) {
+func parse0(ctx context.Context, rd io.Reader, decoder *Decoder, ch chan<- *Payload) {
+	defer close(ch)
 	defer func() { // 如果解析过程中发生异常
 		if err := recover(); err != nil { // 捕获异常
 			logger.Error(utils.Bytes2String(debug.Stack()))
+			send(ctx, ch, &Payload{Err: fmt.Errorf("parser panic: %v", err)})
 		}
 	}()
 
-	br := bufio.NewReader(r)
-
-	var (
-		rs  readState
-		err error
-		msg []byte
-	)
+	if ds, ok := rd.(deadlineSetter); ok { // 取消时打断阻塞中的读取
+		stop := context.AfterFunc(ctx, func() {
+			_ = ds.SetReadDeadline(time.Now())
+		})
+		defer stop()
+	}
 
 	for { // 循环读取数据
-		var hasIOErr bool
-		if msg, hasIOErr, err = readLine(br, &rs); err != nil { // 读取一行数据
-			if hasIOErr { // 如果是IO错误, 则关闭通道, 并退出循环
-				ch <- &Payload{Err: err}
-				close(ch)
+		res, err := decoder.Next()
+		if ctx.Err() != nil { // 已经取消, 丢弃读取的结果
+			return
+		}
+		if err == nil {
+			if !send(ctx, ch, &Payload{Data: res}) {
 				return
 			}
-			ch <- &Payload{Err: err} // 如果是协议错误, 则发送错误信息到通道中
-			rs = readState{}         // 重置读取状态
+			if stream, ok := res.(*BulkStream); ok { // 等待消费者读取完数据流
+				select {
+				case <-stream.done:
+				case <-ctx.Done():
+					return
+				}
+			}
 			continue
 		}
 
-		if len(msg) == 0 || msg[0] == '\n' || msg[0] == '\r' { // 如果读取到的数据为空或者是空行, 则继续读取
-			continue
-		}
-
-		if !rs.readingMultiline { // 如果是初始读取或者不是处于多行数据读取状态
-			if msg[0] == '*' { // 如果是多行数据的头部
-				err = parseMultiBulkHeader(msg, &rs) // 解析多行数据的头部
-
-				if err != nil {
-					send(&rs, ch, err, nil)
-					continue
-				}
-				if rs.expectedArgsCount == 0 { // 如果参数个数为0, 则发送空的多行数据到通道中
-					send(&rs, ch, nil, reply.NewEmptyMultiBulkReply())
-					continue
-				}
-			} else if msg[0] == '$' { // 如果是一行数据的头部
-				err = parseBulkHeader(msg, &rs) // 解析一行数据的头部
-
-				if err != nil {
-					send(&rs, ch, err, nil)
-					continue
-				}
-				if rs.bulkLen == -1 {
-					send(&rs, ch, nil, reply.NewNullBulkReply())
-					continue
-				}
-			} else { // 解析单行数据
-				res, err := parseSingleLineReply(msg)
-				send(&rs, ch, err, res)
-				continue
-			}
-		} else {
-			err = readBody(msg, &rs)
-			if err != nil {
-				send(&rs, ch, err, nil)
-				continue
-			}
-			if rs.finished() {
-				var result resp.Reply
-				switch rs.msgType {
-				case '*':
-					result = reply.NewMultiBulkReply(rs.args)
-				case '$':
-					result = reply.NewBulkReply(rs.args[0])
-				}
-				send(&rs, ch, nil, result)
-			}
+		// 如果是协议错误, 则发送错误信息到通道中, 从下一行继续解析
+		// 如果是IO错误或者超过了限制, 则关闭通道, 并退出循环
+		if !send(ctx, ch, &Payload{Err: err}) || !isProtocolErr(err) {
+			return
 		}
 	}
 }
 
-// send 用于将解析后的数据发送到通道中
-//
-// rs 表示读取状态,
-// ch 表示通道,
-// err 表示错误,
-// data 表示数据
-func send(rs *readState, ch chan<- *Payload, err error, data resp.Reply) {
-	ch <- &Payload{data, err}
-	*rs = readState{}
-}
-
-// readLine 用于读取一行数据
-//
-// 如果没有$开头, 则表示以\r\n结尾读取一行数据
-//
-// 如果有$开头, 则表示严格按照bulkLen+2字节数读取数据
-func readLine(br *bufio.Reader, rs *readState) (line []byte, hasIOErr bool, err error) {
-	lineStr := utils.Bytes2String(line)
-
-	if rs.bulkLen == 0 { // 如果没有$开头, 则表示以\r\n结尾读取一行数据
-		line, err = br.ReadBytes('\n')
-		if err == io.EOF {
-			return nil, true, err
-		}
-
-		if err != nil {
-			logger.Error("readLine error:", lineStr)
-			return nil, true, err
-		}
-
-		if len(line) == 0 || line[len(line)-2] != '\r' { // 如果数据不以回车换行符结尾, 则返回错误
-			logger.Error("readLine error:", lineStr)
-			return nil, false, reply.NewProtocolErrReply(lineStr)
-		}
-
-	} else { // 如果有$开头, 则表示严格按照bulkLen+2字节数读取数据
-		line = make([]byte, rs.bulkLen+2)
-		_, err = io.ReadFull(br, line)
-
-		if err != nil {
-			return nil, true, err
-		}
-
-		if len(line) == 0 || line[len(line)-2] != '\r' || line[len(line)-1] != '\n' { // 如果数据不以回车换行符结尾, 则返回错误
-			return nil, false, reply.NewProtocolErrReply(lineStr)
-		}
-
-		rs.bulkLen = 0 // 重置bulkLen
+// send 用于将解析后的数据发送到通道中, 如果ctx已经取消则返回false
+func send(ctx context.Context, ch chan<- *Payload, payload *Payload) bool {
+	select {
+	case ch <- payload:
+		return true
+	case <-ctx.Done():
+		return false
 	}
-
-	return line, false, nil
 }
 
-// parseMultiBulkHeader 用于解析多行数据的头部
-//
-// 例如: *3\r\n
-//
-//	$3\r\n
-//	SET\r\n
-//	$3\r\n
-//	key\r\n
-//	$5\r\n
-//	value\r\n
-func parseMultiBulkHeader(msg []byte, rs *readState) (err error) {
-	rs.expectedArgsCount, err = strconv.Atoi(utils.Bytes2String(msg[1 : len(msg)-2]))
-
-	msgStr := utils.Bytes2String(msg)
-	if err != nil {
-		return reply.NewProtocolErrReply(msgStr)
+// isTypeByte 用于判断是否是resp的类型标识
+func isTypeByte(b byte) bool {
+	switch b {
+	case '$', '!', '=', '*', '%', '~', '>', '|', '+', '-', ':', ',', '#', '_', '(':
+		return true
 	}
-	// err = nil
-	if rs.expectedArgsCount > 0 { // 如果参数个数大于0
-		rs.readingMultiline = true                          // 表示正在读取多行数据
-		rs.msgType = msg[0]                                 // 保存消息类型
-		rs.args = make(db.CmdLine, 0, rs.expectedArgsCount) // 初始化参数列表
-	} else if rs.expectedArgsCount < 0 {
-		rs.expectedArgsCount = 0
-		err = reply.NewProtocolErrReply(msgStr)
-	} // else rs.expectedArgsCount == 0, 不需要做操作, 调用此函数之后会做判断
-
-	return err
+	return false
 }
 
-// parseBulkHeader 用于解析一行数据的头部
+// parseBulkHeader 用于解析一行数据的头部, 返回数据的长度, -1表示空值
 //
 // 例如: $4\r\nPING\r\n
-func parseBulkHeader(msg []byte, rs *readState) (err error) {
-	rs.bulkLen, err = strconv.ParseInt(string(msg[1:len(msg)-2]), 10, 64)
-
-	msgStr := utils.Bytes2String(msg)
-	if err != nil || rs.bulkLen < -1 {
-		return reply.NewProtocolErrReply(msgStr)
+func parseBulkHeader(msg []byte) (bulkLen int64, err error) {
+	bulkLen, err = strconv.ParseInt(utils.Bytes2String(msg[1:len(msg)-2]), 10, 64)
+	if err != nil || bulkLen < -1 {
+		return 0, reply.NewProtocolErrReply(string(msg))
 	}
-	// err = nil
-	if rs.bulkLen > 0 { // 如果bulkLen大于0, 则表示需要读取bulkLen+2字节数据
-		rs.msgType = msg[0]
-		rs.readingMultiline = true
-		rs.args = make(db.CmdLine, 0, 1)
-		rs.expectedArgsCount = 1
-	} else if rs.bulkLen != -1 {
-		err = reply.NewProtocolErrReply(msgStr)
-	} // else rs.bulkLen == -1, 不需要做操作, 调用此函数的之后会做判断
+	return bulkLen, nil
+}
 
-	return err
+// parseLength 用于解析聚合类型的头部中的元素个数
+//
+// 例如: *3\r\n
+func parseLength(header []byte) (int, error) {
+	return strconv.Atoi(utils.Bytes2String(header[1 : len(header)-2]))
 }
 
 // parseSingleLineReply 用于解析单行回复
 //
 // 例如: +OK\r\n, -ERR\r\n, :1000\r\n
+//
+// RESP3: ,1.23\r\n, #t\r\n, _\r\n, (12345678901234567890\r\n
 func parseSingleLineReply(msg []byte) (res resp.Reply, err error) {
-	// 去除开头的标示和末尾的\r\n
-	content := strings.TrimSuffix(utils.Bytes2String(msg), enum.CRLF)[1:]
+	// 去除开头的标示和末尾的\r\n, msg可能引用解码器的缓冲区, 因此需要复制
+	content := strings.Clone(strings.TrimSuffix(utils.Bytes2String(msg), enum.CRLF)[1:])
 
 	switch msg[0] {
 	case '+': // 如果是+开头, 则表示是状态回复
 		res = reply.NewStatusReply(content)
 	case '-': // 如果是-开头, 则表示是错误回复
-		res = reply.NewErrReply(strings.TrimPrefix(content, "ERR "))
+		res = reply.ParseErrReply(content)
 	case ':': // 如果是:开头, 则表示是整数回复
 		var code int64
 		code, err = strconv.ParseInt(content, 10, 64)
@@ -254,32 +164,92 @@ func parseSingleLineReply(msg []byte) (res resp.Reply, err error) {
 		}
 
 		res = reply.NewIntReply(code)
+	case ',': // 如果是,开头, 则表示是浮点数回复
+		var value float64
+		value, err = parseDouble(content)
+
+		if err != nil {
+			return nil, reply.NewProtocolErrReply(content)
+		}
+
+		res = reply.NewDoubleReply(value)
+	case '#': // 如果是#开头, 则表示是布尔回复
+		switch content {
+		case "t":
+			res = reply.NewBooleanReply(true)
+		case "f":
+			res = reply.NewBooleanReply(false)
+		default:
+			return nil, reply.NewProtocolErrReply(content)
+		}
+	case '_': // 如果是_开头, 则表示是空值
+		if content != "" {
+			return nil, reply.NewProtocolErrReply(content)
+		}
+
+		res = reply.NewNullReply()
+	case '(': // 如果是(开头, 则表示是大整数回复
+		value, ok := new(big.Int).SetString(content, 10)
+
+		if !ok {
+			return nil, reply.NewProtocolErrReply(content)
+		}
+
+		res = reply.NewBigNumberReply(value)
+	default: // 未知的类型标识
+		return nil, reply.NewProtocolErrReply(content)
 	}
 
 	return res, nil
 }
 
-// readBody 用于读取消息体
+// parseDouble 用于解析RESP3的浮点数, 支持inf, -inf和nan
+func parseDouble(content string) (float64, error) {
+	switch content {
+	case "inf":
+		return math.Inf(1), nil
+	case "-inf":
+		return math.Inf(-1), nil
+	case "nan":
+		return math.NaN(), nil
+	}
+	return strconv.ParseFloat(content, 64)
+}
+
+// parseVerbatim 用于解析原样字符串的内容
 //
-// 例如: $3\r\n
-// 例如: PING\r\n
-func readBody(msg []byte, rs *readState) (err error) {
-	line := msg[:len(msg)-2] // 去掉\r\n
+// 例如: txt:Some string
+func parseVerbatim(body []byte) (resp.Reply, error) {
+	if len(body) < 4 || body[3] != ':' {
+		return nil, reply.NewProtocolErrReply(utils.Bytes2String(body))
+	}
+	return reply.NewVerbatimReply(string(body[:3]), body[4:]), nil
+}
 
-	if line[0] == '$' { // exp. line = $3
-		rs.bulkLen, err = strconv.ParseInt(utils.Bytes2String(line[1:]), 10, 64)
+// toEntries 用于将交替排列的键和值转换为键值对
+func toEntries(elements []resp.Reply) []reply.MapEntry {
+	entries := make([]reply.MapEntry, 0, len(elements)/2)
+	for i := 0; i+1 < len(elements); i += 2 {
+		entries = append(entries, reply.MapEntry{Key: elements[i], Value: elements[i+1]})
+	}
+	return entries
+}
 
-		if err != nil {
-			return reply.NewProtocolErrReply(utils.Bytes2String(line))
-		}
-		// 如果bulkLen小于0, 则表示是空值
-		if rs.bulkLen <= 0 {
-			rs.args = append(rs.args, []byte{})
-			rs.bulkLen = 0
+// toMultiBulk 用于将数组元素转换为回复数组
+//
+// 如果所有元素都是回复字符串(例如客户端发送的命令), 则返回 reply.MultiBulkReply,
+// 否则返回 reply.MultiRawReply, 保留元素的原始类型
+func toMultiBulk(elements []resp.Reply) resp.Reply {
+	args := make(db.CmdLine, 0, len(elements))
+	for _, elem := range elements {
+		switch elem := elem.(type) {
+		case *reply.BulkReply:
+			args = append(args, elem.Arg)
+		case *reply.NullBulkReply: // 空值为nil, 与空字符串区分
+			args = append(args, nil)
+		default:
+			return reply.NewMultiRawReply(elements)
 		}
-	} else { // exp. line = PING
-		rs.args = append(rs.args, line)
 	}
-
-	return nil
+	return reply.NewMultiBulkReply(args)
 }
@@ -0,0 +1,205 @@
+package parser
+
+import (
+	"bytes"
+	"context"
+	"io"
+	"net"
+	"strings"
+	"testing"
+	"time"
+
+	"godis-lib/resp/reply"
+)
+
+func TestParseStreamResp3(t *testing.T) {
+	data := []byte(",3.14\r\n" +
+		"#t\r\n" +
+		"_\r\n" +
+		"(3492890328409238509324850943850943825024385\r\n" +
+		"!21\r\nSYNTAX invalid syntax\r\n" +
+		"=15\r\ntxt:Some string\r\n" +
+		"%2\r\n+first\r\n:1\r\n$6\r\nsecond\r\n,2.5\r\n" +
+		"~2\r\n+a\r\n+b\r\n" +
+		">3\r\n$7\r\nmessage\r\n$7\r\nchannel\r\n$5\r\nhello\r\n" +
+		"|1\r\n+key-popularity\r\n%1\r\n$1\r\na\r\n,0.1923\r\n:2039123\r\n")
+
+	var payloads []*Payload
+	for payload := range ParseStream(bytes.NewReader(data)) {
+		payloads = append(payloads, payload)
+	}
+	// 最后一个是EOF
+	if len(payloads) != 11 {
+		t.Fatalf("expected 11 payloads, actually %d", len(payloads))
+	}
+	for i, payload := range payloads[:10] {
+		if payload.Err != nil {
+			t.Fatalf("payload %d: %v", i, payload.Err)
+		}
+	}
+
+	if r, ok := payloads[0].Data.(*reply.DoubleReply); !ok || r.Value() != 3.14 {
+		t.Errorf("expected double 3.14, actually %q", payloads[0].Data.Bytes())
+	}
+	if r, ok := payloads[1].Data.(*reply.BooleanReply); !ok || !r.Value() {
+		t.Errorf("expected boolean true, actually %q", payloads[1].Data.Bytes())
+	}
+	if _, ok := payloads[2].Data.(*reply.NullReply); !ok {
+		t.Errorf("expected null, actually %q", payloads[2].Data.Bytes())
+	}
+	if r, ok := payloads[3].Data.(*reply.BigNumberReply); !ok || r.Value().String() != "3492890328409238509324850943850943825024385" {
+		t.Errorf("expected big number, actually %q", payloads[3].Data.Bytes())
+	}
+	if r, ok := payloads[4].Data.(*reply.BlobErrReply); !ok || r.Error() != "SYNTAX invalid syntax" {
+		t.Errorf("expected blob error, actually %q", payloads[4].Data.Bytes())
+	}
+	if r, ok := payloads[5].Data.(*reply.VerbatimReply); !ok || r.Format != "txt" || string(r.Text) != "Some string" {
+		t.Errorf("expected verbatim string, actually %q", payloads[5].Data.Bytes())
+	}
+	if r, ok := payloads[6].Data.(*reply.MapReply); !ok || len(r.Entries) != 2 {
+		t.Errorf("expected map with 2 entries, actually %q", payloads[6].Data.Bytes())
+	}
+	if r, ok := payloads[7].Data.(*reply.SetReply); !ok || len(r.Members) != 2 {
+		t.Errorf("expected set with 2 members, actually %q", payloads[7].Data.Bytes())
+	}
+	if r, ok := payloads[8].Data.(*reply.PushReply); !ok || len(r.Replies) != 3 {
+		t.Errorf("expected push with 3 elements, actually %q", payloads[8].Data.Bytes())
+	}
+	if r, ok := payloads[9].Data.(*reply.AttributeReply); !ok || len(r.Attributes.Entries) != 1 {
+		t.Errorf("expected attribute, actually %q", payloads[9].Data.Bytes())
+	}
+
+	// 编码后应该与原始数据一致
+	var buf bytes.Buffer
+	for _, payload := range payloads[:10] {
+		buf.Write(payload.Data.Bytes())
+	}
+	if !bytes.Equal(buf.Bytes(), data) {
+		t.Errorf("expected %q, actually %q", data, buf.Bytes())
+	}
+}
+
+func TestParseStreamNestedArray(t *testing.T) {
+	// SCAN 的回复: 游标和键的数组
+	scan := "*2\r\n$1\r\n0\r\n*2\r\n$3\r\nfoo\r\n$0\r\n\r\n"
+	// EXEC 的回复: 混合了整数, 空值和错误
+	exec := "*4\r\n:1\r\n$-1\r\n-ERR no such key\r\n*0\r\n"
+	cmd := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+
+	ch := ParseStream(bytes.NewReader([]byte(scan + exec + cmd)))
+
+	payload := <-ch
+	scanReply, ok := payload.Data.(*reply.MultiRawReply)
+	if !ok || len(scanReply.Replies) != 2 {
+		t.Fatalf("expected multi raw reply, actually %v", payload)
+	}
+	keys, ok := scanReply.Replies[1].(*reply.MultiBulkReply)
+	if !ok || len(keys.Args) != 2 || string(keys.Args[0]) != "foo" || len(keys.Args[1]) != 0 {
+		t.Errorf("expected keys [foo, ''], actually %q", scanReply.Replies[1].Bytes())
+	}
+
+	payload = <-ch
+	execReply, ok := payload.Data.(*reply.MultiRawReply)
+	if !ok || len(execReply.Replies) != 4 {
+		t.Fatalf("expected multi raw reply, actually %v", payload)
+	}
+	if string(execReply.Bytes()) != exec {
+		t.Errorf("expected %q, actually %q", exec, execReply.Bytes())
+	}
+	if !reply.IsErrReply(execReply.Replies[2]) {
+		t.Errorf("expected error reply, actually %q", execReply.Replies[2].Bytes())
+	}
+
+	payload = <-ch
+	cmdReply, ok := payload.Data.(*reply.MultiBulkReply)
+	if !ok || len(cmdReply.Args) != 3 || string(cmdReply.Args[2]) != "value" {
+		t.Errorf("expected SET command, actually %v", payload)
+	}
+
+	if payload = <-ch; payload.Err == nil {
+		t.Errorf("expected EOF, actually %v", payload)
+	}
+}
+
+func TestParseStreamInline(t *testing.T) {
+	data := "PING\r\n\r\nset key \"hello world\"\nset 'it\\'s' \"\\x41\\n\"\r\n*1\r\n$4\r\nPING\r\nget \"key\r\n"
+	ch := ParseStream(bytes.NewReader([]byte(data)))
+
+	expected := [][]string{
+		{"PING"},
+		{"set", "key", "hello world"},
+		{"set", "it's", "A\n"},
+		{"PING"},
+	}
+	for _, args := range expected {
+		payload := <-ch
+		cmd, ok := payload.Data.(*reply.MultiBulkReply)
+		if !ok || len(cmd.Args) != len(args) {
+			t.Fatalf("expected %q, actually %v", args, payload)
+		}
+		for i, arg := range args {
+			if string(cmd.Args[i]) != arg {
+				t.Errorf("expected %q, actually %q", arg, cmd.Args[i])
+			}
+		}
+	}
+
+	// 引号不匹配是协议错误, 不会中断解析
+	if payload := <-ch; payload.Err == nil || payload.Data != nil {
+		t.Errorf("expected protocol error, actually %v", payload)
+	}
+	if payload := <-ch; payload.Err != io.EOF {
+		t.Errorf("expected EOF, actually %v", payload)
+	}
+}
+
+func TestParseStreamContextCancelRead(t *testing.T) {
+	server, client := net.Pipe()
+	defer client.Close()
+
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := ParseStreamContext(ctx, server, nil)
+	go func() {
+		_, _ = client.Write([]byte("+OK\r\n"))
+	}()
+	if payload := <-ch; payload.Err != nil {
+		t.Fatal(payload.Err)
+	}
+
+	// 解析的goroutine阻塞在读取上, 取消之后通道会被关闭
+	cancel()
+	select {
+	case _, ok := <-ch:
+		if ok {
+			t.Errorf("expected channel to be closed")
+		}
+	case <-time.After(time.Second):
+		t.Errorf("parser goroutine did not exit")
+	}
+}
+
+func TestParseStreamContextCancelSend(t *testing.T) {
+	data := strings.Repeat("+OK\r\n", 10)
+	ctx, cancel := context.WithCancel(context.Background())
+	ch := ParseStreamContext(ctx, strings.NewReader(data), &Options{BufferSize: 3})
+
+	// 没有消费者时, 解析的goroutine最多可以写入缓冲区大小的数据
+	time.Sleep(10 * time.Millisecond)
+	if len(ch) != 3 {
+		t.Errorf("expected 3 buffered payloads, actually %d", len(ch))
+	}
+
+	// 慢消费者不会让解析的goroutine永远阻塞
+	cancel()
+	deadline := time.After(time.Second)
+	for {
+		select {
+		case _, ok := <-ch:
+			if !ok {
+				return
+			}
+		case <-deadline:
+			t.Fatalf("parser goroutine did not exit")
+		}
+	}
+}
@@ -0,0 +1,152 @@
+package parser
+
+import (
+	"io"
+	"strconv"
+	"strings"
+
+	"godis-lib/interface/db"
+	"godis-lib/lib/utils"
+	"godis-lib/resp/reply"
+)
+
+// PsyncReply 表示主节点对 PSYNC 命令的回复
+type PsyncReply struct {
+	FullResync bool   // true表示全量同步(+FULLRESYNC), 之后需要通过 ReadRDB 读取RDB文件; false表示部分同步(+CONTINUE)
+	ReplID     string // 表示主节点的复制ID, +CONTINUE 没有携带复制ID时为空
+	Offset     int64  // 表示同步开始时的复制偏移量, 全量同步时即为RDB文件对应的偏移量
+}
+
+// ReplicationReader 用于在从节点中读取主节点发送的复制流, 包括:
+//
+//	+FULLRESYNC <replid> <offset>\r\n 或者 +CONTINUE [<replid>]\r\n
+//	$<len>\r\n<rdb>                   RDB文件之后没有\r\n
+//	*1\r\n$4\r\nPING\r\n...            命令流
+//
+// ReplicationReader 会记录命令流中每条命令占用的字节数, 用于维护从节点的 master_repl_offset,
+// 并通过 REPLCONF ACK <offset> 回复主节点
+//
+// 不支持无盘复制的 $EOF:<mark>\r\n 格式, 从节点不应该发送 REPLCONF capa eof
+//
+// ReplicationReader 不是并发安全的
+type ReplicationReader struct {
+	d      *Decoder
+	offset int64 // 表示已经处理的命令流对应的复制偏移量
+}
+
+// NewReplicationReader 用于创建从rd读取复制流的读取器, offset是从节点当前的复制偏移量, 用于部分同步
+func NewReplicationReader(rd io.Reader, offset int64) *ReplicationReader {
+	return NewReplicationReaderWithOptions(rd, offset, nil)
+}
+
+// NewReplicationReaderWithOptions 与 NewReplicationReader 相同, 但是使用opts限制输入的数据
+func NewReplicationReaderWithOptions(rd io.Reader, offset int64, opts *Options) *ReplicationReader {
+	return &ReplicationReader{
+		d:      NewDecoderWithOptions(rd, opts),
+		offset: offset,
+	}
+}
+
+// Offset 用于返回已经处理的命令对应的复制偏移量, 即从节点的 master_repl_offset
+func (r *ReplicationReader) Offset() int64 {
+	return r.offset
+}
+
+// ReadPsyncReply 用于读取主节点对 PSYNC 命令的回复, 主节点在回复之前发送的空行会被忽略
+//
+// 如果主节点返回错误, 例如 -NOMASTERLINK 或者 -LOADING, 返回对应的 resp.ErrorReply
+func (r *ReplicationReader) ReadPsyncReply() (*PsyncReply, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line[0] == '-' {
+		return nil, reply.ParseErrReply(string(trimCRLF(line[1:])))
+	}
+
+	fields := strings.Fields(utils.Bytes2String(trimCRLF(line)))
+	switch {
+	case len(fields) == 3 && fields[0] == "+FULLRESYNC":
+		offset, err := strconv.ParseInt(fields[2], 10, 64)
+		if err != nil {
+			return nil, r.d.protocolErr("+FULLRESYNC <replid> <offset>", trimCRLF(line))
+		}
+		r.offset = offset
+		return &PsyncReply{FullResync: true, ReplID: fields[1], Offset: offset}, nil
+	case len(fields) <= 2 && len(fields) > 0 && fields[0] == "+CONTINUE":
+		res := &PsyncReply{Offset: r.offset}
+		if len(fields) == 2 {
+			res.ReplID = fields[1]
+		}
+		return res, nil
+	}
+	return nil, r.d.protocolErr("+FULLRESYNC or +CONTINUE", trimCRLF(line))
+}
+
+// ReadRDB 用于读取全量同步时主节点发送的RDB文件, 主节点在生成RDB文件时发送的空行会被忽略
+//
+// 返回的数据流与 Decoder 返回的 *BulkStream 相同, 但是数据之后没有\r\n;
+// 下一次调用 NextCommand 时数据流会被关闭, RDB文件不计入复制偏移量
+func (r *ReplicationReader) ReadRDB() (*BulkStream, error) {
+	line, err := r.readLine()
+	if err != nil {
+		return nil, err
+	}
+	if line[0] != '$' {
+		return nil, r.d.protocolErr("'$'", trimCRLF(line))
+	}
+	size, err := r.d.parseBulkHeader(line)
+	if err != nil {
+		return nil, r.d.fail(err)
+	}
+	if size < 0 {
+		return nil, r.d.protocolErr("rdb length", trimCRLF(line))
+	}
+	stream := r.d.newStream(size)
+	stream.noCRLF = true
+	return stream, nil
+}
+
+// NextCommand 用于读取命令流中的下一条命令, 返回命令以及命令占用的字节数, 并累加到复制偏移量中
+//
+// 返回的命令不会被复用, 调用者可以直接保存
+func (r *ReplicationReader) NextCommand() (db.CmdLine, int64, error) {
+	if err := r.d.closeStream(); err != nil { // RDB文件不计入复制偏移量
+		return nil, 0, r.d.fail(err)
+	}
+	start := r.d.offset
+	cmdLine, err := r.d.NextCmdLine(nil)
+	size := r.d.offset - start
+	if err != nil {
+		return nil, size, err
+	}
+	r.offset += size
+	return cmdLine, size, nil
+}
+
+// readLine 用于读取一行回复, 忽略主节点用于保持连接的空行
+func (r *ReplicationReader) readLine() ([]byte, error) {
+	if r.d.err != nil {
+		return nil, r.d.err
+	}
+	if err := r.d.closeStream(); err != nil {
+		return nil, r.d.fail(err)
+	}
+	for {
+		first, err := r.d.peek()
+		if err != nil {
+			return nil, err
+		}
+		if first == '\n' || first == '\r' {
+			if _, err = r.d.readRawLine(); err != nil {
+				return nil, r.d.fail(err)
+			}
+			continue
+		}
+		line, err := r.d.readLine()
+		if err != nil {
+			return nil, r.d.fail(err)
+		}
+		return line, nil
+	}
+}
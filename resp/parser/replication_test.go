@@ -0,0 +1,105 @@
+package parser
+
+import (
+	"errors"
+	"io"
+	"strconv"
+	"strings"
+	"testing"
+
+	"godis-lib/interface/resp"
+)
+
+func TestReplicationReaderFullResync(t *testing.T) {
+	rdb := "REDIS0011\xfa\x09redis-ver\x057.2.4\xff\x00\x01\x02\x03\x04\x05\x06\x07"
+	ping := "*1\r\n$4\r\nPING\r\n"
+	set := "*3\r\n$3\r\nSET\r\n$3\r\nkey\r\n$5\r\nvalue\r\n"
+	data := "\n\n+FULLRESYNC 8de1787ba490483314a4d30f1c628bc5025eb761 1000\r\n" +
+		"\n\n\n$" + strconv.Itoa(len(rdb)) + "\r\n" + rdb + ping + set
+	r := NewReplicationReader(strings.NewReader(data), -1)
+
+	psync, err := r.ReadPsyncReply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if !psync.FullResync || psync.ReplID != "8de1787ba490483314a4d30f1c628bc5025eb761" || psync.Offset != 1000 {
+		t.Errorf("unexpected psync reply %+v", psync)
+	}
+
+	stream, err := r.ReadRDB()
+	if err != nil {
+		t.Fatal(err)
+	}
+	body, err := io.ReadAll(stream)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if string(body) != rdb {
+		t.Errorf("expected %q, actually %q", rdb, body)
+	}
+
+	for _, expected := range []struct {
+		cmd    string
+		size   int
+		offset int64
+	}{
+		{"PING", len(ping), 1000 + int64(len(ping))},
+		{"SET", len(set), 1000 + int64(len(ping)+len(set))},
+	} {
+		cmdLine, size, err := r.NextCommand()
+		if err != nil {
+			t.Fatal(err)
+		}
+		if string(cmdLine[0]) != expected.cmd || size != int64(expected.size) || r.Offset() != expected.offset {
+			t.Errorf("expected %s (%d bytes, offset %d), actually %q (%d bytes, offset %d)",
+				expected.cmd, expected.size, expected.offset, cmdLine, size, r.Offset())
+		}
+	}
+	if _, _, err = r.NextCommand(); err != io.EOF {
+		t.Errorf("expected EOF, actually %v", err)
+	}
+}
+
+func TestReplicationReaderContinue(t *testing.T) {
+	r := NewReplicationReader(strings.NewReader("+CONTINUE\r\n*1\r\n$4\r\nPING\r\n"), 500)
+	psync, err := r.ReadPsyncReply()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if psync.FullResync || psync.Offset != 500 {
+		t.Errorf("unexpected psync reply %+v", psync)
+	}
+	// 未读取的RDB文件不计入偏移量, 部分同步没有RDB文件
+	if _, size, err := r.NextCommand(); err != nil || size != 14 || r.Offset() != 514 {
+		t.Errorf("expected PING at offset 514, actually %d %d %v", size, r.Offset(), err)
+	}
+
+	r = NewReplicationReader(strings.NewReader("-NOMASTERLINK Can't SYNC while not connected with my master\r\n"), 0)
+	_, err = r.ReadPsyncReply()
+	var errReply resp.ErrorReply
+	if !errors.As(err, &errReply) || !strings.HasPrefix(errReply.Error(), "NOMASTERLINK") {
+		t.Errorf("expected NOMASTERLINK, actually %v", err)
+	}
+
+	r = NewReplicationReader(strings.NewReader("+FULLRESYNC abc\r\n"), 0)
+	var protoErr *ProtocolError
+	if _, err = r.ReadPsyncReply(); !errors.As(err, &protoErr) {
+		t.Errorf("expected protocol error, actually %v", err)
+	}
+}
+
+func TestReplicationReaderSkipRDB(t *testing.T) {
+	data := "+FULLRESYNC id 0\r\n$10\r\n0123456789*1\r\n$4\r\nPING\r\n"
+	r := NewReplicationReader(strings.NewReader(data), 0)
+	if _, err := r.ReadPsyncReply(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err := r.ReadRDB(); err != nil {
+		t.Fatal(err)
+	}
+	// 没有读取的RDB文件会被丢弃
+	cmdLine, size, err := r.NextCommand()
+	if err != nil || string(cmdLine[0]) != "PING" || size != 14 || r.Offset() != 14 {
+		t.Errorf("expected PING at offset 14, actually %q %d %d %v", cmdLine, size, r.Offset(), err)
+	}
+}
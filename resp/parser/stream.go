@@ -0,0 +1,144 @@
+package parser
+
+import (
+	"io"
+	"strconv"
+
+	"godis-lib/interface/resp"
+	"godis-lib/resp/reply"
+)
+
+// BulkStream 表示以流的形式传递的回复字符串, 数据直接从底层的连接中读取, 不会缓存在内存中
+//
+// 当 Options.StreamBulkLen 大于0时, 长度超过该值的顶层回复字符串由 Decoder.Next 或 ParseStream 以 *BulkStream 返回,
+// 例如 DUMP 的回复或者主从复制中传输的RDB文件, 存储层可以直接将数据写入磁盘:
+//
+//	if stream, ok := payload.Data.(*parser.BulkStream); ok {
+//		_, err := io.Copy(file, stream)
+//		stream.Close()
+//	}
+//
+// 与 http.Response.Body 类似, 使用完毕之后必须调用 Close, 否则 ParseStream 不会继续解析;
+// 使用 Decoder 时, 下一次调用 Next 会自动关闭之前的数据流, 未读取的数据会被丢弃
+//
+// BulkStream 不是并发安全的
+type BulkStream struct {
+	d         *Decoder
+	size      int64 // 表示数据的长度
+	remaining int64 // 表示未读取的数据的长度
+	start     int64 // 表示数据在数据流中的偏移量
+	noCRLF    bool  // 表示数据之后没有\r\n, 例如主从复制中传输的RDB文件
+
+	closed bool
+	err    error
+	body   []byte        // 缓存 Bytes 的结果
+	done   chan struct{} // 关闭之后通知 ParseStream 继续解析
+}
+
+// newStream 用于创建一个从当前位置开始读取size字节的数据流, 同一时刻只能有一个未关闭的数据流
+func (d *Decoder) newStream(size int64) *BulkStream {
+	d.stream = &BulkStream{
+		d:         d,
+		size:      size,
+		remaining: size,
+		start:     d.offset,
+		done:      make(chan struct{}),
+	}
+	return d.stream
+}
+
+// closeStream 用于关闭未关闭的数据流
+func (d *Decoder) closeStream() error {
+	if d.stream == nil {
+		return nil
+	}
+	stream := d.stream
+	d.stream = nil
+	return stream.Close()
+}
+
+// sinkStream 用于将数据流交给 Options.BulkSink 处理, 返回 BulkSink 返回的回复
+func (d *Decoder) sinkStream(size int64) (resp.Reply, error) {
+	res, err := d.opts.BulkSink(d.newStream(size))
+	if err != nil { // 数据流在一帧的中间, 无法继续解析
+		d.stream = nil
+		d.err = err
+		return nil, err
+	}
+	if err = d.closeStream(); err != nil {
+		return nil, err
+	}
+	return res, nil
+}
+
+// Len 用于返回数据的长度, 不包含\r\n
+func (s *BulkStream) Len() int64 {
+	return s.size
+}
+
+// Read 用于读取数据, 数据读取完毕之后返回io.EOF
+//
+// 如果连接在数据读取完毕之前断开, 返回 io.ErrUnexpectedEOF
+func (s *BulkStream) Read(p []byte) (n int, err error) {
+	if s.remaining <= 0 {
+		return 0, io.EOF
+	}
+	if int64(len(p)) > s.remaining {
+		p = p[:s.remaining]
+	}
+	n, err = s.d.br.Read(p)
+	s.remaining -= int64(n)
+	s.d.offset += int64(n)
+	if err == io.EOF {
+		err = io.ErrUnexpectedEOF
+	}
+	return n, err
+}
+
+// Close 用于丢弃未读取的数据, 并检查数据之后的\r\n, 重复调用返回相同的结果
+//
+// 如果数据之后不是\r\n, 返回 *ProtocolError
+func (s *BulkStream) Close() error {
+	if s.closed {
+		return s.err
+	}
+	s.closed = true
+	defer close(s.done)
+
+	if _, err := io.Copy(io.Discard, s); err != nil {
+		s.err = err
+		s.d.err = err
+		return err
+	}
+	if s.noCRLF {
+		return nil
+	}
+
+	var tail [2]byte
+	n, err := io.ReadFull(s.d.br, tail[:])
+	s.d.offset += int64(n)
+	if err != nil {
+		if err == io.EOF {
+			err = io.ErrUnexpectedEOF
+		}
+		s.err = err
+		s.d.err = err
+		return err
+	}
+	if tail[0] != '\r' || tail[1] != '\n' { // 如果数据不以回车换行符结尾, 则返回错误
+		s.err = s.d.protocolErrAt(s.start+s.size, "CRLF after "+strconv.FormatInt(s.size, 10)+" bytes", tail[:])
+	}
+	return s.err
+}
+
+// Bytes 用于将未读取的数据读取到内存中, 并编码为回复字符串, 之后数据流会被关闭
+//
+// 只应该在数据流没有被读取时调用, 例如将回复原样转发给客户端, 否则会失去流式读取的意义
+func (s *BulkStream) Bytes() []byte {
+	if s.body == nil {
+		body, _ := io.ReadAll(s)
+		_ = s.Close()
+		s.body = reply.NewBulkReply(body).Bytes()
+	}
+	return s.body
+}
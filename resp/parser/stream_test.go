@@ -0,0 +1,148 @@
+package parser
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+
+	"godis-lib/interface/resp"
+	"godis-lib/resp/reply"
+)
+
+func TestDecoderBulkStream(t *testing.T) {
+	value := strings.Repeat("x", 100)
+	data := "$3\r\nfoo\r\n$100\r\n" + value + "\r\n$100\r\n" + value + "\r\n:1\r\n"
+	decoder := NewDecoderWithOptions(strings.NewReader(data), &Options{StreamBulkLen: 10})
+
+	res, err := decoder.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if _, ok := res.(*reply.BulkReply); !ok {
+		t.Errorf("expected short bulk in memory, actually %T", res)
+	}
+
+	res, err = decoder.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stream, ok := res.(*BulkStream)
+	if !ok || stream.Len() != 100 {
+		t.Fatalf("expected bulk stream, actually %T", res)
+	}
+	var buf bytes.Buffer
+	if _, err = io.Copy(&buf, stream); err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != value {
+		t.Errorf("expected %q, actually %q", value, buf.String())
+	}
+	if err = stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+
+	// 未读取完的数据流在下一次调用 Next 时被丢弃
+	if res, err = decoder.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadFull(res.(*BulkStream), make([]byte, 10)); err != nil {
+		t.Fatal(err)
+	}
+	if res, err = decoder.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if r, ok := res.(*reply.IntReply); !ok || r.Code() != 1 {
+		t.Errorf("expected :1, actually %q", res.Bytes())
+	}
+	if decoder.Offset() != int64(len(data)) {
+		t.Errorf("expected offset %d, actually %d", len(data), decoder.Offset())
+	}
+}
+
+func TestDecoderBulkStreamErr(t *testing.T) {
+	decoder := NewDecoderWithOptions(strings.NewReader("$20\r\n0123456789012345678901:1\r\n"), &Options{StreamBulkLen: 10})
+	res, err := decoder.Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	var protoErr *ProtocolError
+	if err = res.(*BulkStream).Close(); !errors.As(err, &protoErr) || protoErr.Offset != 25 {
+		t.Errorf("expected protocol error at offset 25, actually %v", err)
+	}
+
+	decoder = NewDecoderWithOptions(strings.NewReader("$20\r\n01234"), &Options{StreamBulkLen: 10})
+	if res, err = decoder.Next(); err != nil {
+		t.Fatal(err)
+	}
+	if _, err = io.ReadAll(res.(*BulkStream)); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, actually %v", err)
+	}
+	if _, err = decoder.Next(); err != io.ErrUnexpectedEOF {
+		t.Errorf("expected unexpected EOF, actually %v", err)
+	}
+}
+
+func TestDecoderBulkSink(t *testing.T) {
+	payload := strings.Repeat("p", 64)
+	data := "*4\r\n$7\r\nRESTORE\r\n$3\r\nkey\r\n$64\r\n" + payload + "\r\n$7\r\nREPLACE\r\n"
+	var spilled bytes.Buffer
+	opts := &Options{
+		StreamBulkLen: 16,
+		BulkSink: func(stream *BulkStream) (resp.Reply, error) {
+			n, err := io.Copy(&spilled, stream)
+			return reply.NewIntReply(n), err
+		},
+	}
+	res, err := NewDecoderWithOptions(strings.NewReader(data), opts).Next()
+	if err != nil {
+		t.Fatal(err)
+	}
+	cmd, ok := res.(*reply.MultiRawReply)
+	if !ok || len(cmd.Replies) != 4 {
+		t.Fatalf("expected 4 elements, actually %q", res.Bytes())
+	}
+	if r, ok := cmd.Replies[2].(*reply.IntReply); !ok || r.Code() != 64 {
+		t.Errorf("expected sink reply, actually %q", cmd.Replies[2].Bytes())
+	}
+	if string(cmd.Replies[3].Bytes()) != "$7\r\nREPLACE\r\n" {
+		t.Errorf("expected REPLACE, actually %q", cmd.Replies[3].Bytes())
+	}
+	if spilled.String() != payload {
+		t.Errorf("expected %q, actually %q", payload, spilled.String())
+	}
+
+	sinkErr := errors.New("disk full")
+	opts.BulkSink = func(stream *BulkStream) (resp.Reply, error) {
+		return nil, sinkErr
+	}
+	decoder := NewDecoderWithOptions(strings.NewReader(data), opts)
+	if _, err = decoder.Next(); err != sinkErr {
+		t.Errorf("expected sink error, actually %v", err)
+	}
+	if _, err = decoder.Next(); err != sinkErr {
+		t.Errorf("expected sticky sink error, actually %v", err)
+	}
+}
+
+func TestParseStreamBulkStream(t *testing.T) {
+	value := strings.Repeat("v", 4096)
+	data := "$4096\r\n" + value + "\r\n+OK\r\n"
+	ch := ParseStreamWithOptions(strings.NewReader(data), &Options{StreamBulkLen: 1024})
+
+	payload := <-ch
+	stream, ok := payload.Data.(*BulkStream)
+	if !ok {
+		t.Fatalf("expected bulk stream, actually %v", payload)
+	}
+	if string(stream.Bytes()) != "$4096\r\n"+value+"\r\n" {
+		t.Errorf("unexpected bytes %q", stream.Bytes()[:16])
+	}
+	if err := stream.Close(); err != nil {
+		t.Fatal(err)
+	}
+	if payload = <-ch; payload.Err != nil || string(payload.Data.Bytes()) != "+OK\r\n" {
+		t.Errorf("expected +OK, actually %v", payload)
+	}
+}
@@ -1,8 +1,14 @@
 package reply
 
 import (
-	"go-redis/interface/resp"
-	"go-redis/lib/utils"
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+)
+
+const (
+	nullBulkBytes       = "$-1" + crlf // 空值
+	emptyMultiBulkBytes = "*0" + crlf  // 空数组
+	nullMultiBulkBytes  = "*-1" + crlf // 空值数组, 例如 BLPOP 超时的回复
 )
 
 // 用于存储所有的回复, 使用懒加载的方式, 只有在需要的时候才会初始化且只会初始化一次
@@ -14,6 +20,7 @@ var (
 	theOKReply             *okReply
 	theNullBulkReply       *NullBulkReply
 	theEmptyMultiBulkReply *emptyMultiBulkReply
+	theNullMultiBulkReply  *nullMultiBulkReply
 	theNoReply             *noReply
 	theQueuedReply         *queuedReply
 )
@@ -21,6 +28,7 @@ var (
 func init() {
 	theNoReply = new(noReply)
 	theEmptyMultiBulkReply = new(emptyMultiBulkReply)
+	theNullMultiBulkReply = new(nullMultiBulkReply)
 	thePongReply = new(PongReply)
 	theOKReply = new(okReply)
 	theNullBulkReply = new(NullBulkReply)
@@ -28,10 +36,11 @@ func init() {
 
 	replies = map[resp.Reply][]byte{
 		theNoReply:             utils.String2Bytes(enum.NO_REPLY),
-		theEmptyMultiBulkReply: utils.String2Bytes(enum.EMPTY_BULK_REPLY),
+		theEmptyMultiBulkReply: utils.String2Bytes(emptyMultiBulkBytes),
+		theNullMultiBulkReply:  utils.String2Bytes(nullMultiBulkBytes),
 		thePongReply:           utils.String2Bytes(enum.PONG),
 		theOKReply:             utils.String2Bytes(enum.OK),
-		theNullBulkReply:       utils.String2Bytes(enum.NIL),
+		theNullBulkReply:       utils.String2Bytes(nullBulkBytes),
 		theQueuedReply:         queuedBytes,
 	}
 }
@@ -48,6 +57,19 @@ func (reply *PongReply) Bytes() []byte {
 	return replies[reply]
 }
 
+func (reply *PongReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *PongReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *PongReply) size(int) int {
+	return len(reply.Bytes())
+}
+
 // OKReply 用于表示OK的回复
 type okReply struct {
 }
@@ -61,6 +83,19 @@ func (reply *okReply) Bytes() []byte {
 	return replies[reply]
 }
 
+func (reply *okReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *okReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *okReply) size(int) int {
+	return len(reply.Bytes())
+}
+
 // nullBulkReply 用于表示空的回复字符串
 type NullBulkReply struct {
 }
@@ -74,6 +109,19 @@ func (reply *NullBulkReply) Bytes() []byte {
 	return replies[reply]
 }
 
+func (reply *NullBulkReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *NullBulkReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *NullBulkReply) size(int) int {
+	return len(reply.Bytes())
+}
+
 // emptyMultiBulkReply 用于表示空的多条批量回复数组
 type emptyMultiBulkReply struct {
 }
@@ -87,6 +135,45 @@ func (reply *emptyMultiBulkReply) Bytes() []byte {
 	return replies[reply]
 }
 
+func (reply *emptyMultiBulkReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *emptyMultiBulkReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *emptyMultiBulkReply) size(int) int {
+	return len(reply.Bytes())
+}
+
+// nullMultiBulkReply 用于表示空值数组 *-1\r\n, 与空数组 *0\r\n 不同
+type nullMultiBulkReply struct {
+}
+
+// NewNullMultiBulkReply 用于创建空值数组, 例如 BLPOP 超时或者 EXEC 因为 WATCH 失败时的回复
+func NewNullMultiBulkReply() resp.Reply {
+	return theNullMultiBulkReply
+}
+
+func (reply *nullMultiBulkReply) Bytes() []byte {
+	return replies[reply]
+}
+
+func (reply *nullMultiBulkReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *nullMultiBulkReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *nullMultiBulkReply) size(int) int {
+	return len(reply.Bytes())
+}
+
 // noReply 用于表示没有回复
 type noReply struct {
 }
@@ -99,12 +186,38 @@ func (reply *noReply) Bytes() []byte {
 	return replies[reply]
 }
 
+func (reply *noReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *noReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *noReply) size(int) int {
+	return len(reply.Bytes())
+}
+
 type queuedReply struct{}
 
 func (reply *queuedReply) Bytes() []byte {
 	return queuedBytes
 }
 
+func (reply *queuedReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *queuedReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *queuedReply) size(int) int {
+	return len(reply.Bytes())
+}
+
 var queuedBytes = []byte("+QUEUED\r\n")
 
 // NewQueuedReply returns a QUEUED protocol
@@ -0,0 +1,137 @@
+package reply
+
+import (
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+	"strings"
+)
+
+// 错误码, 即错误回复的第一个单词, 客户端根据错误码区分错误的类型
+const (
+	CodeErr       = "ERR"       // 表示一般错误
+	CodeWrongType = "WRONGTYPE" // 表示对错误类型的键执行命令
+	CodeNoAuth    = "NOAUTH"    // 表示需要认证
+	CodeNoPerm    = "NOPERM"    // 表示用户没有执行命令的权限
+	CodeExecAbort = "EXECABORT" // 表示事务因为之前的错误被放弃
+	CodeReadOnly  = "READONLY"  // 表示不能在只读的从节点上执行写命令
+	CodeLoading   = "LOADING"   // 表示正在加载数据
+	CodeBusy      = "BUSY"      // 表示正在执行脚本
+	CodeOOM       = "OOM"       // 表示内存超过 maxmemory
+	CodeCrossSlot = "CROSSSLOT" // 表示多个键不在同一个槽中
+	CodeMoved     = "MOVED"     // 表示槽已经迁移到其他节点
+	CodeAsk       = "ASK"       // 表示槽正在迁移, 需要到其他节点查询
+	CodeTryAgain  = "TRYAGAIN"  // 表示槽正在迁移, 需要稍后重试
+)
+
+// 各个错误码的哨兵值, 可以通过 errors.Is 判断错误回复的错误码, 例如
+//
+//	if errors.Is(err, reply.ErrWrongType) { ... }
+//
+// 错误码相同即认为相等, 与错误信息无关. ErrGeneric, ErrMoved 和 ErrAsk 没有错误信息, 只用于比较,
+// 重定向回复使用 NewMovedReply 和 NewAskReply 创建
+var (
+	ErrGeneric   = NewCodeErrReply(CodeErr, "")
+	ErrWrongType = NewCodeErrReply(CodeWrongType, "Operation against a key holding the wrong kind of value")
+	ErrNoAuth    = NewCodeErrReply(CodeNoAuth, "Authentication required.")
+	ErrNoPerm    = NewCodeErrReply(CodeNoPerm, "this user has no permissions to run this command")
+	ErrExecAbort = NewCodeErrReply(CodeExecAbort, "Transaction discarded because of previous errors.")
+	ErrReadOnly  = NewCodeErrReply(CodeReadOnly, "You can't write against a read only replica.")
+	ErrLoading   = NewCodeErrReply(CodeLoading, "Redis is loading the dataset in memory")
+	ErrBusy      = NewCodeErrReply(CodeBusy, "Redis is busy running a script. You can only call SCRIPT KILL or SHUTDOWN NOSAVE.")
+	ErrOOM       = NewCodeErrReply(CodeOOM, "command not allowed when used memory > 'maxmemory'.")
+	ErrCrossSlot = NewCodeErrReply(CodeCrossSlot, "Keys in request don't hash to the same slot")
+	ErrMoved     = NewCodeErrReply(CodeMoved, "")
+	ErrAsk       = NewCodeErrReply(CodeAsk, "")
+	ErrTryAgain  = NewCodeErrReply(CodeTryAgain, "Multiple keys request during rehashing of slot")
+)
+
+/***************************************CodeErrReply*******************************************/
+// CodeErrReply 用于表示带有错误码的错误回复, 编码为 -<code> <msg>\r\n
+type CodeErrReply struct {
+	codeErr
+	msg string // 表示错误码之后的错误信息
+}
+
+// NewCodeErrReply 用于创建带有错误码的错误回复
+func NewCodeErrReply(code, msg string) *CodeErrReply {
+	return &CodeErrReply{codeErr{code}, msg}
+}
+
+func (reply *CodeErrReply) Bytes() []byte {
+	return utils.String2Bytes("-" + reply.Error() + crlf)
+}
+
+func (reply *CodeErrReply) writeTo(wr *writer) {
+	wr.writeLine('-', reply.Error())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *CodeErrReply) Size() int {
+	n := 1 + len(reply.code) + len(crlf)
+	if reply.msg != "" {
+		n += 1 + len(reply.msg)
+	}
+	return n
+}
+
+func (reply *CodeErrReply) size(int) int {
+	return reply.Size()
+}
+
+func (reply *CodeErrReply) Error() string {
+	if reply.msg == "" {
+		return reply.code
+	}
+	return reply.code + " " + reply.msg
+}
+
+// Message 用于返回不包含错误码的错误信息
+func (reply *CodeErrReply) Message() string {
+	return reply.msg
+}
+
+// ParseErrReply 用于将客户端收到的错误信息转换为对应错误码的错误回复, line 不包含前缀'-'和后缀'\r\n'
+//
+// 例如 WRONGTYPE Operation against a key... 转换为错误码为 WRONGTYPE 的错误回复,
+// 与 ErrWrongType 满足 errors.Is. MOVED 和 ASK 分别转换为 *MovedReply 和 *AskReply.
+// 没有错误码的错误信息原样保存, 错误码视为 ERR
+func ParseErrReply(line string) resp.ErrorReply {
+	code := errCode(line)
+	switch {
+	case code == "":
+		return &NormalErrReply{Status: line}
+	case code == CodeErr && len(line) > len(code):
+		return NewErrReply(line[len(code)+1:])
+	}
+	msg := strings.TrimPrefix(line[len(code):], " ")
+	if code == CodeMoved || code == CodeAsk {
+		if res := parseRedirect(code, msg); res != nil {
+			return res
+		}
+	}
+	return NewCodeErrReply(code, msg)
+}
+
+// errCode 用于返回错误信息中的错误码, 即由大写字母, 数字和下划线组成的第一个单词, 没有错误码时返回空字符串
+func errCode(msg string) string {
+	end := strings.IndexByte(msg, ' ')
+	if end < 0 {
+		end = len(msg)
+	}
+	if end == 0 || msg[0] < 'A' || msg[0] > 'Z' {
+		return ""
+	}
+	for i := 1; i < end; i++ {
+		c := msg[i]
+		if (c < 'A' || c > 'Z') && (c < '0' || c > '9') && c != '_' {
+			return ""
+		}
+	}
+	return msg[:end]
+}
+
+// isCode 用于实现错误回复的 Is 方法, target 是错误码为code的错误回复时返回true
+func isCode(code string, target error) bool {
+	t, ok := target.(resp.ErrorReply)
+	return ok && t.Code() == code
+}
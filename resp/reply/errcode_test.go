@@ -0,0 +1,70 @@
+package reply
+
+import (
+	"errors"
+	"fmt"
+	"testing"
+
+	"godis-lib/interface/resp"
+)
+
+func TestErrCode(t *testing.T) {
+	tests := []struct {
+		reply resp.ErrorReply
+		code  string
+	}{
+		{NewSyntaxErrReply(), CodeErr},
+		{NewErrReply("WRONGTYPE is not a code here"), CodeErr},
+		{NewWrongTypeErrReply(), CodeWrongType},
+		{ErrNoAuth, CodeNoAuth},
+		{&NormalErrReply{Status: "LOADING Redis is loading the dataset in memory"}, CodeLoading},
+		{&NormalErrReply{Status: "something went wrong"}, CodeErr},
+		{NewBlobErrReply([]byte("SYNTAX invalid syntax")), "SYNTAX"},
+	}
+	for _, tt := range tests {
+		if code := tt.reply.Code(); code != tt.code {
+			t.Errorf("%q: expected code %s, actually %s", tt.reply.Bytes(), tt.code, code)
+		}
+	}
+
+	if !errors.Is(NewWrongTypeErrReply(), ErrWrongType) {
+		t.Errorf("expected wrong type reply to match ErrWrongType")
+	}
+	if errors.Is(NewWrongTypeErrReply(), ErrGeneric) || !errors.Is(NewSyntaxErrReply(), ErrGeneric) {
+		t.Errorf("unexpected match of ErrGeneric")
+	}
+	// 包装之后仍然可以比较错误码
+	wrapped := fmt.Errorf("exec failed: %w", ParseErrReply("READONLY You can't write against a read only replica."))
+	if !errors.Is(wrapped, ErrReadOnly) || errors.Is(wrapped, ErrLoading) {
+		t.Errorf("unexpected match of %v", wrapped)
+	}
+	var codeErr *CodeErrReply
+	if !errors.As(wrapped, &codeErr) || codeErr.Message() != "You can't write against a read only replica." {
+		t.Errorf("unexpected message of %v", wrapped)
+	}
+}
+
+func TestParseErrReply(t *testing.T) {
+	tests := []struct {
+		line string
+		code string
+	}{
+		{"ERR unknown command 'foo'", CodeErr},
+		{"ERR", CodeErr},
+		{"WRONGTYPE Operation against a key holding the wrong kind of value", CodeWrongType},
+		{"MOVED 3999 127.0.0.1:6381", CodeMoved},
+		{"EXECABORT", CodeExecAbort},
+		{"Err lower case", CodeErr},
+		{"", CodeErr},
+	}
+	for _, tt := range tests {
+		res := ParseErrReply(tt.line)
+		if res.Code() != tt.code {
+			t.Errorf("%q: expected code %s, actually %s", tt.line, tt.code, res.Code())
+		}
+		// 错误回复原样编码
+		if expected := "-" + tt.line + crlf; string(res.Bytes()) != expected {
+			t.Errorf("expected %q, actually %q", expected, res.Bytes())
+		}
+	}
+}
@@ -3,25 +3,52 @@ package reply
 import (
 	"bytes"
 	"fmt"
-	"go-redis/interface/resp"
+	"godis-lib/interface/resp"
 	"godis-lib/lib/utils"
 	"strings"
 )
 
+// codeErr 用于实现错误码固定的错误回复的 Code 和 Is, 由各个错误回复嵌入
+type codeErr struct {
+	code string // 表示错误码
+}
+
+func (e codeErr) Code() string {
+	return e.code
+}
+
+func (e codeErr) Is(target error) bool {
+	return isCode(e.code, target)
+}
+
 /***************************************unknownErrReply*******************************************/
 // unknownErrReply 用于表示未知错误的回复
 type unknownErrReply struct {
+	codeErr
 }
 
 // NewUnknownErrReply 用于创建未知错误的回复
 func NewUnknownErrReply() resp.ErrorReply {
-	return &unknownErrReply{}
+	return &unknownErrReply{codeErr{CodeErr}}
 }
 
 func (reply *unknownErrReply) Bytes() []byte {
 	return utils.String2Bytes(enum.ERR_UNKNOWN)
 }
 
+func (reply *unknownErrReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *unknownErrReply) Size() int {
+	return len(enum.ERR_UNKNOWN)
+}
+
+func (reply *unknownErrReply) size(int) int {
+	return len(enum.ERR_UNKNOWN)
+}
+
 func (reply *unknownErrReply) Error() string {
 	return bytes2Error(reply.Bytes())
 }
@@ -29,12 +56,13 @@ func (reply *unknownErrReply) Error() string {
 /*****************************************argNumErrReply*****************************************/
 // argNumErrReply 用于表示参数数量错误的回复
 type argNumErrReply struct {
+	codeErr
 	cmd string // 表示命令
 }
 
 // NewArgNumErrReply 用于创建参数数量错误的回复
 func NewArgNumErrReply(cmd string) resp.ErrorReply {
-	return &argNumErrReply{cmd}
+	return &argNumErrReply{codeErr{CodeErr}, cmd}
 }
 
 func NewArgNumErrReplyByCmd(cmd *enum.Command) resp.ErrorReply {
@@ -45,6 +73,19 @@ func (reply *argNumErrReply) Bytes() []byte {
 	return utils.String2Bytes(fmt.Sprintf(enum.ERR_ARG_NUM, strings.ToLower(reply.cmd)))
 }
 
+func (reply *argNumErrReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数, 错误信息需要格式化之后才能确定长度
+func (reply *argNumErrReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *argNumErrReply) size(int) int {
+	return reply.Size()
+}
+
 func (reply *argNumErrReply) Error() string {
 	return bytes2Error(reply.Bytes())
 }
@@ -52,40 +93,70 @@ func (reply *argNumErrReply) Error() string {
 /*********************************************syntaxErrReply*************************************/
 // syntaxErrReply 用于表示语法错误的回复
 type syntaxErrReply struct {
+	codeErr
 }
 
 // NewSyntaxErrReply 用于创建语法错误的回复
 func NewSyntaxErrReply() resp.ErrorReply {
-	return &syntaxErrReply{}
+	return &syntaxErrReply{codeErr{CodeErr}}
 }
 
 func (reply *syntaxErrReply) Bytes() []byte {
 	return utils.String2Bytes(enum.ERR_SYNTAX)
 }
 
+func (reply *syntaxErrReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *syntaxErrReply) Size() int {
+	return len(enum.ERR_SYNTAX)
+}
+
+func (reply *syntaxErrReply) size(int) int {
+	return len(enum.ERR_SYNTAX)
+}
+
 func (reply *syntaxErrReply) Error() string {
 	return bytes2Error(reply.Bytes())
 }
 
 /*****************************************wrongTypeErrReply*****************************************/
 // wrongTypeErrReply 用于表示类型错误的回复
-type wrongTypeErrReply struct{}
+type wrongTypeErrReply struct {
+	codeErr
+}
 
 func (reply *wrongTypeErrReply) Bytes() []byte {
 	return utils.String2Bytes(enum.ERR_WRONG_TYPE)
 }
 
+func (reply *wrongTypeErrReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *wrongTypeErrReply) Size() int {
+	return len(enum.ERR_WRONG_TYPE)
+}
+
+func (reply *wrongTypeErrReply) size(int) int {
+	return len(enum.ERR_WRONG_TYPE)
+}
+
 func (reply *wrongTypeErrReply) Error() string {
 	return bytes2Error(reply.Bytes())
 }
 
 func NewWrongTypeErrReply() resp.ErrorReply {
-	return &wrongTypeErrReply{}
+	return &wrongTypeErrReply{codeErr{CodeWrongType}}
 }
 
 /***************************************protocolErrReply*******************************************/
 // protocolErrReply 用于表示协议错误的回复
 type protocolErrReply struct {
+	codeErr
 	msg string // 表示错误信息
 }
 
@@ -93,18 +164,32 @@ func (reply *protocolErrReply) Bytes() []byte {
 	return utils.String2Bytes(fmt.Sprintf(enum.ERR_PROTOCOL, reply.msg))
 }
 
+func (reply *protocolErrReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数, 错误信息需要格式化之后才能确定长度
+func (reply *protocolErrReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *protocolErrReply) size(int) int {
+	return reply.Size()
+}
+
 func (reply *protocolErrReply) Error() string {
 	return bytes2Error(reply.Bytes())
 }
 
 // NewProtocolErrReply 用于创建协议错误的回复
 func NewProtocolErrReply(msg string) resp.ErrorReply {
-	return &protocolErrReply{msg}
+	return &protocolErrReply{codeErr{CodeErr}, msg}
 }
 
 /***************************************standardErrReply*******************************************/
 // standardErrReply 用于表示标准错误回复
 type standardErrReply struct {
+	codeErr
 	status string // 表示错误状态
 }
 
@@ -117,9 +202,22 @@ func (reply *standardErrReply) Bytes() []byte {
 	return utils.String2Bytes(fmt.Sprintf(enum.ERR_STANDARD, reply.status))
 }
 
+func (reply *standardErrReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数, 错误信息需要格式化之后才能确定长度
+func (reply *standardErrReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *standardErrReply) size(int) int {
+	return reply.Size()
+}
+
 // NewErrReply 用于创建标准错误回复
 func NewErrReply(status string) resp.ErrorReply {
-	return &standardErrReply{status}
+	return &standardErrReply{codeErr{CodeErr}, status}
 }
 
 func NewErrReplyByError(err error) resp.Reply {
@@ -132,28 +230,67 @@ type NormalErrReply struct {
 }
 
 func (reply *NormalErrReply) Bytes() []byte {
-	return utils.String2Bytes(fmt.Sprintf("-%s\r\n", reply.Status))
+	return encode(reply, defaultProtocol)
+}
+
+func (reply *NormalErrReply) writeTo(wr *writer) {
+	wr.writeLine('-', reply.Status)
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *NormalErrReply) Size() int {
+	return 1 + len(reply.Status) + len(crlf)
+}
+
+func (reply *NormalErrReply) size(int) int {
+	return reply.Size()
 }
 
 func (reply *NormalErrReply) Error() string {
 	return reply.Status
 }
 
+// Code 用于返回 Status 中的错误码, 没有错误码时返回 ERR
+func (reply *NormalErrReply) Code() string {
+	if code := errCode(reply.Status); code != "" {
+		return code
+	}
+	return CodeErr
+}
+
+func (reply *NormalErrReply) Is(target error) bool {
+	return isCode(reply.Code(), target)
+}
+
 /***************************************unknownCommandErrReply*******************************************/
 // unknownCommandErrReply 用于表示未知命令的回复
 type unknownCommandErrReply struct {
+	codeErr
 	cmd string // 表示命令
 }
 
 // NewUnknownCommandErrReply 用于创建未知命令的回复
 func NewUnknownCommandErrReply(cmd string) resp.ErrorReply {
-	return &unknownCommandErrReply{cmd}
+	return &unknownCommandErrReply{codeErr{CodeErr}, cmd}
 }
 
 func (reply *unknownCommandErrReply) Bytes() []byte {
 	return utils.String2Bytes(fmt.Sprintf(enum.ERR_UNKNOWN_CMD, reply.cmd))
 }
 
+func (reply *unknownCommandErrReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数, 错误信息需要格式化之后才能确定长度
+func (reply *unknownCommandErrReply) Size() int {
+	return len(reply.Bytes())
+}
+
+func (reply *unknownCommandErrReply) size(int) int {
+	return reply.Size()
+}
+
 func (reply *unknownCommandErrReply) Error() string {
 	return bytes2Error(reply.Bytes())
 }
@@ -161,47 +298,91 @@ func (reply *unknownCommandErrReply) Error() string {
 /***************************************intErrReply*******************************************/
 // intErrReply 用于表示整数类型错误或者超过整数范围
 type intErrReply struct {
+	codeErr
 }
 
 func (reply *intErrReply) Bytes() []byte {
 	return utils.String2Bytes(enum.ERR_INT)
 }
 
+func (reply *intErrReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *intErrReply) Size() int {
+	return len(enum.ERR_INT)
+}
+
+func (reply *intErrReply) size(int) int {
+	return len(enum.ERR_INT)
+}
+
 func (reply *intErrReply) Error() string {
 	return bytes2Error(reply.Bytes())
 }
 
 // NewIntErrReply 用于创建整数错误的回复
 func NewIntErrReply() resp.ErrorReply {
-	return &intErrReply{}
+	return &intErrReply{codeErr{CodeErr}}
 }
 
 /***************************************noSuchKeyErrReply*******************************************/
-type noSuchKeyErrReply struct{}
+type noSuchKeyErrReply struct {
+	codeErr
+}
 
 func (reply *noSuchKeyErrReply) Bytes() []byte {
 	return utils.String2Bytes(enum.ERR_NO_SUCH_KEY)
 }
 
+func (reply *noSuchKeyErrReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *noSuchKeyErrReply) Size() int {
+	return len(enum.ERR_NO_SUCH_KEY)
+}
+
+func (reply *noSuchKeyErrReply) size(int) int {
+	return len(enum.ERR_NO_SUCH_KEY)
+}
+
 func (reply *noSuchKeyErrReply) Error() string {
 	return bytes2Error(reply.Bytes())
 }
 
 func NewNoSuchKeyErrReply() resp.ErrorReply {
-	return &noSuchKeyErrReply{}
+	return &noSuchKeyErrReply{codeErr{CodeErr}}
 }
 
 /***************************************notValidFloatErrReply*******************************************/
-type notValidFloatErrReply struct{}
+type notValidFloatErrReply struct {
+	codeErr
+}
 
 func NewNotValidFloatErrReply() resp.ErrorReply {
-	return &notValidFloatErrReply{}
+	return &notValidFloatErrReply{codeErr{CodeErr}}
 }
 
 func (reply *notValidFloatErrReply) Bytes() []byte {
 	return utils.String2Bytes(enum.ERR_NOT_VALID_FLOAT)
 }
 
+func (reply *notValidFloatErrReply) writeTo(wr *writer) {
+	wr.write(reply.Bytes())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *notValidFloatErrReply) Size() int {
+	return len(enum.ERR_NOT_VALID_FLOAT)
+}
+
+func (reply *notValidFloatErrReply) size(int) int {
+	return len(enum.ERR_NOT_VALID_FLOAT)
+}
+
 func (reply *notValidFloatErrReply) Error() string {
 	return bytes2Error(reply.Bytes())
 }
@@ -0,0 +1,249 @@
+package reply
+
+import (
+	"bytes"
+	"encoding/json"
+	"math"
+	"strconv"
+	"strings"
+
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+)
+
+// FormatCLI 用于将回复格式化为与 redis-cli 相同的可读形式, 例如:
+//
+//	127.0.0.1:6379> EXEC
+//	1) "a"
+//	2) (integer) 5
+//	3) 1) (nil)
+//	   2) (error) ERR syntax error
+//
+// 其中第一行是命令, 不属于格式化的结果. 字典的元素格式化为 1# "key" => "value", 集合的元素格式化为 1~ "member",
+// 回复字符串中不可打印的字符会被转义
+func FormatCLI(r resp.Reply) string {
+	var buf strings.Builder
+	formatCLI(&buf, r, "")
+	return strings.TrimSuffix(buf.String(), "\n")
+}
+
+// formatCLI 用于格式化回复并以换行结束, prefix 是嵌套的数组中元素之前的缩进
+func formatCLI(buf *strings.Builder, r resp.Reply, prefix string) {
+	if attr, ok := r.(*AttributeReply); ok {
+		r = attr.Reply
+	}
+	if errReply, ok := r.(resp.ErrorReply); ok {
+		buf.WriteString("(error) " + errReply.Error() + "\n")
+		return
+	}
+	if isNull(r) {
+		buf.WriteString("(nil)\n")
+		return
+	}
+
+	switch r := r.(type) {
+	case *BulkReply:
+		buf.WriteString(quote(r.Arg) + "\n")
+		return
+	case *VerbatimReply:
+		buf.Write(r.Text)
+		buf.WriteString("\n")
+		return
+	case *IntReply:
+		buf.WriteString("(integer) " + strconv.FormatInt(r.code, 10) + "\n")
+		return
+	case *DoubleReply:
+		buf.WriteString("(double) " + formatDouble(r.value) + "\n")
+		return
+	case *BooleanReply:
+		buf.WriteString(utils.If(r.value, "(true)\n", "(false)\n"))
+		return
+	case *BigNumberReply:
+		buf.WriteString("(big number) " + r.value.String() + "\n")
+		return
+	case *noReply:
+		return
+	}
+	if s, ok := scalarText(r); ok { // 状态回复
+		buf.WriteString(s + "\n")
+		return
+	}
+
+	elems, ok := arrayElems(r)
+	if !ok { // 未知的回复类型
+		buf.WriteString(strconv.Quote(string(r.Bytes())) + "\n")
+		return
+	}
+	sep := byte(')')
+	switch r.(type) {
+	case *MapReply:
+		sep = '#'
+	case *SetReply:
+		sep = '~'
+	}
+	if len(elems) == 0 {
+		switch sep {
+		case '#':
+			buf.WriteString("(empty hash)\n")
+		case '~':
+			buf.WriteString("(empty set)\n")
+		default:
+			buf.WriteString(utils.If(isPush(r), "(empty push)\n", "(empty array)\n"))
+		}
+		return
+	}
+
+	// 序号右对齐, 嵌套的元素在序号之后缩进
+	idxLen := len(strconv.Itoa(len(elems)))
+	childPrefix := prefix + strings.Repeat(" ", idxLen+2)
+	step := utils.If(sep == '#', 2, 1)
+	for i := 0; i < len(elems); i += step {
+		if i > 0 {
+			buf.WriteString(prefix)
+		}
+		idx := strconv.Itoa(i/step + 1)
+		buf.WriteString(strings.Repeat(" ", idxLen-len(idx)) + idx)
+		buf.WriteByte(sep)
+		buf.WriteByte(' ')
+		if sep != '#' {
+			formatCLI(buf, elems[i], childPrefix)
+			continue
+		}
+		// 键之后的换行替换为 =>
+		var key strings.Builder
+		formatCLI(&key, elems[i], childPrefix)
+		buf.WriteString(strings.TrimSuffix(key.String(), "\n") + " => ")
+		formatCLI(buf, elems[i+1], childPrefix)
+	}
+}
+
+// isPush 用于判断回复是否是推送回复
+func isPush(r resp.Reply) bool {
+	_, ok := r.(*PushReply)
+	return ok
+}
+
+// quote 用于将字符串格式化为带引号的形式, 与 redis-cli 一致, 不可打印的字符使用 \xHH 表示
+func quote(s []byte) string {
+	var buf strings.Builder
+	buf.Grow(len(s) + 2)
+	buf.WriteByte('"')
+	for _, c := range s {
+		switch c {
+		case '\\', '"':
+			buf.WriteByte('\\')
+			buf.WriteByte(c)
+		case '\n':
+			buf.WriteString(`\n`)
+		case '\r':
+			buf.WriteString(`\r`)
+		case '\t':
+			buf.WriteString(`\t`)
+		case '\a':
+			buf.WriteString(`\a`)
+		case '\b':
+			buf.WriteString(`\b`)
+		default:
+			if c >= 0x20 && c <= 0x7e {
+				buf.WriteByte(c)
+			} else {
+				buf.WriteString(`\x`)
+				buf.WriteString(strconv.FormatUint(uint64(c)>>4, 16))
+				buf.WriteString(strconv.FormatUint(uint64(c)&0xf, 16))
+			}
+		}
+	}
+	buf.WriteByte('"')
+	return buf.String()
+}
+
+// FormatJSON 用于将回复格式化为JSON, 转换规则如下:
+//
+//   - 回复字符串和状态回复: 字符串; 整数, 浮点数和大整数: 数字; 布尔回复: 布尔值; 空值: null
+//   - 数组, 集合和推送回复: 数组; 字典: 对象, 键使用字符串形式并保持原有的顺序
+//   - 错误回复: {"error": "ERR ..."}
+//
+// 无穷大和NaN不是合法的JSON数字, 使用字符串 "inf", "-inf" 和 "nan" 表示
+func FormatJSON(r resp.Reply) []byte {
+	var buf bytes.Buffer
+	formatJSON(&buf, r)
+	return buf.Bytes()
+}
+
+func formatJSON(buf *bytes.Buffer, r resp.Reply) {
+	if attr, ok := r.(*AttributeReply); ok {
+		r = attr.Reply
+	}
+	if errReply, ok := r.(resp.ErrorReply); ok {
+		buf.WriteString(`{"error":`)
+		writeJSONString(buf, errReply.Error())
+		buf.WriteByte('}')
+		return
+	}
+	if isNull(r) {
+		buf.WriteString("null")
+		return
+	}
+
+	switch r := r.(type) {
+	case *IntReply:
+		buf.WriteString(strconv.FormatInt(r.code, 10))
+		return
+	case *DoubleReply:
+		if math.IsInf(r.value, 0) || math.IsNaN(r.value) {
+			writeJSONString(buf, formatDouble(r.value))
+		} else {
+			buf.WriteString(formatDouble(r.value))
+		}
+		return
+	case *BooleanReply:
+		buf.WriteString(strconv.FormatBool(r.value))
+		return
+	case *BigNumberReply:
+		buf.WriteString(r.value.String())
+		return
+	case *MapReply:
+		buf.WriteByte('{')
+		for i, entry := range r.Entries {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			key, ok := scalarText(entry.Key)
+			if !ok { // 聚合类型的键使用JSON的字符串形式
+				key = string(FormatJSON(entry.Key))
+			}
+			writeJSONString(buf, key)
+			buf.WriteByte(':')
+			formatJSON(buf, entry.Value)
+		}
+		buf.WriteByte('}')
+		return
+	case *noReply:
+		buf.WriteString("null")
+		return
+	}
+	if s, ok := scalarText(r); ok {
+		writeJSONString(buf, s)
+		return
+	}
+	if elems, ok := arrayElems(r); ok {
+		buf.WriteByte('[')
+		for i, elem := range elems {
+			if i > 0 {
+				buf.WriteByte(',')
+			}
+			formatJSON(buf, elem)
+		}
+		buf.WriteByte(']')
+		return
+	}
+	writeJSONString(buf, string(r.Bytes())) // 未知的回复类型
+}
+
+// writeJSONString 用于写入JSON字符串, 不合法的UTF-8字符会被替换为 U+FFFD, 不转义HTML字符
+func writeJSONString(buf *bytes.Buffer, s string) {
+	enc := json.NewEncoder(buf)
+	enc.SetEscapeHTML(false)
+	_ = enc.Encode(s)
+	buf.Truncate(buf.Len() - 1) // 去除 Encode 添加的换行
+}
@@ -0,0 +1,92 @@
+package reply
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+)
+
+func TestFormatCLI(t *testing.T) {
+	args := make(db.CmdLine, 10)
+	for i := range args {
+		args[i] = []byte{'a' + byte(i)}
+	}
+	tests := []struct {
+		reply    resp.Reply
+		expected string
+	}{
+		{NewBulkReply([]byte("a\"b\n\x00")), `"a\"b\n\x00"`},
+		{NewBulkReply(nil), "(nil)"},
+		{NewNullMultiBulkReply(), "(nil)"},
+		{NewNullReply(), "(nil)"},
+		{NewOKReply(), "OK"},
+		{NewPongReply(), "PONG"},
+		{NewQueuedReply(), "QUEUED"},
+		{NewIntReply(5), "(integer) 5"},
+		{NewDoubleReply(1.5), "(double) 1.5"},
+		{NewBooleanReply(true), "(true)"},
+		{NewBigNumberReply(big.NewInt(7)), "(big number) 7"},
+		{NewVerbatimReply("txt", []byte("hi")), "hi"},
+		{NewSyntaxErrReply(), "(error) ERR syntax error"},
+		{NewEmptyMultiBulkReply(), "(empty array)"},
+		{NewMapReply(nil), "(empty hash)"},
+		{NewSetReply(nil), "(empty set)"},
+		{
+			NewMultiRawReply([]resp.Reply{
+				NewBulkReply([]byte("a")),
+				NewMultiRawReply([]resp.Reply{NewIntReply(1), NewMultiBulkReply(db.CmdLine{nil, []byte("x")})}),
+				NewStatusReply("OK"),
+			}),
+			"1) \"a\"\n2) 1) (integer) 1\n   2) 1) (nil)\n      2) \"x\"\n3) OK",
+		},
+		{
+			NewMultiBulkReply(args),
+			" 1) \"a\"\n 2) \"b\"\n 3) \"c\"\n 4) \"d\"\n 5) \"e\"\n 6) \"f\"\n 7) \"g\"\n 8) \"h\"\n 9) \"i\"\n10) \"j\"",
+		},
+		{
+			NewMapReply([]MapEntry{
+				{NewBulkReply([]byte("k")), NewSetReply([]resp.Reply{NewIntReply(1), NewIntReply(2)})},
+				{NewBulkReply([]byte("n")), NewNullReply()},
+			}),
+			"1# \"k\" => 1~ (integer) 1\n   2~ (integer) 2\n2# \"n\" => (nil)",
+		},
+	}
+	for _, tt := range tests {
+		if actual := FormatCLI(tt.reply); actual != tt.expected {
+			t.Errorf("expected %q, actually %q", tt.expected, actual)
+		}
+	}
+}
+
+func TestFormatJSON(t *testing.T) {
+	tests := []struct {
+		reply    resp.Reply
+		expected string
+	}{
+		{NewBulkReply([]byte("<a>")), `"<a>"`},
+		{NewNullBulkReply(), `null`},
+		{NewOKReply(), `"OK"`},
+		{NewIntReply(-5), `-5`},
+		{NewDoubleReply(math.Inf(1)), `"inf"`},
+		{NewDoubleReply(0.25), `0.25`},
+		{NewBooleanReply(false), `false`},
+		{NewWrongTypeErrReply(), `{"error":"WRONGTYPE Operation against a key holding the wrong kind of value"}`},
+		{NewEmptyMultiBulkReply(), `[]`},
+		{NewMultiBulkReply(db.CmdLine{[]byte("a"), nil}), `["a",null]`},
+		{
+			NewMapReply([]MapEntry{
+				{NewStatusReply("z"), NewIntReply(1)},
+				{NewIntReply(2), NewMultiRawReply([]resp.Reply{NewBooleanReply(true)})},
+			}),
+			`{"z":1,"2":[true]}`,
+		},
+	}
+	for _, tt := range tests {
+		if actual := string(FormatJSON(tt.reply)); actual != tt.expected {
+			t.Errorf("expected %s, actually %s", tt.expected, actual)
+		}
+	}
+}
@@ -0,0 +1,626 @@
+package reply
+
+import (
+	"bytes"
+	"fmt"
+	"math"
+	"math/big"
+	"reflect"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+)
+
+var (
+	replyType  = reflect.TypeOf((*resp.Reply)(nil)).Elem()
+	errorType  = reflect.TypeOf((*error)(nil)).Elem()
+	bigIntType = reflect.TypeOf((*big.Int)(nil))
+)
+
+// Marshal 用于将Go的值转换为回复, 转换规则如下:
+//
+//   - nil, 值为nil的指针和接口: 空值, 在RESP2中降级为 $-1\r\n
+//   - resp.Reply: 原样返回; 其他 error: 标准错误回复 -ERR <msg>
+//   - string, []byte: 回复字符串, 值为nil的 []byte 是空值
+//   - 整数: 整数回复, 超过 int64 范围的无符号整数和 *big.Int: 大整数回复
+//   - 浮点数: 浮点数回复; bool: 布尔回复
+//   - 切片和数组: 数组, 值为nil的切片是空数组
+//   - map: 字典, 按照键的字符串形式排序; 值类型为 struct{} 的map: 集合
+//   - 结构体: 字典, 键是字段名或者 resp:"name" 标签中的名称, 标签为 "-" 的字段会被忽略,
+//     使用 resp:"name,omitempty" 时零值字段会被忽略
+//
+// 字典, 集合等RESP3的类型在RESP2连接上会自动降级, 参考 resp.ProtocolReply.
+// 无法转换的类型, 例如 chan 和 func, 返回错误回复
+func Marshal(v any) resp.Reply {
+	switch v := v.(type) { // 常用类型不使用反射
+	case nil:
+		return NewNullReply()
+	case resp.Reply:
+		return v
+	case error:
+		return NewErrReply(v.Error())
+	case string:
+		return NewBulkReply([]byte(v))
+	case []byte:
+		return NewBulkReply(v)
+	case [][]byte:
+		return NewMultiBulkReply(v)
+	case int:
+		return NewIntReply(int64(v))
+	case int64:
+		return NewIntReply(v)
+	case bool:
+		return NewBooleanReply(v)
+	case float64:
+		return NewDoubleReply(v)
+	case *big.Int:
+		if v == nil {
+			return NewNullReply()
+		}
+		return NewBigNumberReply(v)
+	}
+	return marshalValue(reflect.ValueOf(v))
+}
+
+func marshalValue(rv reflect.Value) resp.Reply {
+	t := rv.Type()
+	switch rv.Kind() {
+	case reflect.Pointer, reflect.Interface:
+		if rv.IsNil() {
+			return NewNullReply()
+		}
+		if t.Implements(replyType) || t.Implements(errorType) || t == bigIntType || rv.Kind() == reflect.Interface {
+			return Marshal(rv.Interface())
+		}
+		return marshalValue(rv.Elem())
+	case reflect.String:
+		return NewBulkReply([]byte(rv.String()))
+	case reflect.Bool:
+		return NewBooleanReply(rv.Bool())
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return NewIntReply(rv.Int())
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if n := rv.Uint(); n > math.MaxInt64 {
+			return NewBigNumberReply(new(big.Int).SetUint64(n))
+		}
+		return NewIntReply(int64(rv.Uint()))
+	case reflect.Float32, reflect.Float64:
+		return NewDoubleReply(rv.Float())
+	case reflect.Slice, reflect.Array:
+		if t.Elem().Kind() == reflect.Uint8 {
+			if rv.Kind() == reflect.Slice {
+				return NewBulkReply(rv.Bytes())
+			}
+			arg := make([]byte, rv.Len())
+			reflect.Copy(reflect.ValueOf(arg), rv)
+			return NewBulkReply(arg)
+		}
+		replies := make([]resp.Reply, rv.Len())
+		for i := range replies {
+			replies[i] = marshalValue(rv.Index(i))
+		}
+		return NewMultiRawReply(replies)
+	case reflect.Map:
+		return marshalMap(rv)
+	case reflect.Struct:
+		fields := cachedFields(t)
+		entries := make([]MapEntry, 0, len(fields))
+		for _, f := range fields {
+			fv := rv.FieldByIndex(f.index)
+			if f.omitEmpty && fv.IsZero() {
+				continue
+			}
+			entries = append(entries, MapEntry{NewBulkReply([]byte(f.name)), marshalValue(fv)})
+		}
+		return NewMapReply(entries)
+	}
+	return NewErrReply("unsupported type " + t.String())
+}
+
+// marshalMap 用于将map转换为字典, 值类型为 struct{} 时转换为集合
+func marshalMap(rv reflect.Value) resp.Reply {
+	keys := rv.MapKeys()
+	names := make([]string, len(keys))
+	for i, key := range keys {
+		names[i] = keyString(key)
+	}
+	sort.Sort(keySorter{keys, names})
+
+	if elem := rv.Type().Elem(); elem.Kind() == reflect.Struct && elem.NumField() == 0 {
+		members := make([]resp.Reply, len(keys))
+		for i, key := range keys {
+			members[i] = marshalValue(key)
+		}
+		return NewSetReply(members)
+	}
+	entries := make([]MapEntry, len(keys))
+	for i, key := range keys {
+		entries[i] = MapEntry{marshalValue(key), marshalValue(rv.MapIndex(key))}
+	}
+	return NewMapReply(entries)
+}
+
+// keyString 用于返回map的键的字符串形式, 用于排序
+func keyString(key reflect.Value) string {
+	switch key.Kind() {
+	case reflect.String:
+		return key.String()
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		return strconv.FormatInt(key.Int(), 10)
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		return strconv.FormatUint(key.Uint(), 10)
+	}
+	return fmt.Sprint(key.Interface())
+}
+
+// keySorter 用于按照字符串形式对map的键排序
+type keySorter struct {
+	keys  []reflect.Value
+	names []string
+}
+
+func (s keySorter) Len() int           { return len(s.keys) }
+func (s keySorter) Less(i, j int) bool { return s.names[i] < s.names[j] }
+func (s keySorter) Swap(i, j int) {
+	s.keys[i], s.keys[j] = s.keys[j], s.keys[i]
+	s.names[i], s.names[j] = s.names[j], s.names[i]
+}
+
+// field 用于表示结构体中参与转换的字段
+type field struct {
+	name      string // 表示字典中的键
+	index     []int  // 表示字段的位置, 用于 reflect.Value.FieldByIndex
+	omitEmpty bool   // 表示零值时是否忽略
+}
+
+var fieldCache sync.Map // map[reflect.Type][]field
+
+// cachedFields 用于返回结构体中参与转换的字段, 未导出的字段和标签为 "-" 的字段会被忽略
+func cachedFields(t reflect.Type) []field {
+	if fields, ok := fieldCache.Load(t); ok {
+		return fields.([]field)
+	}
+	fields := make([]field, 0, t.NumField())
+	for i := 0; i < t.NumField(); i++ {
+		sf := t.Field(i)
+		if !sf.IsExported() {
+			continue
+		}
+		tag := sf.Tag.Get("resp")
+		if tag == "-" {
+			continue
+		}
+		name, opts, _ := strings.Cut(tag, ",")
+		if name == "" {
+			name = sf.Name
+		}
+		fields = append(fields, field{name, sf.Index, opts == "omitempty"})
+	}
+	fieldCache.Store(t, fields)
+	return fields
+}
+
+// UnmarshalTypeError 表示回复无法转换为目标类型
+type UnmarshalTypeError struct {
+	Reply string       // 表示回复的类型, 例如 array 或 integer
+	Type  reflect.Type // 表示目标类型
+}
+
+func (e *UnmarshalTypeError) Error() string {
+	return "reply: cannot unmarshal " + e.Reply + " into Go value of type " + e.Type.String()
+}
+
+// Unmarshal 用于将回复转换为Go的值并保存到dst中, dst 必须是非nil的指针, 转换规则与 Marshal 相反:
+//
+//   - 错误回复直接作为错误返回, 可以使用 errors.Is 判断错误码
+//   - 空值将目标设置为零值, 例如 nil 指针或者空字符串
+//   - string 和 []byte 可以接收回复字符串, 状态回复, 整数和浮点数
+//   - 数值和 bool 可以接收对应的回复, 也可以接收能够解析的回复字符串, 例如 GET 返回的计数器
+//   - 切片和数组可以接收数组, 集合和推送回复, 字典会展开为键值交替排列的数组
+//   - map 和结构体可以接收字典, 也可以接收键值交替排列的数组, 例如RESP2中 HGETALL 的回复.
+//     结构体字段的匹配与 Marshal 一致, 字段名不区分大小写; 值类型为 struct{} 的map可以接收集合
+//   - resp.Reply 接收原始的回复, any 接收 string, int64, float64, bool, *big.Int, []any 或者 map[string]any
+//
+// 属性回复会被忽略, 只转换被修饰的回复. 无法转换时返回 *UnmarshalTypeError
+func Unmarshal(r resp.Reply, dst any) error {
+	rv := reflect.ValueOf(dst)
+	if rv.Kind() != reflect.Pointer || rv.IsNil() {
+		return fmt.Errorf("reply: Unmarshal requires a non-nil pointer, got %T", dst)
+	}
+	return unmarshal(r, rv.Elem())
+}
+
+func unmarshal(r resp.Reply, v reflect.Value) error {
+	if attr, ok := r.(*AttributeReply); ok {
+		r = attr.Reply
+	}
+	if errReply, ok := r.(resp.ErrorReply); ok {
+		return errReply
+	}
+	if v.Type() == replyType {
+		if r == nil {
+			v.SetZero()
+		} else {
+			v.Set(reflect.ValueOf(r))
+		}
+		return nil
+	}
+	if isNull(r) {
+		v.SetZero()
+		return nil
+	}
+
+	switch v.Kind() {
+	case reflect.Pointer:
+		if v.Type() == bigIntType {
+			if n, ok := toBigInt(r); ok {
+				v.Set(reflect.ValueOf(n))
+				return nil
+			}
+			break
+		}
+		if v.IsNil() {
+			v.Set(reflect.New(v.Type().Elem()))
+		}
+		return unmarshal(r, v.Elem())
+	case reflect.Interface:
+		if v.NumMethod() != 0 {
+			break
+		}
+		x, err := toAny(r)
+		if err != nil {
+			return err
+		}
+		v.Set(reflect.ValueOf(x))
+		return nil
+	case reflect.String:
+		if s, ok := scalarText(r); ok {
+			v.SetString(s)
+			return nil
+		}
+	case reflect.Bool:
+		switch r := r.(type) {
+		case *BooleanReply:
+			v.SetBool(r.value)
+			return nil
+		case *IntReply:
+			v.SetBool(r.code != 0)
+			return nil
+		}
+		if s, ok := scalarText(r); ok {
+			if b, err := strconv.ParseBool(s); err == nil {
+				v.SetBool(b)
+				return nil
+			}
+		}
+	case reflect.Int, reflect.Int8, reflect.Int16, reflect.Int32, reflect.Int64:
+		if n, ok := toInt(r); ok && !v.OverflowInt(n) {
+			v.SetInt(n)
+			return nil
+		}
+	case reflect.Uint, reflect.Uint8, reflect.Uint16, reflect.Uint32, reflect.Uint64, reflect.Uintptr:
+		if s, ok := scalarText(r); ok {
+			if n, err := strconv.ParseUint(s, 10, 64); err == nil && !v.OverflowUint(n) {
+				v.SetUint(n)
+				return nil
+			}
+		}
+	case reflect.Float32, reflect.Float64:
+		if f, ok := toFloat(r); ok {
+			v.SetFloat(f)
+			return nil
+		}
+	case reflect.Slice:
+		if v.Type().Elem().Kind() == reflect.Uint8 {
+			if b, ok := scalarBytes(r); ok {
+				v.SetBytes(b)
+				return nil
+			}
+			break
+		}
+		if elems, ok := arrayElems(r); ok {
+			slice := reflect.MakeSlice(v.Type(), len(elems), len(elems))
+			for i, elem := range elems {
+				if err := unmarshal(elem, slice.Index(i)); err != nil {
+					return err
+				}
+			}
+			v.Set(slice)
+			return nil
+		}
+	case reflect.Array:
+		if elems, ok := arrayElems(r); ok {
+			v.SetZero()
+			for i := 0; i < len(elems) && i < v.Len(); i++ {
+				if err := unmarshal(elems[i], v.Index(i)); err != nil {
+					return err
+				}
+			}
+			return nil
+		}
+	case reflect.Map:
+		return unmarshalMap(r, v)
+	case reflect.Struct:
+		if entries, ok := mapEntries(r); ok {
+			return unmarshalStruct(entries, v)
+		}
+	}
+	return &UnmarshalTypeError{replyKind(r), v.Type()}
+}
+
+// unmarshalMap 用于将字典或者键值交替排列的数组转换为map, 值类型为 struct{} 时也可以接收集合
+func unmarshalMap(r resp.Reply, v reflect.Value) error {
+	t := v.Type()
+	var entries []MapEntry
+	if elem := t.Elem(); elem.Kind() == reflect.Struct && elem.NumField() == 0 {
+		if _, isMap := r.(*MapReply); !isMap {
+			members, ok := arrayElems(r)
+			if !ok {
+				return &UnmarshalTypeError{replyKind(r), t}
+			}
+			entries = make([]MapEntry, len(members))
+			for i, member := range members {
+				entries[i] = MapEntry{Key: member}
+			}
+		}
+	}
+	if entries == nil {
+		var ok bool
+		if entries, ok = mapEntries(r); !ok {
+			return &UnmarshalTypeError{replyKind(r), t}
+		}
+	}
+
+	if v.IsNil() {
+		v.Set(reflect.MakeMapWithSize(t, len(entries)))
+	}
+	for _, entry := range entries {
+		key := reflect.New(t.Key()).Elem()
+		if err := unmarshal(entry.Key, key); err != nil {
+			return err
+		}
+		value := reflect.New(t.Elem()).Elem()
+		if entry.Value != nil {
+			if err := unmarshal(entry.Value, value); err != nil {
+				return err
+			}
+		}
+		v.SetMapIndex(key, value)
+	}
+	return nil
+}
+
+// unmarshalStruct 用于将键值对保存到结构体的字段中, 没有对应字段的键会被忽略
+func unmarshalStruct(entries []MapEntry, v reflect.Value) error {
+	fields := cachedFields(v.Type())
+	for _, entry := range entries {
+		name, ok := scalarText(entry.Key)
+		if !ok {
+			return &UnmarshalTypeError{replyKind(entry.Key), reflect.TypeOf("")}
+		}
+		var target *field
+		for i := range fields {
+			if fields[i].name == name {
+				target = &fields[i]
+				break
+			}
+			if target == nil && strings.EqualFold(fields[i].name, name) {
+				target = &fields[i]
+			}
+		}
+		if target == nil {
+			continue
+		}
+		if err := unmarshal(entry.Value, v.FieldByIndex(target.index)); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// toAny 用于将回复转换为最接近的Go的值
+func toAny(r resp.Reply) (any, error) {
+	if isNull(r) {
+		return nil, nil
+	}
+	switch r := r.(type) {
+	case *IntReply:
+		return r.code, nil
+	case *DoubleReply:
+		return r.value, nil
+	case *BooleanReply:
+		return r.value, nil
+	case *BigNumberReply:
+		return new(big.Int).Set(r.value), nil
+	case *MapReply:
+		m := make(map[string]any, len(r.Entries))
+		for _, entry := range r.Entries {
+			key, ok := scalarText(entry.Key)
+			if !ok {
+				return nil, &UnmarshalTypeError{replyKind(entry.Key), reflect.TypeOf("")}
+			}
+			value, err := toAny(entry.Value)
+			if err != nil {
+				return nil, err
+			}
+			m[key] = value
+		}
+		return m, nil
+	case resp.ErrorReply:
+		return nil, r
+	}
+	if s, ok := scalarText(r); ok {
+		return s, nil
+	}
+	if elems, ok := arrayElems(r); ok {
+		values := make([]any, len(elems))
+		for i, elem := range elems {
+			value, err := toAny(elem)
+			if err != nil {
+				return nil, err
+			}
+			values[i] = value
+		}
+		return values, nil
+	}
+	return nil, &UnmarshalTypeError{replyKind(r), reflect.TypeOf((*any)(nil)).Elem()}
+}
+
+// isNull 用于判断回复是否是空值
+func isNull(r resp.Reply) bool {
+	switch r := r.(type) {
+	case nil, *NullReply, *NullBulkReply, *nullMultiBulkReply:
+		return true
+	case *BulkReply:
+		return r.Arg == nil
+	}
+	return false
+}
+
+// scalarText 用于返回单个值的回复的字符串形式, 例如回复字符串, 状态回复和整数
+func scalarText(r resp.Reply) (string, bool) {
+	switch r := r.(type) {
+	case *BulkReply:
+		return string(r.Arg), true
+	case *StatusReply:
+		return r.status, true
+	case *IntReply:
+		return strconv.FormatInt(r.code, 10), true
+	case *DoubleReply:
+		return formatDouble(r.value), true
+	case *BigNumberReply:
+		return r.value.String(), true
+	case *VerbatimReply:
+		return string(r.Text), true
+	case *okReply, *PongReply, *queuedReply: // 没有导出字段的状态回复
+		b := r.Bytes()
+		return string(b[1 : len(b)-len(crlf)]), true
+	}
+	return "", false
+}
+
+// scalarBytes 与 scalarText 相同, 返回的字节数组不会与回复共享内存
+func scalarBytes(r resp.Reply) ([]byte, bool) {
+	if bulk, ok := r.(*BulkReply); ok {
+		return bytes.Clone(bulk.Arg), true
+	}
+	s, ok := scalarText(r)
+	return []byte(s), ok
+}
+
+func toInt(r resp.Reply) (int64, bool) {
+	switch r := r.(type) {
+	case *IntReply:
+		return r.code, true
+	case *BooleanReply:
+		return utils.If[int64](r.value, 1, 0), true
+	}
+	if s, ok := scalarText(r); ok {
+		n, err := strconv.ParseInt(s, 10, 64)
+		return n, err == nil
+	}
+	return 0, false
+}
+
+func toFloat(r resp.Reply) (float64, bool) {
+	switch r := r.(type) {
+	case *DoubleReply:
+		return r.value, true
+	case *IntReply:
+		return float64(r.code), true
+	}
+	if s, ok := scalarText(r); ok {
+		f, err := strconv.ParseFloat(s, 64)
+		return f, err == nil
+	}
+	return 0, false
+}
+
+func toBigInt(r resp.Reply) (*big.Int, bool) {
+	switch r := r.(type) {
+	case *BigNumberReply:
+		return new(big.Int).Set(r.value), true
+	case *IntReply:
+		return big.NewInt(r.code), true
+	}
+	if s, ok := scalarText(r); ok {
+		return new(big.Int).SetString(s, 10)
+	}
+	return nil, false
+}
+
+// arrayElems 用于返回数组, 集合和推送回复中的元素, 字典会展开为键值交替排列的数组
+func arrayElems(r resp.Reply) ([]resp.Reply, bool) {
+	switch r := r.(type) {
+	case *MultiBulkReply:
+		elems := make([]resp.Reply, len(r.Args))
+		for i, arg := range r.Args {
+			elems[i] = NewBulkReply(arg)
+		}
+		return elems, true
+	case *MultiRawReply:
+		return r.Replies, true
+	case *SetReply:
+		return r.Members, true
+	case *PushReply:
+		return r.Replies, true
+	case *emptyMultiBulkReply:
+		return nil, true
+	case *MapReply:
+		elems := make([]resp.Reply, 0, len(r.Entries)*2)
+		for _, entry := range r.Entries {
+			elems = append(elems, entry.Key, entry.Value)
+		}
+		return elems, true
+	}
+	return nil, false
+}
+
+// mapEntries 用于返回字典中的键值对, 键值交替排列的数组也可以转换为键值对
+func mapEntries(r resp.Reply) ([]MapEntry, bool) {
+	if m, ok := r.(*MapReply); ok {
+		return m.Entries, true
+	}
+	elems, ok := arrayElems(r)
+	if !ok || len(elems)%2 != 0 {
+		return nil, false
+	}
+	entries := make([]MapEntry, len(elems)/2)
+	for i := range entries {
+		entries[i] = MapEntry{elems[2*i], elems[2*i+1]}
+	}
+	return entries, true
+}
+
+// replyKind 用于返回回复的类型名称, 用于错误信息
+func replyKind(r resp.Reply) string {
+	switch r.(type) {
+	case *BulkReply:
+		return "bulk string"
+	case *StatusReply, *okReply, *PongReply, *queuedReply:
+		return "simple string"
+	case *IntReply:
+		return "integer"
+	case *DoubleReply:
+		return "double"
+	case *BooleanReply:
+		return "boolean"
+	case *BigNumberReply:
+		return "big number"
+	case *VerbatimReply:
+		return "verbatim string"
+	case *MultiBulkReply, *MultiRawReply, *emptyMultiBulkReply:
+		return "array"
+	case *MapReply:
+		return "map"
+	case *SetReply:
+		return "set"
+	case *PushReply:
+		return "push"
+	}
+	return fmt.Sprintf("%T", r)
+}
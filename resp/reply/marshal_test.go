@@ -0,0 +1,131 @@
+package reply
+
+import (
+	"errors"
+	"math"
+	"math/big"
+	"reflect"
+	"testing"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+)
+
+type testUser struct {
+	Name    string            `resp:"name"`
+	Age     int               `resp:"age"`
+	Email   string            `resp:"email,omitempty"`
+	Tags    []string          `resp:"tags"`
+	Score   float64           // 没有标签时使用字段名
+	Secret  string            `resp:"-"`
+	Extra   map[string]string `resp:"extra,omitempty"`
+	private int
+}
+
+func TestMarshal(t *testing.T) {
+	var nilPtr *testUser
+	tests := []struct {
+		value any
+		resp3 string
+		resp2 string
+	}{
+		{nil, "_\r\n", "$-1\r\n"},
+		{nilPtr, "_\r\n", "$-1\r\n"},
+		{"foo", "$3\r\nfoo\r\n", "$3\r\nfoo\r\n"},
+		{[]byte(nil), "$-1\r\n", "$-1\r\n"},
+		{int8(-3), ":-3\r\n", ":-3\r\n"},
+		{uint64(math.MaxUint64), "(18446744073709551615\r\n", "$20\r\n18446744073709551615\r\n"},
+		{1.5, ",1.5\r\n", "$3\r\n1.5\r\n"},
+		{true, "#t\r\n", ":1\r\n"},
+		{[]string{"a", "b"}, "*2\r\n$1\r\na\r\n$1\r\nb\r\n", "*2\r\n$1\r\na\r\n$1\r\nb\r\n"},
+		{[]int(nil), "*0\r\n", "*0\r\n"},
+		{[2]any{1, nil}, "*2\r\n:1\r\n_\r\n", "*2\r\n:1\r\n$-1\r\n"},
+		{map[string]int{"b": 2, "a": 1}, "%2\r\n$1\r\na\r\n:1\r\n$1\r\nb\r\n:2\r\n", "*4\r\n$1\r\na\r\n:1\r\n$1\r\nb\r\n:2\r\n"},
+		{map[string]struct{}{"x": {}}, "~1\r\n$1\r\nx\r\n", "*1\r\n$1\r\nx\r\n"},
+		{errors.New("oops"), "-ERR oops\r\n", "-ERR oops\r\n"},
+		{NewOKReply(), "+OK\r\n", "+OK\r\n"},
+		{
+			&testUser{Name: "bob", Age: 3, Secret: "s", private: 1},
+			"%4\r\n$4\r\nname\r\n$3\r\nbob\r\n$3\r\nage\r\n:3\r\n$4\r\ntags\r\n*0\r\n$5\r\nScore\r\n,0\r\n",
+			"*8\r\n$4\r\nname\r\n$3\r\nbob\r\n$3\r\nage\r\n:3\r\n$4\r\ntags\r\n*0\r\n$5\r\nScore\r\n$1\r\n0\r\n",
+		},
+	}
+	for _, tt := range tests {
+		r := Marshal(tt.value)
+		if actual := string(Encode(r, resp.RESP3)); actual != tt.resp3 {
+			t.Errorf("%#v: expected %q, actually %q", tt.value, tt.resp3, actual)
+		}
+		if actual := string(Encode(r, resp.RESP2)); actual != tt.resp2 {
+			t.Errorf("%#v: expected %q, actually %q", tt.value, tt.resp2, actual)
+		}
+	}
+	if !IsErrReply(Marshal(make(chan int))) {
+		t.Errorf("expected error reply for unsupported type")
+	}
+}
+
+func TestUnmarshal(t *testing.T) {
+	user := testUser{Name: "bob", Age: 3, Email: "bob@example.com", Tags: []string{"a"}, Score: 1.5, Extra: map[string]string{"k": "v"}}
+	var actual testUser
+	if err := Unmarshal(Marshal(user), &actual); err != nil || !reflect.DeepEqual(actual, user) {
+		t.Errorf("expected %+v, actually %+v %v", user, actual, err)
+	}
+
+	// RESP2中的 HGETALL 返回键值交替排列的数组, 字段名不区分大小写
+	actual = testUser{}
+	hgetall := NewMultiBulkReply(db.CmdLine{[]byte("NAME"), []byte("alice"), []byte("age"), []byte("30"), []byte("unknown"), []byte("x")})
+	if err := Unmarshal(hgetall, &actual); err != nil || actual.Name != "alice" || actual.Age != 30 {
+		t.Errorf("unexpected %+v %v", actual, err)
+	}
+	var fields map[string][]byte
+	if err := Unmarshal(hgetall, &fields); err != nil || string(fields["age"]) != "30" || len(fields) != 3 {
+		t.Errorf("unexpected %q %v", fields, err)
+	}
+
+	var n int64
+	if err := Unmarshal(NewBulkReply([]byte("42")), &n); err != nil || n != 42 {
+		t.Errorf("expected 42, actually %d %v", n, err)
+	}
+	var small int8
+	var typeErr *UnmarshalTypeError
+	if err := Unmarshal(NewIntReply(300), &small); !errors.As(err, &typeErr) {
+		t.Errorf("expected overflow error, actually %v", err)
+	}
+	if err := Unmarshal(NewMapReply(nil), &n); !errors.As(err, &typeErr) || typeErr.Reply != "map" {
+		t.Errorf("expected type error, actually %v", err)
+	}
+
+	var s *string
+	if err := Unmarshal(NewNullBulkReply(), &s); err != nil || s != nil {
+		t.Errorf("expected nil, actually %v %v", s, err)
+	}
+	if err := Unmarshal(NewOKReply(), &s); err != nil || s == nil || *s != "OK" {
+		t.Errorf("expected OK, actually %v %v", s, err)
+	}
+	if err := Unmarshal(NewWrongTypeErrReply(), &s); !errors.Is(err, ErrWrongType) {
+		t.Errorf("expected wrong type, actually %v", err)
+	}
+
+	var big1 *big.Int
+	if err := Unmarshal(Marshal(uint64(math.MaxUint64)), &big1); err != nil || big1.String() != "18446744073709551615" {
+		t.Errorf("unexpected big number %v %v", big1, err)
+	}
+	var set map[string]struct{}
+	if err := Unmarshal(NewSetReply([]resp.Reply{NewBulkReply([]byte("x"))}), &set); err != nil || len(set) != 1 {
+		t.Errorf("unexpected set %v %v", set, err)
+	}
+
+	var value any
+	raw := NewMultiRawReply([]resp.Reply{NewIntReply(1), NewNullReply(), NewMapReply([]MapEntry{{NewStatusReply("k"), NewDoubleReply(2)}})})
+	expected := []any{int64(1), nil, map[string]any{"k": 2.0}}
+	if err := Unmarshal(raw, &value); err != nil || !reflect.DeepEqual(value, expected) {
+		t.Errorf("expected %v, actually %v %v", expected, value, err)
+	}
+	var r resp.Reply
+	if err := Unmarshal(raw, &r); err != nil || r != raw {
+		t.Errorf("expected raw reply, actually %v %v", r, err)
+	}
+	if err := Unmarshal(raw, value); err == nil {
+		t.Errorf("expected error for non-pointer")
+	}
+}
@@ -0,0 +1,135 @@
+package reply
+
+import (
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+	"strconv"
+	"strings"
+)
+
+/***************************************MovedReply*******************************************/
+// MovedReply 用于表示集群中槽已经迁移到其他节点的重定向回复, 编码为 -MOVED 3999 127.0.0.1:6381\r\n
+//
+// 客户端收到之后应该更新槽与节点的映射, 并将命令发送到新的节点
+type MovedReply struct {
+	slot int    // 表示键所在的槽
+	addr string // 表示负责该槽的节点地址
+}
+
+// NewMovedReply 用于创建 MOVED 重定向回复
+func NewMovedReply(slot int, addr string) *MovedReply {
+	return &MovedReply{slot, addr}
+}
+
+// Slot 用于返回键所在的槽
+func (reply *MovedReply) Slot() int {
+	return reply.slot
+}
+
+// Addr 用于返回负责该槽的节点地址, 格式为 host:port
+func (reply *MovedReply) Addr() string {
+	return reply.addr
+}
+
+func (reply *MovedReply) Bytes() []byte {
+	return utils.String2Bytes("-" + reply.Error() + crlf)
+}
+
+func (reply *MovedReply) writeTo(wr *writer) {
+	wr.writeLine('-', reply.Error())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *MovedReply) Size() int {
+	return 1 + len(reply.Error()) + len(crlf)
+}
+
+func (reply *MovedReply) size(int) int {
+	return reply.Size()
+}
+
+func (reply *MovedReply) Error() string {
+	return redirectError(CodeMoved, reply.slot, reply.addr)
+}
+
+func (reply *MovedReply) Code() string {
+	return CodeMoved
+}
+
+func (reply *MovedReply) Is(target error) bool {
+	return isCode(CodeMoved, target)
+}
+
+/***************************************AskReply*******************************************/
+// AskReply 用于表示集群中槽正在迁移的重定向回复, 编码为 -ASK 3999 127.0.0.1:6381\r\n
+//
+// 客户端只需要将这一条命令在 ASKING 之后发送到新的节点, 不需要更新槽与节点的映射
+type AskReply struct {
+	slot int    // 表示键所在的槽
+	addr string // 表示正在导入该槽的节点地址
+}
+
+// NewAskReply 用于创建 ASK 重定向回复
+func NewAskReply(slot int, addr string) *AskReply {
+	return &AskReply{slot, addr}
+}
+
+// Slot 用于返回键所在的槽
+func (reply *AskReply) Slot() int {
+	return reply.slot
+}
+
+// Addr 用于返回正在导入该槽的节点地址, 格式为 host:port
+func (reply *AskReply) Addr() string {
+	return reply.addr
+}
+
+func (reply *AskReply) Bytes() []byte {
+	return utils.String2Bytes("-" + reply.Error() + crlf)
+}
+
+func (reply *AskReply) writeTo(wr *writer) {
+	wr.writeLine('-', reply.Error())
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *AskReply) Size() int {
+	return 1 + len(reply.Error()) + len(crlf)
+}
+
+func (reply *AskReply) size(int) int {
+	return reply.Size()
+}
+
+func (reply *AskReply) Error() string {
+	return redirectError(CodeAsk, reply.slot, reply.addr)
+}
+
+func (reply *AskReply) Code() string {
+	return CodeAsk
+}
+
+func (reply *AskReply) Is(target error) bool {
+	return isCode(CodeAsk, target)
+}
+
+// redirectError 用于返回重定向回复的错误信息, 例如 MOVED 3999 127.0.0.1:6381
+func redirectError(code string, slot int, addr string) string {
+	return code + " " + strconv.Itoa(slot) + " " + addr
+}
+
+// parseRedirect 用于解析重定向回复中错误码之后的 <slot> <addr>, 格式错误时返回nil
+func parseRedirect(code, msg string) resp.ErrorReply {
+	slotStr, addr, ok := strings.Cut(msg, " ")
+	if !ok || addr == "" || strings.IndexByte(addr, ' ') >= 0 {
+		return nil
+	}
+	slot, err := strconv.Atoi(slotStr)
+	if err != nil || slot < 0 {
+		return nil
+	}
+	if code == CodeMoved {
+		return NewMovedReply(slot, addr)
+	}
+	return NewAskReply(slot, addr)
+}
@@ -0,0 +1,37 @@
+package reply
+
+import (
+	"errors"
+	"testing"
+)
+
+func TestRedirectReply(t *testing.T) {
+	moved := NewMovedReply(3999, "127.0.0.1:6381")
+	if string(moved.Bytes()) != "-MOVED 3999 127.0.0.1:6381\r\n" {
+		t.Errorf("unexpected moved reply %q", moved.Bytes())
+	}
+	ask := NewAskReply(12182, "[::1]:7002")
+	if string(ask.Bytes()) != "-ASK 12182 [::1]:7002\r\n" {
+		t.Errorf("unexpected ask reply %q", ask.Bytes())
+	}
+	if !errors.Is(moved, ErrMoved) || errors.Is(moved, ErrAsk) || !errors.Is(ask, ErrAsk) {
+		t.Errorf("unexpected error code match")
+	}
+
+	res := ParseErrReply("MOVED 3999 127.0.0.1:6381")
+	if m, ok := res.(*MovedReply); !ok || m.Slot() != 3999 || m.Addr() != "127.0.0.1:6381" {
+		t.Errorf("expected moved reply, actually %#v", res)
+	}
+	res = ParseErrReply("ASK 12182 [::1]:7002")
+	if a, ok := res.(*AskReply); !ok || a.Slot() != 12182 || a.Addr() != "[::1]:7002" {
+		t.Errorf("expected ask reply, actually %#v", res)
+	}
+
+	// 格式错误的重定向回复保留错误码和原始的错误信息
+	for _, line := range []string{"MOVED", "MOVED abc 127.0.0.1:6381", "ASK 1", "ASK -1 127.0.0.1:6381"} {
+		res = ParseErrReply(line)
+		if _, ok := res.(*CodeErrReply); !ok || string(res.Bytes()) != "-"+line+crlf {
+			t.Errorf("%q: unexpected reply %#v", line, res)
+		}
+	}
+}
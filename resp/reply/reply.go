@@ -1,16 +1,15 @@
 package reply
 
 import (
-	"bytes"
-	"fmt"
 	"godis-lib/interface/db"
-	"strconv"
+	"io"
 
-	"go-redis/interface/resp"
-	"go-redis/lib/utils"
+	"godis-lib/interface/resp"
 )
 
 // BulkReply 用于表示回复字符串
+//
+// Arg 为nil时表示空值, 编码为 $-1\r\n; 长度为0但不为nil时表示空字符串, 编码为 $0\r\n\r\n
 type BulkReply struct {
 	Arg []byte // 表示原始命令
 }
@@ -21,47 +20,62 @@ func NewBulkReply(arg []byte) *BulkReply {
 }
 
 func (reply *BulkReply) Bytes() []byte {
-	if len(reply.Arg) == 0 { // 如果是空字符串, 则返回空字符串的回复
-		return utils.String2Bytes(enum.NIL)
-	}
-	return utils.String2Bytes(fmt.Sprintf("$%d%s%s%s", len(reply.Arg), enum.CRLF, reply.Arg, enum.CRLF))
+	return encode(reply, defaultProtocol)
+}
+
+// WriteTo 用于将回复字符串写入w, Arg 不会被复制到中间缓冲区
+func (reply *BulkReply) WriteTo(w io.Writer) (int64, error) {
+	return WriteTo(w, reply, defaultProtocol)
+}
+
+func (reply *BulkReply) writeTo(wr *writer) {
+	wr.writeBulk(reply.Arg)
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *BulkReply) Size() int {
+	return bulkSize(reply.Arg)
+}
+
+func (reply *BulkReply) size(int) int {
+	return bulkSize(reply.Arg)
 }
 
 // MultiBulkReply 用于表示回复数组
+//
+// 数组中为nil的元素表示空值, 编码为 $-1\r\n, 与空字符串 $0\r\n\r\n 不同;
+// Args 为nil或者长度为0时都编码为空数组 *0\r\n, 空值数组 *-1\r\n 使用 NewNullMultiBulkReply
 type MultiBulkReply struct {
 	Args db.CmdLine // 表示数组中的元素
 }
 
 func (reply *MultiBulkReply) Bytes() []byte {
-	if len(reply.Args) == 0 { // 如果是空数组, 则返回空数组的回复
-		return utils.String2Bytes(enum.EMPTY_BULK_REPLY)
-	}
-	var buf bytes.Buffer
-	// Calculate the length of buffer
-	argLen := len(reply.Args)
-	bufLen := 1 + len(strconv.Itoa(argLen)) + 2
+	return encode(reply, defaultProtocol)
+}
+
+// WriteTo 用于将回复数组写入w, 较大的元素直接写入w而不复制
+func (reply *MultiBulkReply) WriteTo(w io.Writer) (int64, error) {
+	return WriteTo(w, reply, defaultProtocol)
+}
+
+func (reply *MultiBulkReply) writeTo(wr *writer) {
+	wr.writeHeader('*', int64(len(reply.Args)))
 	for _, arg := range reply.Args {
-		if arg == nil {
-			bufLen += 3 + 2
-		} else {
-			bufLen += 1 + len(strconv.Itoa(len(arg))) + 2 + len(arg) + 2
-		}
+		wr.writeBulk(arg)
 	}
-	// Allocate memory
-	buf.Grow(bufLen)
-	buf.WriteString(fmt.Sprintf("*%d%s", argLen, enum.CRLF))
+}
 
+// Size 用于返回编码之后的字节数
+func (reply *MultiBulkReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+func (reply *MultiBulkReply) size(int) int {
+	n := headerSize(int64(len(reply.Args)))
 	for _, arg := range reply.Args {
-		if len(arg) == 0 { // 如果数组中有空字符串, 则返回空字符串的回复
-			buf.WriteString(enum.NIL)
-		} else {
-			buf.WriteString(fmt.Sprintf("$%d%s", len(arg), enum.CRLF))
-			buf.Write(arg)
-			buf.WriteString(enum.CRLF)
-		}
+		n += bulkSize(arg)
 	}
-
-	return buf.Bytes()
+	return n
 }
 
 // NewMultiBulkReply 用于创建回复数组
@@ -79,7 +93,20 @@ func (reply *StatusReply) Status() string {
 }
 
 func (reply *StatusReply) Bytes() []byte {
-	return utils.String2Bytes(fmt.Sprintf("+%s%s", reply.status, enum.CRLF))
+	return encode(reply, defaultProtocol)
+}
+
+func (reply *StatusReply) writeTo(wr *writer) {
+	wr.writeLine('+', reply.status)
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *StatusReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+func (reply *StatusReply) size(int) int {
+	return 1 + len(reply.status) + len(crlf)
 }
 
 // NewStatusReply 用于创建回复状态
@@ -98,7 +125,20 @@ func (reply *IntReply) Code() int64 {
 
 // Bytes 用于返回回复整数的字节切片
 func (reply *IntReply) Bytes() []byte {
-	return utils.String2Bytes(fmt.Sprintf(":%d%s", reply.code, enum.CRLF))
+	return encode(reply, defaultProtocol)
+}
+
+func (reply *IntReply) writeTo(wr *writer) {
+	wr.writeHeader(':', reply.code)
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *IntReply) Size() int {
+	return headerSize(reply.code)
+}
+
+func (reply *IntReply) size(int) int {
+	return headerSize(reply.code)
 }
 
 // NewIntReply 用于创建回复整数
@@ -126,11 +166,31 @@ func NewMultiRawReply(replies []resp.Reply) *MultiRawReply {
 
 // Bytes marshal redis.Reply
 func (r *MultiRawReply) Bytes() []byte {
-	argLen := len(r.Replies)
-	var buf bytes.Buffer
-	buf.WriteString("*" + strconv.Itoa(argLen) + enum.CRLF)
-	for _, arg := range r.Replies {
-		buf.Write(arg.Bytes())
+	return encode(r, defaultProtocol)
+}
+
+// ProtoBytes 按照协议版本编码数组中的每个元素
+func (r *MultiRawReply) ProtoBytes(protocol int) []byte {
+	return encode(r, protocol)
+}
+
+// WriteTo writes replies to w without concatenating the bytes of children
+func (r *MultiRawReply) WriteTo(w io.Writer) (int64, error) {
+	return WriteTo(w, r, defaultProtocol)
+}
+
+func (r *MultiRawReply) writeTo(wr *writer) {
+	wr.writeHeader('*', int64(len(r.Replies)))
+	for _, reply := range r.Replies {
+		wr.writeReply(reply)
 	}
-	return buf.Bytes()
+}
+
+// Size returns the length of Bytes without encoding the replies
+func (r *MultiRawReply) Size() int {
+	return r.size(defaultProtocol)
+}
+
+func (r *MultiRawReply) size(protocol int) int {
+	return aggregateSize(r.Replies, protocol)
 }
@@ -1,36 +1,58 @@
 package reply
 
 import (
-	"godis-lib/lib/logger"
 	"testing"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
 )
 
 func TestNewBulkReply(t *testing.T) {
 	reply := NewBulkReply([]byte("hello"))
-	logger.Info("reply:", string(reply.Bytes()))
+	if actual := string(reply.Bytes()); actual != "$5\r\nhello\r\n" {
+		t.Errorf("unexpected reply %q", actual)
+	}
 }
 
 func TestNewMultiBulkReply(t *testing.T) {
 	reply := NewMultiBulkReply([][]byte{[]byte("ping"), []byte(" "), []byte("pong")})
-	logger.Info("reply:", string(reply.Bytes()))
+	if actual := string(reply.Bytes()); actual != "*3\r\n$4\r\nping\r\n$1\r\n \r\n$4\r\npong\r\n" {
+		t.Errorf("unexpected reply %q", actual)
+	}
 }
 
 func TestIsErrReply(t *testing.T) {
-	reply := NewUnknownErrReply()
-	logger.Info("reply:", string(reply.Bytes()))
-
-	if IsErrReply(reply) {
-		logger.Info("reply is error reply")
-	} else {
-		logger.Info("reply is not error reply")
+	for _, reply := range []resp.Reply{NewUnknownErrReply(), NewErrReply("foo"), NewCodeErrReply(CodeWrongType, "bar"), NewMovedReply(1, "127.0.0.1:7000")} {
+		if !IsErrReply(reply) {
+			t.Errorf("expected %q to be error reply", reply.Bytes())
+		}
 	}
+	for _, reply := range []resp.Reply{NewBulkReply([]byte("hello")), NewStatusReply("OK"), NewNullBulkReply()} {
+		if IsErrReply(reply) {
+			t.Errorf("expected %q not to be error reply", reply.Bytes())
+		}
+	}
+}
 
-	reply2 := NewBulkReply([]byte("hello"))
-	logger.Info("reply:", string(reply2.Bytes()))
-
-	if IsErrReply(reply2) {
-		logger.Info("reply2 is error reply")
-	} else {
-		logger.Info("reply2 is not error reply")
+func TestNilAndEmpty(t *testing.T) {
+	tests := []struct {
+		reply    resp.Reply
+		expected string
+	}{
+		{NewBulkReply(nil), "$-1\r\n"},
+		{NewBulkReply([]byte{}), "$0\r\n\r\n"},
+		{NewBulkReply([]byte("")), "$0\r\n\r\n"},
+		{NewBulkReply([]byte("foo")), "$3\r\nfoo\r\n"},
+		{NewMultiBulkReply(nil), "*0\r\n"},
+		{NewMultiBulkReply(db.CmdLine{}), "*0\r\n"},
+		{NewMultiBulkReply(db.CmdLine{nil, {}, []byte("a")}), "*3\r\n$-1\r\n$0\r\n\r\n$1\r\na\r\n"},
+		{NewNullBulkReply(), "$-1\r\n"},
+		{NewEmptyMultiBulkReply(), "*0\r\n"},
+		{NewNullMultiBulkReply(), "*-1\r\n"},
+	}
+	for _, tt := range tests {
+		if actual := string(tt.reply.Bytes()); actual != tt.expected {
+			t.Errorf("expected %q, actually %q", tt.expected, actual)
+		}
 	}
 }
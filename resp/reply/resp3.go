@@ -0,0 +1,494 @@
+package reply
+
+import (
+	"math"
+	"math/big"
+	"strconv"
+	"strings"
+
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+)
+
+// crlf 是resp协议的行结束符
+const crlf = "\r\n"
+
+/***************************************NullReply*******************************************/
+// NullReply 用于表示RESP3的空值, 编码为 _\r\n
+type NullReply struct{}
+
+var theNullReply = new(NullReply)
+
+// NewNullReply 用于创建RESP3的空值回复
+func NewNullReply() *NullReply {
+	return theNullReply
+}
+
+func (reply *NullReply) Bytes() []byte {
+	return reply.ProtoBytes(resp.RESP3)
+}
+
+// Size 用于返回编码之后的字节数
+func (reply *NullReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+func (reply *NullReply) size(protocol int) int {
+	return utils.If(protocol == resp.RESP2, len(nullBulkBytes), len("_"+crlf))
+}
+
+func (reply *NullReply) writeTo(wr *writer) {
+	if wr.resp3() {
+		wr.write(utils.String2Bytes("_" + crlf))
+	} else {
+		wr.write(utils.String2Bytes(nullBulkBytes))
+	}
+}
+
+// ProtoBytes 在RESP2中降级为空的回复字符串 $-1\r\n
+func (reply *NullReply) ProtoBytes(protocol int) []byte {
+	if protocol == resp.RESP2 {
+		return []byte("$-1" + crlf)
+	}
+	return []byte("_" + crlf)
+}
+
+/***************************************DoubleReply*******************************************/
+// DoubleReply 用于表示RESP3的浮点数回复, 编码为 ,1.23\r\n
+type DoubleReply struct {
+	value float64 // 表示浮点数值
+}
+
+// NewDoubleReply 用于创建浮点数回复
+func NewDoubleReply(value float64) *DoubleReply {
+	return &DoubleReply{value}
+}
+
+func (reply *DoubleReply) Value() float64 {
+	return reply.value
+}
+
+func (reply *DoubleReply) Bytes() []byte {
+	return encode(reply, defaultProtocol)
+}
+
+// ProtoBytes 在RESP2中降级为回复字符串
+func (reply *DoubleReply) ProtoBytes(protocol int) []byte {
+	return encode(reply, protocol)
+}
+
+// Size 用于返回 Bytes 的字节数
+func (reply *DoubleReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+func (reply *DoubleReply) size(protocol int) int {
+	return lineSize(protocol, formatDouble(reply.value))
+}
+
+func (reply *DoubleReply) writeTo(wr *writer) {
+	wr.writeScalar(',', formatDouble(reply.value))
+}
+
+// formatDouble 用于将浮点数格式化为resp协议中的字符串, 无穷大和NaN使用inf, -inf和nan表示
+func formatDouble(value float64) string {
+	switch {
+	case math.IsInf(value, 1):
+		return "inf"
+	case math.IsInf(value, -1):
+		return "-inf"
+	case math.IsNaN(value):
+		return "nan"
+	}
+	return strconv.FormatFloat(value, 'g', -1, 64)
+}
+
+/***************************************BooleanReply*******************************************/
+// BooleanReply 用于表示RESP3的布尔回复, 编码为 #t\r\n 或 #f\r\n
+type BooleanReply struct {
+	value bool // 表示布尔值
+}
+
+// NewBooleanReply 用于创建布尔回复
+func NewBooleanReply(value bool) *BooleanReply {
+	return &BooleanReply{value}
+}
+
+func (reply *BooleanReply) Value() bool {
+	return reply.value
+}
+
+func (reply *BooleanReply) Bytes() []byte {
+	return reply.ProtoBytes(resp.RESP3)
+}
+
+// Size 用于返回编码之后的字节数, RESP2和RESP3中的长度相同
+func (reply *BooleanReply) Size() int {
+	return len("#t" + crlf)
+}
+
+func (reply *BooleanReply) size(int) int {
+	return len("#t" + crlf)
+}
+
+func (reply *BooleanReply) writeTo(wr *writer) {
+	if wr.resp3() {
+		wr.writeLine('#', utils.If(reply.value, "t", "f"))
+	} else {
+		wr.writeHeader(':', utils.If[int64](reply.value, 1, 0))
+	}
+}
+
+// ProtoBytes 在RESP2中降级为整数 :1\r\n 或 :0\r\n
+func (reply *BooleanReply) ProtoBytes(protocol int) []byte {
+	if protocol == resp.RESP2 {
+		if reply.value {
+			return []byte(":1" + crlf)
+		}
+		return []byte(":0" + crlf)
+	}
+	if reply.value {
+		return []byte("#t" + crlf)
+	}
+	return []byte("#f" + crlf)
+}
+
+/***************************************BigNumberReply*******************************************/
+// BigNumberReply 用于表示RESP3的大整数回复, 编码为 (3492890328409238509324850943850943825024385\r\n
+type BigNumberReply struct {
+	value *big.Int // 表示大整数值
+}
+
+// NewBigNumberReply 用于创建大整数回复
+func NewBigNumberReply(value *big.Int) *BigNumberReply {
+	return &BigNumberReply{value}
+}
+
+func (reply *BigNumberReply) Value() *big.Int {
+	return reply.value
+}
+
+func (reply *BigNumberReply) Bytes() []byte {
+	return encode(reply, defaultProtocol)
+}
+
+// ProtoBytes 在RESP2中降级为回复字符串
+func (reply *BigNumberReply) ProtoBytes(protocol int) []byte {
+	return encode(reply, protocol)
+}
+
+// Size 用于返回 Bytes 的字节数
+func (reply *BigNumberReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+func (reply *BigNumberReply) size(protocol int) int {
+	return lineSize(protocol, reply.value.String())
+}
+
+func (reply *BigNumberReply) writeTo(wr *writer) {
+	wr.writeScalar('(', reply.value.String())
+}
+
+/***************************************BlobErrReply*******************************************/
+// BlobErrReply 用于表示RESP3的二进制安全错误回复, 编码为 !21\r\nSYNTAX invalid syntax\r\n
+type BlobErrReply struct {
+	msg []byte // 表示错误信息
+}
+
+// NewBlobErrReply 用于创建二进制安全错误回复
+func NewBlobErrReply(msg []byte) *BlobErrReply {
+	return &BlobErrReply{msg}
+}
+
+func (reply *BlobErrReply) Bytes() []byte {
+	return encode(reply, defaultProtocol)
+}
+
+// ProtoBytes 在RESP2中降级为单行错误回复, 错误信息中的换行会被替换为空格
+func (reply *BlobErrReply) ProtoBytes(protocol int) []byte {
+	return encode(reply, protocol)
+}
+
+// Size 用于返回 Bytes 的字节数
+func (reply *BlobErrReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+// size 在RESP2中替换换行不改变长度
+func (reply *BlobErrReply) size(protocol int) int {
+	if protocol == resp.RESP2 {
+		return 1 + len(reply.msg) + len(crlf)
+	}
+	return headerSize(int64(len(reply.msg))) + len(reply.msg) + len(crlf)
+}
+
+func (reply *BlobErrReply) writeTo(wr *writer) {
+	if !wr.resp3() {
+		wr.writeLine('-', lineReplacer.Replace(utils.Bytes2String(reply.msg)))
+		return
+	}
+	wr.writeHeader('!', int64(len(reply.msg)))
+	wr.write(reply.msg)
+	wr.write(utils.String2Bytes(crlf))
+}
+
+// lineReplacer 用于将单行回复中的换行替换为空格
+var lineReplacer = strings.NewReplacer("\r", " ", "\n", " ")
+
+func (reply *BlobErrReply) Error() string {
+	return string(reply.msg)
+}
+
+// Code 用于返回错误信息中的错误码, 没有错误码时返回 ERR
+func (reply *BlobErrReply) Code() string {
+	if code := errCode(utils.Bytes2String(reply.msg)); code != "" {
+		return strings.Clone(code)
+	}
+	return CodeErr
+}
+
+func (reply *BlobErrReply) Is(target error) bool {
+	return isCode(reply.Code(), target)
+}
+
+/***************************************VerbatimReply*******************************************/
+// VerbatimReply 用于表示RESP3的原样字符串回复, 编码为 =15\r\ntxt:Some string\r\n
+//
+// Format 是3个字节的格式说明, 例如 txt 或 mkd
+type VerbatimReply struct {
+	Format string // 表示格式
+	Text   []byte // 表示内容
+}
+
+// NewVerbatimReply 用于创建原样字符串回复
+func NewVerbatimReply(format string, text []byte) *VerbatimReply {
+	return &VerbatimReply{format, text}
+}
+
+func (reply *VerbatimReply) Bytes() []byte {
+	return encode(reply, defaultProtocol)
+}
+
+// ProtoBytes 在RESP2中降级为不带格式的回复字符串
+func (reply *VerbatimReply) ProtoBytes(protocol int) []byte {
+	return encode(reply, protocol)
+}
+
+// Size 用于返回 Bytes 的字节数
+func (reply *VerbatimReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+func (reply *VerbatimReply) size(protocol int) int {
+	n := len(reply.Text)
+	if protocol != resp.RESP2 {
+		n += len(reply.Format) + 1
+	}
+	return headerSize(int64(n)) + n + len(crlf)
+}
+
+// writeTo 在RESP2中 Text 为nil时也编码为空字符串而不是空值
+func (reply *VerbatimReply) writeTo(wr *writer) {
+	if !wr.resp3() {
+		wr.writeHeader('$', int64(len(reply.Text)))
+	} else {
+		wr.writeHeader('=', int64(len(reply.Format)+1+len(reply.Text)))
+		wr.write(utils.String2Bytes(reply.Format + ":"))
+	}
+	wr.write(reply.Text)
+	wr.write(utils.String2Bytes(crlf))
+}
+
+/***************************************MapReply*******************************************/
+// MapEntry 用于表示MapReply中的一个键值对
+type MapEntry struct {
+	Key   resp.Reply
+	Value resp.Reply
+}
+
+// MapReply 用于表示RESP3的字典回复, 编码为 %2\r\n<key><value><key><value>
+type MapReply struct {
+	Entries []MapEntry // 表示按顺序排列的键值对
+}
+
+// NewMapReply 用于创建字典回复
+func NewMapReply(entries []MapEntry) *MapReply {
+	return &MapReply{entries}
+}
+
+func (reply *MapReply) Bytes() []byte {
+	return encode(reply, defaultProtocol)
+}
+
+// ProtoBytes 在RESP2中降级为键值交替排列的数组
+func (reply *MapReply) ProtoBytes(protocol int) []byte {
+	return encode(reply, protocol)
+}
+
+// Size 用于返回 Bytes 的字节数
+func (reply *MapReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+func (reply *MapReply) size(protocol int) int {
+	n := utils.If(protocol == resp.RESP2, headerSize(int64(len(reply.Entries)*2)), headerSize(int64(len(reply.Entries))))
+	return n + entriesSize(reply.Entries, protocol)
+}
+
+func (reply *MapReply) writeTo(wr *writer) {
+	if wr.resp3() {
+		wr.writeHeader('%', int64(len(reply.Entries)))
+	} else {
+		wr.writeHeader('*', int64(len(reply.Entries)*2))
+	}
+	writeEntries(wr, reply.Entries)
+}
+
+/***************************************SetReply*******************************************/
+// SetReply 用于表示RESP3的集合回复, 编码为 ~2\r\n<member><member>
+type SetReply struct {
+	Members []resp.Reply // 表示集合中的元素
+}
+
+// NewSetReply 用于创建集合回复
+func NewSetReply(members []resp.Reply) *SetReply {
+	return &SetReply{members}
+}
+
+func (reply *SetReply) Bytes() []byte {
+	return encode(reply, defaultProtocol)
+}
+
+// ProtoBytes 在RESP2中降级为数组
+func (reply *SetReply) ProtoBytes(protocol int) []byte {
+	return encode(reply, protocol)
+}
+
+// Size 用于返回 Bytes 的字节数
+func (reply *SetReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+func (reply *SetReply) size(protocol int) int {
+	return aggregateSize(reply.Members, protocol)
+}
+
+func (reply *SetReply) writeTo(wr *writer) {
+	writeAggregate(wr, utils.If[byte](wr.resp3(), '~', '*'), reply.Members)
+}
+
+/***************************************PushReply*******************************************/
+// PushReply 用于表示RESP3的推送回复, 编码为 >3\r\n<kind><channel><message>
+type PushReply struct {
+	Replies []resp.Reply // 表示推送的数据, 第一个元素通常是推送的类型, 例如 message
+}
+
+// NewPushReply 用于创建推送回复
+func NewPushReply(replies []resp.Reply) *PushReply {
+	return &PushReply{replies}
+}
+
+func (reply *PushReply) Bytes() []byte {
+	return encode(reply, defaultProtocol)
+}
+
+// ProtoBytes 在RESP2中降级为数组, 与RESP2中发布订阅的消息格式一致
+func (reply *PushReply) ProtoBytes(protocol int) []byte {
+	return encode(reply, protocol)
+}
+
+// Size 用于返回 Bytes 的字节数
+func (reply *PushReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+func (reply *PushReply) size(protocol int) int {
+	return aggregateSize(reply.Replies, protocol)
+}
+
+func (reply *PushReply) writeTo(wr *writer) {
+	writeAggregate(wr, utils.If[byte](wr.resp3(), '>', '*'), reply.Replies)
+}
+
+/***************************************AttributeReply*******************************************/
+// AttributeReply 用于表示RESP3的属性回复, 属性是附加在后一个回复之前的字典
+//
+// 例如: |1\r\n+key-popularity\r\n%1\r\n$1\r\na\r\n,0.1923\r\n*1\r\n:2039123\r\n
+type AttributeReply struct {
+	Attributes *MapReply  // 表示属性
+	Reply      resp.Reply // 表示属性所修饰的回复
+}
+
+// NewAttributeReply 用于创建属性回复
+func NewAttributeReply(attributes *MapReply, reply resp.Reply) *AttributeReply {
+	return &AttributeReply{attributes, reply}
+}
+
+func (reply *AttributeReply) Bytes() []byte {
+	return encode(reply, defaultProtocol)
+}
+
+// ProtoBytes 在RESP2中丢弃属性, 只返回被修饰的回复
+func (reply *AttributeReply) ProtoBytes(protocol int) []byte {
+	return encode(reply, protocol)
+}
+
+// Size 用于返回 Bytes 的字节数
+func (reply *AttributeReply) Size() int {
+	return reply.size(defaultProtocol)
+}
+
+func (reply *AttributeReply) size(protocol int) int {
+	n := sizeOf(reply.Reply, protocol)
+	if protocol != resp.RESP2 {
+		n += headerSize(int64(len(reply.Attributes.Entries))) + entriesSize(reply.Attributes.Entries, protocol)
+	}
+	return n
+}
+
+func (reply *AttributeReply) writeTo(wr *writer) {
+	if wr.resp3() {
+		wr.writeHeader('|', int64(len(reply.Attributes.Entries)))
+		writeEntries(wr, reply.Attributes.Entries)
+	}
+	wr.writeReply(reply.Reply)
+}
+
+// Encode 用于按照协议版本编码回复
+//
+// 如果回复实现了 resp.ProtocolReply, 则使用对应版本的编码, 否则使用 Bytes
+//
+// 命令处理函数只需要返回一种回复, 再由连接协商的版本决定编码方式, 例如:
+//
+//	conn.Write(reply.Encode(result, conn.GetProtocol()))
+func Encode(reply resp.Reply, protocol int) []byte {
+	if r, ok := reply.(resp.ProtocolReply); ok {
+		return r.ProtoBytes(protocol)
+	}
+	return reply.Bytes()
+}
+
+// writeAggregate 用于编码以类型标识和元素个数开头的聚合回复
+func writeAggregate(wr *writer, prefix byte, replies []resp.Reply) {
+	wr.writeHeader(prefix, int64(len(replies)))
+	for _, r := range replies {
+		wr.writeReply(r)
+	}
+}
+
+// writeEntries 用于按顺序编码键值对
+func writeEntries(wr *writer, entries []MapEntry) {
+	for _, entry := range entries {
+		wr.writeReply(entry.Key)
+		wr.writeReply(entry.Value)
+	}
+}
+
+// lineSize 用于返回单行回复的字节数, 在RESP2中降级为回复字符串
+func lineSize(protocol int, line string) int {
+	if protocol == resp.RESP2 {
+		return headerSize(int64(len(line))) + len(line) + len(crlf)
+	}
+	return 1 + len(line) + len(crlf)
+}
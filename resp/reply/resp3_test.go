@@ -0,0 +1,60 @@
+package reply
+
+import (
+	"math"
+	"math/big"
+	"testing"
+
+	"godis-lib/interface/resp"
+)
+
+func TestEncodeProtocol(t *testing.T) {
+	n, _ := new(big.Int).SetString("3492890328409238509324850943850943825024385", 10)
+	tests := []struct {
+		reply resp.Reply
+		resp3 string
+		resp2 string
+	}{
+		{NewNullReply(), "_\r\n", "$-1\r\n"},
+		{NewDoubleReply(1.5), ",1.5\r\n", "$3\r\n1.5\r\n"},
+		{NewDoubleReply(math.Inf(-1)), ",-inf\r\n", "$4\r\n-inf\r\n"},
+		{NewBooleanReply(true), "#t\r\n", ":1\r\n"},
+		{NewBooleanReply(false), "#f\r\n", ":0\r\n"},
+		{NewBigNumberReply(n), "(" + n.String() + "\r\n", "$43\r\n" + n.String() + "\r\n"},
+		{NewBlobErrReply([]byte("SYNTAX\r\nbad")), "!11\r\nSYNTAX\r\nbad\r\n", "-SYNTAX  bad\r\n"},
+		{NewVerbatimReply("txt", []byte("hi")), "=6\r\ntxt:hi\r\n", "$2\r\nhi\r\n"},
+		{
+			NewMapReply([]MapEntry{{NewStatusReply("a"), NewBooleanReply(true)}}),
+			"%1\r\n+a\r\n#t\r\n",
+			"*2\r\n+a\r\n:1\r\n",
+		},
+		{NewSetReply([]resp.Reply{NewIntReply(1)}), "~1\r\n:1\r\n", "*1\r\n:1\r\n"},
+		{
+			NewPushReply([]resp.Reply{NewBulkReply([]byte("message")), NewNullReply()}),
+			">2\r\n$7\r\nmessage\r\n_\r\n",
+			"*2\r\n$7\r\nmessage\r\n$-1\r\n",
+		},
+		{
+			NewAttributeReply(NewMapReply([]MapEntry{{NewStatusReply("ttl"), NewIntReply(3)}}), NewIntReply(1)),
+			"|1\r\n+ttl\r\n:3\r\n:1\r\n",
+			":1\r\n",
+		},
+		{
+			NewMultiRawReply([]resp.Reply{NewDoubleReply(2), NewMultiRawReply([]resp.Reply{NewNullReply()})}),
+			"*2\r\n,2\r\n*1\r\n_\r\n",
+			"*2\r\n$1\r\n2\r\n*1\r\n$-1\r\n",
+		},
+		{NewIntReply(7), ":7\r\n", ":7\r\n"},
+	}
+	for _, tt := range tests {
+		if actual := string(tt.reply.Bytes()); actual != tt.resp3 {
+			t.Errorf("expected %q, actually %q", tt.resp3, actual)
+		}
+		if actual := string(Encode(tt.reply, resp.RESP3)); actual != tt.resp3 {
+			t.Errorf("expected %q, actually %q", tt.resp3, actual)
+		}
+		if actual := string(Encode(tt.reply, resp.RESP2)); actual != tt.resp2 {
+			t.Errorf("expected %q, actually %q", tt.resp2, actual)
+		}
+	}
+}
@@ -0,0 +1,294 @@
+package reply
+
+import (
+	"io"
+	"strconv"
+	"sync"
+
+	"godis-lib/interface/resp"
+	"godis-lib/lib/utils"
+)
+
+const (
+	// defaultProtocol 表示使用各个回复 Bytes 的默认编码, 即RESP2的类型使用RESP2, RESP3新增的类型使用RESP3
+	defaultProtocol = 0
+	// flushSize 表示缓冲区超过该长度时写入底层的 io.Writer
+	flushSize = 32 << 10
+	// directSize 表示不小于该长度的字符串不复制到缓冲区, 直接写入底层的 io.Writer
+	directSize = 8 << 10
+	// maxPooledSize 表示容量超过该长度的缓冲区不放回池中, 避免长期占用内存
+	maxPooledSize = 1 << 20
+)
+
+// replyWriter 是可以直接编码到 writer 中的回复, 嵌套的回复不会先编码为单独的字节数组
+type replyWriter interface {
+	writeTo(wr *writer)
+}
+
+// sizer 是不需要编码就可以计算编码之后的字节数的回复
+type sizer interface {
+	size(protocol int) int
+}
+
+// writer 用于将回复编码到缓冲区, 缓冲区超过 flushSize 时写入w, 较大的字符串直接写入w而不复制
+//
+// w 为nil时只编码到缓冲区, 用于实现 Bytes
+type writer struct {
+	w        io.Writer
+	buf      []byte
+	protocol int   // 表示协议版本, defaultProtocol 表示使用默认编码
+	n        int64 // 表示已经写入w的字节数
+	err      error // 表示写入w时发生的错误, 发生错误之后不再写入
+}
+
+// WriteTo 用于将回复按照协议版本编码并写入w, 返回写入的字节数
+//
+// 编码使用池化的缓冲区, 数组中较大的字符串直接写入w, 因此 LRANGE key 0 -1 或者 KEYS * 等较大的回复
+// 不需要先拼接为完整的字节数组. 没有实现 resp.ProtocolReply 的回复使用 Bytes 编码
+func WriteTo(w io.Writer, reply resp.Reply, protocol int) (int64, error) {
+	enc := AcquireEncoder(w, protocol)
+	defer enc.Release()
+	_ = enc.Encode(reply)
+	err := enc.Flush()
+	return enc.Written(), err
+}
+
+// AppendTo 用于将回复按照协议版本编码并追加到dst, 返回追加之后的字节数组
+//
+// 与 Bytes 不同, AppendTo 不需要预先计算编码之后的长度, 调用者可以复用dst避免每次分配内存
+func AppendTo(dst []byte, reply resp.Reply, protocol int) []byte {
+	// writer 会逃逸到堆上, 因此借用池中的 Encoder 而不是每次分配新的 writer
+	enc := encoderPool.Get().(*Encoder)
+	pooled := enc.wr.buf
+	enc.wr = writer{buf: dst, protocol: protocol}
+	enc.wr.writeReply(reply)
+	dst = enc.wr.buf
+	enc.wr = writer{buf: pooled}
+	encoderPool.Put(enc)
+	return dst
+}
+
+// encode 用于将回复按照协议版本编码为字节数组, 字节数组的容量与编码之后的长度一致, 只需要分配一次内存
+func encode(reply replyWriter, protocol int) []byte {
+	wr := &writer{protocol: protocol, buf: make([]byte, 0, sizeOf(reply.(resp.Reply), protocol))}
+	reply.writeTo(wr)
+	return wr.buf
+}
+
+// Size 用于返回回复按照协议版本编码之后的字节数, 常用的回复类型不需要编码就可以计算
+func Size(reply resp.Reply, protocol int) int {
+	return sizeOf(reply, protocol)
+}
+
+func sizeOf(reply resp.Reply, protocol int) int {
+	switch r := reply.(type) {
+	case sizer:
+		return r.size(protocol)
+	case resp.ProtocolReply:
+		if protocol != defaultProtocol {
+			return len(r.ProtoBytes(protocol))
+		}
+	}
+	return len(reply.Bytes())
+}
+
+// headerSize 用于返回以类型标识开头的整数行的字节数, 例如 *3\r\n
+func headerSize(n int64) int {
+	size := 1 + 1 + len(crlf)
+	u := uint64(n)
+	if n < 0 {
+		size++
+		u = -u // 使用无符号整数取反, math.MinInt64 也不会溢出
+	}
+	for ; u >= 10; u /= 10 {
+		size++
+	}
+	return size
+}
+
+// bulkSize 用于返回回复字符串的字节数
+func bulkSize(arg []byte) int {
+	if arg == nil {
+		return len(nullBulkBytes)
+	}
+	return headerSize(int64(len(arg))) + len(arg) + len(crlf)
+}
+
+// aggregateSize 用于返回以类型标识和元素个数开头的聚合回复的字节数
+func aggregateSize(replies []resp.Reply, protocol int) int {
+	n := headerSize(int64(len(replies)))
+	for _, r := range replies {
+		n += sizeOf(r, protocol)
+	}
+	return n
+}
+
+// entriesSize 用于返回键值对的字节数
+func entriesSize(entries []MapEntry, protocol int) int {
+	n := 0
+	for _, entry := range entries {
+		n += sizeOf(entry.Key, protocol) + sizeOf(entry.Value, protocol)
+	}
+	return n
+}
+
+// resp3 用于判断是否使用RESP3新增的类型编码, 默认编码时RESP3新增的类型使用RESP3
+func (wr *writer) resp3() bool {
+	return wr.protocol != resp.RESP2
+}
+
+// writeReply 用于编码回复, 嵌套的回复按照相同的协议版本编码
+func (wr *writer) writeReply(reply resp.Reply) {
+	switch r := reply.(type) {
+	case replyWriter:
+		r.writeTo(wr)
+	case resp.ProtocolReply:
+		if wr.protocol == defaultProtocol {
+			wr.write(r.Bytes())
+		} else {
+			wr.write(r.ProtoBytes(wr.protocol))
+		}
+	default:
+		wr.write(reply.Bytes())
+	}
+}
+
+// writeHeader 用于编码以类型标识开头的整数行, 例如 *3\r\n 或者 :100\r\n
+func (wr *writer) writeHeader(prefix byte, n int64) {
+	if wr.err != nil {
+		return
+	}
+	wr.buf = append(wr.buf, prefix)
+	wr.buf = strconv.AppendInt(wr.buf, n, 10)
+	wr.buf = append(wr.buf, crlf...)
+	wr.maybeFlush()
+}
+
+// writeLine 用于编码以类型标识开头的单行回复, 例如 +OK\r\n
+func (wr *writer) writeLine(prefix byte, line string) {
+	if wr.err != nil {
+		return
+	}
+	wr.buf = append(wr.buf, prefix)
+	wr.buf = append(wr.buf, line...)
+	wr.buf = append(wr.buf, crlf...)
+	wr.maybeFlush()
+}
+
+// writeScalar 用于编码RESP3的单行回复, 例如 ,1.5\r\n, 在RESP2中降级为回复字符串
+func (wr *writer) writeScalar(prefix byte, line string) {
+	if wr.resp3() {
+		wr.writeLine(prefix, line)
+	} else {
+		wr.writeBulk(utils.String2Bytes(line))
+	}
+}
+
+// writeBulk 用于编码回复字符串, arg 为nil时编码为空值 $-1\r\n
+func (wr *writer) writeBulk(arg []byte) {
+	if arg == nil {
+		wr.write(utils.String2Bytes(nullBulkBytes))
+		return
+	}
+	wr.writeHeader('$', int64(len(arg)))
+	wr.write(arg)
+	wr.write(utils.String2Bytes(crlf))
+}
+
+// write 用于写入已经编码的数据
+func (wr *writer) write(p []byte) {
+	if wr.err != nil {
+		return
+	}
+	if wr.w != nil && len(p) >= directSize {
+		wr.flush()
+		if wr.err != nil {
+			return
+		}
+		n, err := wr.w.Write(p)
+		wr.n += int64(n)
+		wr.err = err
+		return
+	}
+	wr.buf = append(wr.buf, p...)
+	wr.maybeFlush()
+}
+
+func (wr *writer) maybeFlush() {
+	if wr.w != nil && len(wr.buf) >= flushSize {
+		wr.flush()
+	}
+}
+
+// flush 用于将缓冲区写入w
+func (wr *writer) flush() {
+	if wr.err != nil || len(wr.buf) == 0 {
+		return
+	}
+	n, err := wr.w.Write(wr.buf)
+	wr.n += int64(n)
+	wr.err = err
+	wr.buf = wr.buf[:0]
+}
+
+/***************************************Encoder*******************************************/
+// Encoder 用于将一批回复编码到复用的缓冲区中, 调用 Flush 时一次写入底层的 io.Writer, 例如:
+//
+//	enc := reply.AcquireEncoder(conn, conn.GetProtocol())
+//	defer enc.Release()
+//	for _, cmdLine := range pipeline {
+//		enc.Encode(db.Exec(conn, cmdLine))
+//	}
+//	err := enc.Flush()
+//
+// 缓冲区超过 flushSize 时会提前写入, 较大的字符串直接写入而不复制, 因此内存占用是有限的.
+// Encoder 不是并发安全的
+type Encoder struct {
+	wr writer
+}
+
+var encoderPool = sync.Pool{
+	New: func() any {
+		return &Encoder{wr: writer{buf: make([]byte, 0, flushSize)}}
+	},
+}
+
+// AcquireEncoder 用于从池中获取写入w的 Encoder, 回复按照协议版本编码, 使用之后需要调用 Release
+func AcquireEncoder(w io.Writer, protocol int) *Encoder {
+	enc := encoderPool.Get().(*Encoder)
+	enc.wr.w = w
+	enc.wr.protocol = protocol
+	return enc
+}
+
+// Encode 用于将回复编码到缓冲区, 返回之前写入时发生的错误
+func (enc *Encoder) Encode(reply resp.Reply) error {
+	enc.wr.writeReply(reply)
+	return enc.wr.err
+}
+
+// Buffered 用于返回缓冲区中尚未写入的字节数
+func (enc *Encoder) Buffered() int {
+	return len(enc.wr.buf)
+}
+
+// Written 用于返回已经写入底层 io.Writer 的字节数
+func (enc *Encoder) Written() int64 {
+	return enc.wr.n
+}
+
+// Flush 用于将缓冲区写入底层的 io.Writer
+func (enc *Encoder) Flush() error {
+	enc.wr.flush()
+	return enc.wr.err
+}
+
+// Release 用于将 Encoder 放回池中, 未写入的数据会被丢弃, 之后不能再使用 enc
+func (enc *Encoder) Release() {
+	buf := enc.wr.buf[:0]
+	if cap(buf) > maxPooledSize {
+		buf = make([]byte, 0, flushSize)
+	}
+	enc.wr = writer{buf: buf}
+	encoderPool.Put(enc)
+}
@@ -0,0 +1,194 @@
+package reply
+
+import (
+	"bytes"
+	"errors"
+	"io"
+	"math"
+	"math/big"
+	"testing"
+
+	"godis-lib/interface/db"
+	"godis-lib/interface/resp"
+)
+
+// countWriter 用于记录每次写入的数据
+type countWriter struct {
+	bytes.Buffer
+	writes [][]byte
+}
+
+func (w *countWriter) Write(p []byte) (int, error) {
+	w.writes = append(w.writes, p)
+	return w.Buffer.Write(p)
+}
+
+func TestWriteTo(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), directSize)
+	args := db.CmdLine{[]byte("a"), nil, {}, large}
+	for i := 0; i < 10000; i++ {
+		args = append(args, []byte("member"))
+	}
+	replies := []resp.Reply{
+		NewMultiBulkReply(args),
+		NewMultiRawReply([]resp.Reply{NewIntReply(-1), NewBulkReply(large), NewDoubleReply(1.5)}),
+		NewMapReply([]MapEntry{{NewStatusReply("k"), NewMultiBulkReply(args)}}),
+		NewOKReply(),
+		NewWrongTypeErrReply(),
+	}
+	for _, r := range replies {
+		for _, protocol := range []int{resp.RESP2, resp.RESP3} {
+			w := &countWriter{}
+			n, err := WriteTo(w, r, protocol)
+			expected := Encode(r, protocol)
+			if err != nil || n != int64(len(expected)) || !bytes.Equal(w.Bytes(), expected) {
+				t.Errorf("unexpected result of %T: %d %v", r, n, err)
+			}
+		}
+	}
+
+	// 较大的字符串直接写入而不复制
+	w := &countWriter{}
+	if _, err := NewMultiBulkReply(args).WriteTo(w); err != nil {
+		t.Fatal(err)
+	}
+	var direct bool
+	for _, p := range w.writes {
+		if len(p) > maxPooledSize {
+			t.Errorf("expected bounded writes, actually %d bytes", len(p))
+		}
+		direct = direct || &p[0] == &large[0]
+	}
+	if !direct {
+		t.Errorf("expected large bulk to be written directly")
+	}
+}
+
+// errWriter 用于模拟写入失败
+type errWriter struct {
+	n int
+}
+
+func (w *errWriter) Write(p []byte) (int, error) {
+	if w.n == 0 {
+		return 0, errors.New("broken pipe")
+	}
+	w.n--
+	return len(p), nil
+}
+
+func TestWriteToErr(t *testing.T) {
+	large := bytes.Repeat([]byte("x"), directSize)
+	w := &errWriter{n: 1}
+	n, err := WriteTo(w, NewMultiBulkReply(db.CmdLine{large, large, large}), resp.RESP2)
+	if err == nil || n == 0 {
+		t.Errorf("expected write error, actually %d %v", n, err)
+	}
+}
+
+func TestSize(t *testing.T) {
+	replies := []resp.Reply{
+		NewBulkReply(nil),
+		NewBulkReply([]byte{}),
+		NewBulkReply(bytes.Repeat([]byte("x"), 12345)),
+		NewMultiBulkReply(db.CmdLine{[]byte("a"), nil, {}}),
+		NewMultiBulkReply(nil),
+		NewStatusReply("OK"),
+		NewIntReply(0),
+		NewIntReply(-9),
+		NewIntReply(math.MaxInt64),
+		NewIntReply(math.MinInt64),
+		NewNullReply(),
+		NewBooleanReply(false),
+		NewMultiRawReply([]resp.Reply{NewDoubleReply(1.5), NewOKReply(), NewWrongTypeErrReply()}),
+		NewMapReply([]MapEntry{{NewStatusReply("k"), NewSetReply([]resp.Reply{NewNullReply()})}}),
+		NewPushReply([]resp.Reply{NewIntReply(12)}),
+		NewAttributeReply(NewMapReply([]MapEntry{{NewStatusReply("ttl"), NewIntReply(3)}}), NewIntReply(1)),
+		NewBooleanReply(true),
+		NewDoubleReply(-1.25),
+		NewDoubleReply(math.Inf(1)),
+		NewBigNumberReply(new(big.Int).Lsh(big.NewInt(-1), 100)),
+		NewBlobErrReply([]byte("SYNTAX invalid\r\nsyntax")),
+		NewVerbatimReply("txt", []byte("Some string")),
+		NewVerbatimReply("mkd", nil),
+		// 单例回复
+		NewPongReply(),
+		NewOKReply(),
+		NewNullBulkReply(),
+		NewEmptyMultiBulkReply(),
+		NewNullMultiBulkReply(),
+		NewNoReply(),
+		NewQueuedReply(),
+		// 错误回复
+		NewUnknownErrReply(),
+		NewArgNumErrReply("GET"),
+		NewSyntaxErrReply(),
+		NewWrongTypeErrReply(),
+		NewProtocolErrReply("invalid bulk length"),
+		NewErrReply("ERR something"),
+		&NormalErrReply{Status: "LOADING wait"},
+		NewUnknownCommandErrReply("foo"),
+		NewIntErrReply(),
+		NewNoSuchKeyErrReply(),
+		NewNotValidFloatErrReply(),
+		NewCodeErrReply(CodeBusy, "busy"),
+		ErrMoved,
+		NewMovedReply(3999, "127.0.0.1:6381"),
+		NewAskReply(3999, "127.0.0.1:6381"),
+	}
+	for _, r := range replies {
+		sized, ok := r.(interface{ Size() int })
+		if !ok {
+			t.Errorf("%T: expected Size method", r)
+		} else if sized.Size() != len(r.Bytes()) {
+			t.Errorf("%q: expected size %d, actually %d", r.Bytes(), len(r.Bytes()), sized.Size())
+		}
+		if _, ok = r.(replyWriter); !ok {
+			t.Errorf("%T: expected writeTo method", r)
+		}
+		for _, protocol := range []int{resp.RESP2, resp.RESP3} {
+			if expected := len(Encode(r, protocol)); Size(r, protocol) != expected {
+				t.Errorf("%q: expected size %d, actually %d", r.Bytes(), expected, Size(r, protocol))
+			}
+			if actual := AppendTo([]byte("x"), r, protocol); !bytes.Equal(actual, append([]byte("x"), Encode(r, protocol)...)) {
+				t.Errorf("%q: unexpected AppendTo %q", r.Bytes(), actual)
+			}
+		}
+	}
+}
+
+func TestEncoder(t *testing.T) {
+	w := &countWriter{}
+	enc := AcquireEncoder(w, resp.RESP3)
+	var expected []byte
+	for i := 0; i < 100; i++ {
+		r := NewMultiRawReply([]resp.Reply{NewIntReply(int64(i)), NewNullReply()})
+		if err := enc.Encode(r); err != nil {
+			t.Fatal(err)
+		}
+		expected = append(expected, Encode(r, resp.RESP3)...)
+	}
+	if len(w.writes) != 0 || enc.Buffered() != len(expected) {
+		t.Errorf("expected replies to be buffered, actually %d writes", len(w.writes))
+	}
+	if err := enc.Flush(); err != nil {
+		t.Fatal(err)
+	}
+	if len(w.writes) != 1 || !bytes.Equal(w.Bytes(), expected) || enc.Written() != int64(len(expected)) {
+		t.Errorf("expected one write of %d bytes, actually %d writes", len(expected), len(w.writes))
+	}
+	enc.Release()
+}
+
+func BenchmarkEncoder(b *testing.B) {
+	replies := []resp.Reply{NewOKReply(), NewIntReply(100), NewBulkReply([]byte("value")), NewMultiBulkReply(db.CmdLine{[]byte("a"), []byte("b")})}
+	b.ReportAllocs()
+	for i := 0; i < b.N; i++ {
+		enc := AcquireEncoder(io.Discard, resp.RESP2)
+		for _, r := range replies {
+			_ = enc.Encode(r)
+		}
+		_ = enc.Flush()
+		enc.Release()
+	}
+}
@@ -0,0 +1,261 @@
+package tcp
+
+import (
+	"context"
+	"crypto/tls"
+	"errors"
+	"net"
+	"os"
+	"os/signal"
+	"strings"
+	"sync"
+	"syscall"
+	"time"
+
+	"godis-lib/interface/tcp"
+	"godis-lib/lib/logger"
+	"godis-lib/lib/sync/wait"
+	"godis-lib/resp/reply"
+)
+
+const (
+	// defaultShutdownTimeout is the default time to wait for in-flight connections during shutdown.
+	defaultShutdownTimeout = 10 * time.Second
+	// minAcceptDelay and maxAcceptDelay bound the backoff after a temporary accept error.
+	minAcceptDelay = 5 * time.Millisecond
+	maxAcceptDelay = time.Second
+	// unixScheme is the prefix of Config.Address for unix domain sockets, e.g. "unix:///tmp/redis.sock".
+	unixScheme = "unix://"
+	// forceCloseTimeout bounds the wait for handlers to return after their connections are closed forcibly.
+	forceCloseTimeout = time.Second
+	// rejectTimeout bounds the time spent on replying a client rejected because of Config.MaxConnect.
+	rejectTimeout = time.Second
+)
+
+// errMaxClients is sent to clients rejected because of Config.MaxConnect, the same as redis.
+var errMaxClients = reply.NewErrReply("max number of clients reached")
+
+// Config stores tcp server properties.
+type Config struct {
+	Address         string        // the address to listen on, e.g. ":6379" or "unix:///tmp/redis.sock"
+	MaxConnect      int           // the max number of concurrent clients, 0 means no limit
+	ShutdownTimeout time.Duration // the max time to wait for in-flight connections, 0 means 10s
+	UnixSocketPerm  os.FileMode   // the permission of the unix socket file, 0 means the default of the umask
+	// TLSConfig enables TLS when not nil, it must contain at least one certificate.
+	// Set ClientAuth to tls.RequireAndVerifyClientCert and ClientCAs to authenticate clients by certificates.
+	TLSConfig *tls.Config
+}
+
+// Listen binds cfg.Address and wraps the listener with TLS when cfg.TLSConfig is set.
+//
+// Addresses starting with "unix://" are unix domain sockets, a stale socket file left by a previous
+// process is removed before binding. Other addresses are tcp addresses.
+func Listen(cfg *Config) (net.Listener, error) {
+	var listener net.Listener
+	var err error
+	if path, ok := strings.CutPrefix(cfg.Address, unixScheme); ok {
+		listener, err = listenUnix(path, cfg.UnixSocketPerm)
+	} else {
+		listener, err = net.Listen("tcp", cfg.Address)
+	}
+	if err != nil {
+		return nil, err
+	}
+	if cfg.TLSConfig != nil {
+		listener = tls.NewListener(listener, cfg.TLSConfig)
+	}
+	return listener, nil
+}
+
+// listenUnix binds the unix domain socket at path, the socket file is removed when the listener is closed.
+func listenUnix(path string, perm os.FileMode) (net.Listener, error) {
+	if fi, err := os.Stat(path); err == nil && fi.Mode()&os.ModeSocket != 0 {
+		// a socket nobody accepts on is left by a crashed process
+		if conn, err := net.Dial("unix", path); err == nil {
+			_ = conn.Close()
+			return nil, &net.OpError{Op: "listen", Net: "unix", Addr: &net.UnixAddr{Name: path, Net: "unix"}, Err: syscall.EADDRINUSE}
+		}
+		_ = os.Remove(path)
+	}
+	listener, err := net.Listen("unix", path)
+	if err != nil {
+		return nil, err
+	}
+	if perm != 0 {
+		if err := os.Chmod(path, perm); err != nil {
+			_ = listener.Close()
+			return nil, err
+		}
+	}
+	return listener, nil
+}
+
+// ListenAndServe binds cfg.Address and serves connections with handler until SIGINT or SIGTERM is received.
+//
+// See Listen for the supported addresses and Serve for the shutdown procedure.
+func ListenAndServe(cfg *Config, handler tcp.Handler) error {
+	listener, err := Listen(cfg)
+	if err != nil {
+		return err
+	}
+	logger.Info("bind: ", cfg.Address, ", tls: ", cfg.TLSConfig != nil, ", start listening...")
+
+	ctx, stop := signal.NotifyContext(context.Background(), syscall.SIGINT, syscall.SIGTERM)
+	defer stop()
+	return Serve(ctx, listener, cfg, handler)
+}
+
+// Serve accepts connections on listener and calls handler.Handle for each of them in a new goroutine,
+// until ctx is done or accepting fails with a permanent error.
+//
+// When more than cfg.MaxConnect clients are connected, new clients receive an error reply and are closed.
+// Temporary accept errors, e.g. too many open files, are retried with exponential backoff.
+//
+// Shutdown is graceful: the listener is closed, the context passed to Handle is cancelled so that
+// handlers can finish the current command and return, then Serve waits up to cfg.ShutdownTimeout for
+// in-flight connections. Connections still open after the timeout are closed, and Serve waits a little longer
+// for their handlers to return. Finally handler.Close is called.
+func Serve(ctx context.Context, listener net.Listener, cfg *Config, handler tcp.Handler) error {
+	s := &server{
+		cfg:      cfg,
+		listener: listener,
+		handler:  handler,
+		conns:    make(map[net.Conn]struct{}),
+	}
+	if cfg.MaxConnect > 0 {
+		s.sem = make(chan struct{}, cfg.MaxConnect)
+	}
+
+	connCtx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	stopAfter := context.AfterFunc(ctx, func() { _ = listener.Close() })
+	defer stopAfter()
+
+	err := s.acceptLoop(connCtx)
+	if ctx.Err() != nil || errors.Is(err, net.ErrClosed) {
+		err = nil
+	}
+
+	logger.Info("shutting down...")
+	_ = listener.Close()
+	cancel()
+	s.shutdown()
+	if closeErr := handler.Close(); err == nil {
+		err = closeErr
+	}
+	return err
+}
+
+// server holds the state of a running Serve call.
+type server struct {
+	cfg      *Config
+	listener net.Listener
+	handler  tcp.Handler
+	sem      chan struct{} // limits the number of concurrent clients, nil means no limit
+
+	waitDone wait.Wait // waits for in-flight connections
+	mu       sync.Mutex
+	conns    map[net.Conn]struct{} // open connections, closed forcibly after the shutdown timeout
+}
+
+// acceptLoop accepts connections until the listener is closed or a permanent error occurs.
+func (s *server) acceptLoop(ctx context.Context) error {
+	var delay time.Duration
+	for {
+		conn, err := s.listener.Accept()
+		if err != nil {
+			if !isTemporary(err) {
+				return err
+			}
+			delay = min(max(2*delay, minAcceptDelay), maxAcceptDelay)
+			logger.Warn("accept error: ", err, ", retrying in ", delay)
+			select {
+			case <-time.After(delay):
+				continue
+			case <-ctx.Done():
+				return nil
+			}
+		}
+		delay = 0
+
+		if s.sem != nil {
+			select {
+			case s.sem <- struct{}{}:
+			default:
+				go reject(conn)
+				continue
+			}
+		}
+		s.track(conn, true)
+		s.waitDone.Add(1)
+		go s.serveConn(ctx, conn)
+	}
+}
+
+// serveConn calls the handler and releases the resources of conn after it returns.
+func (s *server) serveConn(ctx context.Context, conn net.Conn) {
+	defer func() {
+		s.track(conn, false)
+		if s.sem != nil {
+			<-s.sem
+		}
+		s.waitDone.Done()
+	}()
+	s.handler.Handle(ctx, conn)
+}
+
+// track adds conn to or removes conn from the open connections.
+func (s *server) track(conn net.Conn, add bool) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	if add {
+		s.conns[conn] = struct{}{}
+	} else {
+		delete(s.conns, conn)
+	}
+}
+
+// shutdown waits for in-flight connections and closes the remaining ones after the timeout,
+// then waits up to forceCloseTimeout for their handlers so that handler.Close does not race with them.
+func (s *server) shutdown() {
+	timeout := s.cfg.ShutdownTimeout
+	if timeout <= 0 {
+		timeout = defaultShutdownTimeout
+	}
+	if !s.waitDone.WaitWithTimeout(timeout) {
+		return
+	}
+
+	s.mu.Lock()
+	logger.Warn("shutdown timeout, closing ", len(s.conns), " connections")
+	for conn := range s.conns {
+		_ = conn.Close()
+	}
+	s.mu.Unlock()
+
+	if s.waitDone.WaitWithTimeout(forceCloseTimeout) {
+		logger.Warn("handlers still running after closing their connections")
+	}
+}
+
+// reject replies errMaxClients and closes conn. It runs in its own goroutine since the write
+// performs the handshake on TLS connections, which must not block the accept loop.
+func reject(conn net.Conn) {
+	_ = conn.SetDeadline(time.Now().Add(rejectTimeout))
+	_, _ = conn.Write(errMaxClients.Bytes())
+	_ = conn.Close()
+}
+
+// isTemporary reports whether the accept error is worth retrying.
+func isTemporary(err error) bool {
+	var ne net.Error
+	if errors.As(err, &ne) && ne.Timeout() {
+		return true
+	}
+	for _, errno := range []syscall.Errno{syscall.EMFILE, syscall.ENFILE, syscall.ENOBUFS, syscall.ENOMEM, syscall.ECONNABORTED, syscall.ECONNRESET} {
+		if errors.Is(err, errno) {
+			return true
+		}
+	}
+	return false
+}
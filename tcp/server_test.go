@@ -0,0 +1,202 @@
+package tcp
+
+import (
+	"bufio"
+	"context"
+	"io"
+	"net"
+	"os"
+	"path/filepath"
+	"sync/atomic"
+	"testing"
+	"time"
+
+	"godis-lib/resp/connection"
+)
+
+// echoHandler echoes lines until the client or the server closes the connection.
+type echoHandler struct {
+	active atomic.Int32
+	closed atomic.Bool
+}
+
+func (h *echoHandler) Handle(ctx context.Context, conn net.Conn) {
+	h.active.Add(1)
+	defer h.active.Add(-1)
+	defer conn.Close()
+	stop := context.AfterFunc(ctx, func() { _ = conn.Close() })
+	defer stop()
+
+	reader := bufio.NewReader(conn)
+	for {
+		line, err := reader.ReadBytes('\n')
+		if err != nil {
+			return
+		}
+		_, _ = conn.Write(line)
+	}
+}
+
+func (h *echoHandler) Close() error {
+	h.closed.Store(true)
+	return nil
+}
+
+func startServer(t *testing.T, cfg *Config, handler *echoHandler) (string, context.CancelFunc, chan error) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, listener, cfg, handler)
+	}()
+	return listener.Addr().String(), cancel, done
+}
+
+func TestServe(t *testing.T) {
+	handler := &echoHandler{}
+	addr, cancel, done := startServer(t, &Config{MaxConnect: 1}, handler)
+
+	conn, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	reader := bufio.NewReader(conn)
+	_, _ = conn.Write([]byte("PING\n"))
+	if line, _ := reader.ReadString('\n'); line != "PING\n" {
+		t.Errorf("expected PING, actually %q", line)
+	}
+
+	// clients beyond MaxConnect receive an error reply
+	rejected, err := net.Dial("tcp", addr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, _ := io.ReadAll(rejected)
+	if string(data) != "-ERR max number of clients reached\r\n" {
+		t.Errorf("unexpected reply %q", data)
+	}
+	_ = rejected.Close()
+
+	cancel()
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+	if err != nil || !handler.closed.Load() || handler.active.Load() != 0 {
+		t.Errorf("unexpected shutdown state: %v %v %d", err, handler.closed.Load(), handler.active.Load())
+	}
+	if _, err = reader.ReadString('\n'); err == nil {
+		t.Errorf("expected connection to be closed")
+	}
+	if _, err = net.Dial("tcp", addr); err == nil {
+		t.Errorf("expected listener to be closed")
+	}
+}
+
+// stuckHandler ignores the context and blocks until the connection is closed,
+// then takes a while to clean up before returning.
+type stuckHandler struct {
+	echoHandler
+	returned      atomic.Bool
+	closedEarlier atomic.Bool // Close was called before Handle returned
+}
+
+func (h *stuckHandler) Handle(_ context.Context, conn net.Conn) {
+	_, _ = io.Copy(io.Discard, conn)
+	time.Sleep(50 * time.Millisecond)
+	h.returned.Store(true)
+}
+
+func (h *stuckHandler) Close() error {
+	h.closedEarlier.Store(!h.returned.Load())
+	return h.echoHandler.Close()
+}
+
+func TestServeShutdownTimeout(t *testing.T) {
+	listener, err := net.Listen("tcp", "127.0.0.1:0")
+	if err != nil {
+		t.Fatal(err)
+	}
+	handler := &stuckHandler{}
+	ctx, cancel := context.WithCancel(context.Background())
+	done := make(chan error, 1)
+	go func() {
+		done <- Serve(ctx, listener, &Config{ShutdownTimeout: 50 * time.Millisecond}, handler)
+	}()
+
+	conn, err := net.Dial("tcp", listener.Addr().String())
+	if err != nil {
+		t.Fatal(err)
+	}
+	defer conn.Close()
+	time.Sleep(20 * time.Millisecond) // wait for the connection to be accepted
+	cancel()
+	select {
+	case err = <-done:
+	case <-time.After(5 * time.Second):
+		t.Fatal("server did not shut down")
+	}
+	if err != nil || !handler.closed.Load() {
+		t.Errorf("unexpected shutdown state: %v %v", err, handler.closed.Load())
+	}
+	if handler.closedEarlier.Load() {
+		t.Errorf("expected Close after the handler returned")
+	}
+	// the server closes the connection forcibly after the timeout
+	_ = conn.SetReadDeadline(time.Now().Add(time.Second))
+	if _, err = conn.Read(make([]byte, 1)); err != io.EOF {
+		t.Errorf("expected EOF, actually %v", err)
+	}
+}
+
+func TestListenUnix(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "redis.sock")
+	cfg := &Config{Address: "unix://" + path, UnixSocketPerm: 0o700}
+	listener, err := Listen(cfg)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fi, err := os.Stat(path); err != nil || fi.Mode().Perm() != 0o700 {
+		t.Errorf("unexpected socket file %v %v", fi, err)
+	}
+	// a socket in use cannot be bound again
+	if _, err = Listen(cfg); err == nil {
+		t.Errorf("expected address in use")
+	}
+
+	addrs := make(chan string, 1)
+	go func() {
+		conn, err := listener.Accept()
+		if err != nil {
+			addrs <- err.Error()
+			return
+		}
+		addrs <- connection.NewRespConnection(conn).RemoteAddr()
+		_ = conn.Close()
+	}()
+	conn, err := net.Dial("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	_ = conn.Close()
+	if addr := <-addrs; addr != path+":0" {
+		t.Errorf("expected %s:0, actually %s", path, addr)
+	}
+	_ = listener.Close()
+
+	// a stale socket file left by a crashed process is removed and bound again
+	stale, err := net.Listen("unix", path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	stale.(*net.UnixListener).SetUnlinkOnClose(false)
+	_ = stale.Close()
+	if listener, err = Listen(cfg); err != nil {
+		t.Fatalf("expected stale socket to be replaced, actually %v", err)
+	}
+	_ = listener.Close()
+}